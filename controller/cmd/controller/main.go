@@ -11,6 +11,7 @@ import (
 	"controller/internal/api"
 	"controller/internal/autoscaler"
 	"controller/internal/config"
+	"controller/internal/domain"
 	"controller/internal/metrics"
 	"controller/internal/provisioner"
 	"controller/internal/redis"
@@ -50,23 +51,39 @@ func main() {
 
 	// Creazione entità
 
-	// Provisioner (Docker)
-	// dockerProvisioner, err := provisioner.NewDockerProvisioner(cfg.DockerNetwork, redisClient)
-	// if err != nil {
-	// 	log.Fatalf("Failed to create Docker Provisioner: %v", err)
-	// }
-
-	// Creazione Provisioner Kubernetes
-	k8sProvisioner, err := provisioner.NewK8sProvisioner(redisClient)
+	// Provisioner: backend scelto da configurazione (PROVISIONER, PROVISIONER_ROUTES)
+	nodeProvisioner, err := provisioner.New(cfg, redisClient)
 	if err != nil {
-		log.Fatalf("Failed to create K8s Provisioner: %v", err)
+		log.Fatalf("Failed to create provisioner: %v", err)
 	}
+	defer nodeProvisioner.Close()
 
 	// Node Manager
-	nodeManager := tree.NewTreeManager(redisClient, k8sProvisioner)
+	nodeManager := tree.NewTreeManager(redisClient, nodeProvisioner)
+	nodeManager.SetReadyTimeout(time.Duration(cfg.NodeReadyTimeout) * time.Second)
+	nodeManager.SetStandbyTargets(map[domain.NodeType]int{
+		domain.NodeTypeInjection: cfg.StandbyInjection,
+		domain.NodeTypeRelay:     cfg.StandbyRelay,
+		domain.NodeTypeEgress:    cfg.StandbyEgress,
+	})
+	if err := nodeManager.SetTierProfiles(map[domain.NodeType]string{
+		domain.NodeTypeInjection: cfg.ProfileInjection,
+		domain.NodeTypeRelay:     cfg.ProfileRelay,
+		domain.NodeTypeEgress:    cfg.ProfileEgress,
+	}); err != nil {
+		log.Fatalf("Invalid node profile: %v", err)
+	}
 
 	// Session Manager
 	sessionManager := session.NewSessionManager(redisClient)
+	// Il drain con destroy distrugge il nodo a fine migrazione
+	sessionManager.SetNodeDestroyer(nodeManager)
+	// Cordon e drain di un agente Kubernetes evacuano i nodi media che ospita
+	if evacuable, ok := nodeProvisioner.(interface {
+		SetNodeEvacuator(provisioner.NodeEvacuator)
+	}); ok {
+		evacuable.SetNodeEvacuator(sessionManager)
+	}
 
 	log.Println("Core Managers Initialized")
 
@@ -79,13 +96,21 @@ func main() {
 		if err := nodeManager.Bootstrap(ctx); err != nil {
 			log.Printf("[WARN] Bootstrap failed: %v", err)
 		}
-		// if err := dockerProvisioner.CreateAgent(ctx); err != nil {
-		// 	log.Printf("Failed to start metrics agent: %v", err)
-		// }
+		if backend, ok := provisioner.Lookup(nodeProvisioner, provisioner.BackendDocker); ok {
+			if err := backend.(*provisioner.DockerProvisioner).CreateAgent(ctx); err != nil {
+				log.Printf("Failed to start metrics agent: %v", err)
+			}
+		}
 	} else {
 		log.Printf("[Main] System already has %d active nodes", len(activeNodes))
 	}
 
+	// Warm standby: provisioning in background, non blocca l'avvio
+	go nodeManager.RefillStandbyPools(ctx)
+
+	// Nodi esterni: nessun orchestratore ne segnala la morte
+	nodeManager.StartExternalHealthProbe(ctx)
+
 	// Avvio background jobs
 
 	// Inizializzazione Metrics Collector
@@ -99,6 +124,11 @@ func main() {
 
 	// Session Cleanup
 	sessionManager.StartCleanupJob(ctx)
+	sessionManager.StartAdmissionWorker(ctx)
+	sessionManager.StartDrainRecovery(ctx)
+	if err := sessionManager.StartFailureRecovery(ctx); err != nil {
+		log.Printf("[WARN] Node failure recovery not started: %v", err)
+	}
 	log.Println("Session cleanup job started")
 
 	// Autoscaler Job
@@ -108,8 +138,11 @@ func main() {
 	}
 	log.Println("Autoscaler job started")
 
+	// Le selezioni fallite per capacità arrivano subito all'autoscaler
+	sessionManager.SetShortageNotifier(autoscalerJob)
+
 	// Api Server
-	server := api.NewServer(cfg, redisClient, nodeManager, sessionManager)
+	server := api.NewServer(cfg, redisClient, nodeManager, sessionManager, autoscalerJob)
 
 	go func() {
 		if err := server.Start(); err != nil {
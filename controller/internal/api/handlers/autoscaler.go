@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"controller/internal/autoscaler"
+)
+
+type AutoscalerHandler struct {
+	autoscalerJob *autoscaler.AutoscalerJob
+}
+
+func NewAutoscalerHandler(job *autoscaler.AutoscalerJob) *AutoscalerHandler {
+	return &AutoscalerHandler{autoscalerJob: job}
+}
+
+// ControlRequest body per attivare un controllo
+type ControlRequest struct {
+	TTL     string `json:"ttl"`     // es. "30m", default 1h, max 24h
+	Size    int    `json:"size"`    // solo per pin
+	Profile string `json:"profile"` // solo per profile: small, medium, large
+	Reason  string `json:"reason"`
+}
+
+// GET /api/autoscaler/controls
+func (h *AutoscalerHandler) ListControls(c *gin.Context) {
+	controls, err := h.autoscalerJob.ListControls(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"controls": controls})
+}
+
+// POST /api/autoscaler/controls/:scope/:kind
+// scope: global, injection, relay, egress - kind: pause, no-scale-down, pin, profile
+func (h *AutoscalerHandler) SetControl(c *gin.Context) {
+	var req ControlRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ttl: " + err.Error()})
+			return
+		}
+		ttl = parsed
+	}
+
+	control, err := h.autoscalerJob.SetControl(c.Request.Context(), c.Param("scope"), c.Param("kind"), req.Size, req.Profile, ttl, req.Reason)
+	if err != nil {
+		c.JSON(controlErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, control)
+}
+
+// DELETE /api/autoscaler/controls/:scope/:kind
+func (h *AutoscalerHandler) ClearControl(c *gin.Context) {
+	scope := c.Param("scope")
+	kind := c.Param("kind")
+
+	if err := h.autoscalerJob.ClearControl(c.Request.Context(), scope, kind); err != nil {
+		c.JSON(controlErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "cleared", "scope": scope, "kind": kind})
+}
+
+func controlErrorStatus(err error) int {
+	if errors.Is(err, autoscaler.ErrInvalidControlScope) ||
+		errors.Is(err, autoscaler.ErrInvalidControlKind) ||
+		errors.Is(err, autoscaler.ErrInvalidPinSize) ||
+		errors.Is(err, autoscaler.ErrInvalidProfile) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
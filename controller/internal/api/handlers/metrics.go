@@ -51,5 +51,9 @@ func (h *MetricsHandler) GetGlobalMetrics(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"metrics": result,
+		// Metriche del controller (latenza della fotografia usata da autoscaler e selector)
+		"controller": gin.H{
+			"clusterSnapshot": h.redisClient.GetSnapshotStats(),
+		},
 	})
 }
@@ -1,24 +1,40 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"controller/internal/domain"
+	"controller/internal/provisioner"
+	"controller/internal/redis"
+	"controller/internal/session"
 	"controller/internal/tree"
 )
 
 type NodeHandler struct {
-	nodeManager *tree.TreeManager
+	nodeManager    *tree.TreeManager
+	sessionManager *session.SessionManager
 }
 
-func NewNodeHandler(manager *tree.TreeManager) *NodeHandler {
+func NewNodeHandler(manager *tree.TreeManager, sessionMgr *session.SessionManager) *NodeHandler {
 	return &NodeHandler{
-		nodeManager: manager,
+		nodeManager:    manager,
+		sessionManager: sessionMgr,
 	}
 }
 
+// DrainRequest body per il drain di un nodo
+type DrainRequest struct {
+	Deadline string `json:"deadline"` // es. "5m", default 10m, max 2h
+	Force    bool   `json:"force"`    // alla deadline chiude le sessioni rimaste (su drain in corso: subito)
+	Destroy  bool   `json:"destroy"`  // distrugge il nodo a drain concluso
+}
+
 // GET /api/nodes
 func (h *NodeHandler) ListNodes(c *gin.Context) {
 	nodes, err := h.nodeManager.ListNodes(c.Request.Context())
@@ -29,39 +45,388 @@ func (h *NodeHandler) ListNodes(c *gin.Context) {
 	c.JSON(http.StatusOK, nodes)
 }
 
-// POST /api/nodes
+// POST /api/nodes?type=relay&role=standalone&profile=large
 func (h *NodeHandler) CreateNode(c *gin.Context) {
 	nodeType := c.Query("type") // injection, relay, egress
 	role := c.DefaultQuery("role", "standalone")
+	profile := c.Query("profile") // small, medium, large (default: profilo del tier)
 
 	if nodeType == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "type query param is required"})
 		return
 	}
 
-	nodes, err := h.nodeManager.CreateNode(c.Request.Context(), domain.NodeType(nodeType), role)
+	nodes, err := h.nodeManager.CreateNode(c.Request.Context(), domain.NodeType(nodeType), role, profile)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(nodeErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusCreated, nodes)
 }
 
-// DELETE /api/nodes/:nodeId
+// GET /api/profiles
+// Profili dei nodi: risorse dei container, slot, viewer e banda per tier
+func (h *NodeHandler) ListProfiles(c *gin.Context) {
+	c.JSON(http.StatusOK, domain.Profiles())
+}
+
+// GET /api/topology?format=json|graphml|dot&tier=relay,egress&status=active
+// Grafo dell'intera mesh: nodi, coppie injection/relay root e archi pesati per sessione
+func (h *NodeHandler) GetTopology(c *gin.Context) {
+	filter := tree.TopologyFilter{
+		Tiers:    splitQueryList(c.Query("tier")),
+		Statuses: splitQueryList(c.Query("status")),
+	}
+
+	graph, err := h.nodeManager.GetTopology(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, graph)
+	case "graphml":
+		c.Data(http.StatusOK, "application/graphml+xml; charset=utf-8", []byte(graph.GraphML()))
+	case "dot":
+		c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(graph.DOT()))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, graphml or dot"})
+	}
+}
+
+func splitQueryList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// GET /api/nodes/:nodeId
+// Provisioning, stato e storico, topologia, sessioni, carico, metriche e /status live del nodo
+func (h *NodeHandler) GetNode(c *gin.Context) {
+	detail, err := h.nodeManager.GetNodeDetail(c.Request.Context(), c.Param("nodeId"))
+	if err != nil {
+		c.JSON(nodeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, detail)
+}
+
+// GET /api/nodes/:nodeId/logs?container=node|janus&since=10m&tail=200&follow=true
+// Inoltra i log del container letti dal provisioner attivo (kubectl/docker logs)
+func (h *NodeHandler) GetNodeLogs(c *gin.Context) {
+	opts := provisioner.LogOptions{
+		Container: c.DefaultQuery("container", provisioner.LogContainerNode),
+		Follow:    c.Query("follow") == "true",
+	}
+
+	if since := c.Query("since"); since != "" {
+		parsed, err := time.ParseDuration(since)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since, expected a duration like 10m"})
+			return
+		}
+		opts.Since = parsed
+	}
+	if tail := c.Query("tail"); tail != "" {
+		parsed, err := strconv.ParseInt(tail, 10, 64)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tail"})
+			return
+		}
+		opts.Tail = parsed
+	}
+
+	stream, err := h.nodeManager.NodeLogs(c.Request.Context(), c.Param("nodeId"), opts)
+	if err != nil {
+		status := nodeErrorStatus(err)
+		if errors.Is(err, provisioner.ErrUnknownContainer) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	defer stream.Close()
+
+	// Lo stream in follow dura più del WriteTimeout del server
+	if opts.Follow {
+		http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	}
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	// Flush a ogni blocco: con follow le righe arrivano man mano
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			if _, werr := c.Writer.Write(buf[:n]); werr != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// DELETE /api/nodes/:nodeId?force=true|drain=true
+// Il tipo è ricavato dal provisioning (?type= resta come fallback per nodi orfani)
+// Con sessioni dipendenti rifiuta (409 + impatto) a meno di force o drain:
+// force distrugge subito, drain sposta le sessioni e distrugge il nodo a drain concluso
 func (h *NodeHandler) DestroyNode(c *gin.Context) {
+	ctx := c.Request.Context()
 	nodeId := c.Param("nodeId")
-	nodeType := c.Query("type") // injection, relay, egress
+	force := c.Query("force") == "true"
+	useDrain := c.Query("drain") == "true"
 
+	nodeType, err := h.nodeManager.NodeTypeOf(ctx, nodeId)
+	if err != nil {
+		nodeType = c.Query("type")
+	}
 	if nodeType == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "type query param is required"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "node not found, pass ?type= to clean up an orphan node"})
 		return
 	}
 
-	if err := h.nodeManager.DestroyNode(c.Request.Context(), nodeId, nodeType); err != nil {
+	// Senza impatto noto non si distrugge: solo un nodo senza provisioning (orfano) procede
+	if !force {
+		impact, err := h.sessionManager.GetNodeImpact(ctx, nodeId)
+		if err != nil && !errors.Is(err, session.ErrNodeNotFound) {
+			c.JSON(drainErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if err == nil && impact.LiveImpact {
+			if !useDrain {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":  "node has live sessions, use force=true or drain=true",
+					"impact": impact,
+				})
+				return
+			}
+
+			progress, err := h.sessionManager.StartDrain(ctx, nodeId, session.DrainOptions{Destroy: true})
+			if err != nil {
+				c.JSON(drainErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusAccepted, gin.H{"status": "draining", "nodeId": nodeId, "drain": progress})
+			return
+		}
+	}
+
+	if err := h.nodeManager.DestroyNode(ctx, nodeId, nodeType); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "destroyed", "nodeId": nodeId})
 }
+
+// POST /api/nodes/register
+// Registra un nodo gestito esternamente (macchina già avviata con lo stesso NODE_ID)
+// Entra in selezione e routing dopo i controlli di readiness, il controller non ne gestisce la macchina
+func (h *NodeHandler) RegisterNode(c *gin.Context) {
+	var req domain.NodeRegistration
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nodes, err := h.nodeManager.RegisterNode(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(nodeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, nodes)
+}
+
+// DELETE /api/nodes/:nodeId/register
+// Con sessioni vive il nodo viene prima drenato e deregistrato a drain concluso
+// Body opzionale come per il drain (deadline, force). La macchina resta accesa
+func (h *NodeHandler) DeregisterNode(c *gin.Context) {
+	ctx := c.Request.Context()
+	nodeId := c.Param("nodeId")
+
+	var req DrainRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var deadline time.Duration
+	if req.Deadline != "" {
+		parsed, err := time.ParseDuration(req.Deadline)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deadline: " + err.Error()})
+			return
+		}
+		deadline = parsed
+	}
+
+	if _, err := h.nodeManager.ExternalNode(ctx, nodeId); err != nil {
+		c.JSON(nodeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// Senza impatto noto non si deregistra: il nodo potrebbe avere sessioni da drenare
+	impact, err := h.sessionManager.GetNodeImpact(ctx, nodeId)
+	if err != nil {
+		c.JSON(drainErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if impact.LiveImpact {
+		progress, err := h.sessionManager.StartDrain(ctx, nodeId, session.DrainOptions{
+			Deadline: deadline,
+			Force:    req.Force,
+			Destroy:  true,
+		})
+		if err != nil {
+			c.JSON(drainErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"status": "draining", "nodeId": nodeId, "drain": progress})
+		return
+	}
+
+	if err := h.nodeManager.DeregisterNode(ctx, nodeId); err != nil {
+		c.JSON(nodeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deregistered", "nodeId": nodeId})
+}
+
+// GET /api/nodes/:nodeId/impact
+// Sessioni, posizioni in catena, egress e viewer che dipendono dal nodo
+func (h *NodeHandler) GetNodeImpact(c *gin.Context) {
+	impact, err := h.sessionManager.GetNodeImpact(c.Request.Context(), c.Param("nodeId"))
+	if err != nil {
+		c.JSON(drainErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, impact)
+}
+
+// CordonRequest body per il cordon di un nodo
+type CordonRequest struct {
+	Reason string `json:"reason"`
+	TTL    string `json:"ttl"` // es. "2h", vuoto = fino a uncordon
+}
+
+// POST /api/nodes/:nodeId/cordon
+// Il nodo continua a servire le sessioni esistenti ma non ne riceve di nuove
+func (h *NodeHandler) CordonNode(c *gin.Context) {
+	var req CordonRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ttl: " + err.Error()})
+			return
+		}
+		ttl = parsed
+	}
+
+	cordon, err := h.nodeManager.CordonNode(c.Request.Context(), c.Param("nodeId"), req.Reason, ttl)
+	if err != nil {
+		c.JSON(nodeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cordon)
+}
+
+// POST /api/nodes/:nodeId/uncordon
+func (h *NodeHandler) UncordonNode(c *gin.Context) {
+	nodeId := c.Param("nodeId")
+
+	if err := h.nodeManager.UncordonNode(c.Request.Context(), nodeId); err != nil {
+		c.JSON(nodeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "active", "nodeId": nodeId})
+}
+
+// POST /api/nodes/:nodeId/drain
+// Sposta attivamente le sessioni su altri nodi, il progresso si legge con GET
+func (h *NodeHandler) DrainNode(c *gin.Context) {
+	var req DrainRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var deadline time.Duration
+	if req.Deadline != "" {
+		parsed, err := time.ParseDuration(req.Deadline)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deadline: " + err.Error()})
+			return
+		}
+		deadline = parsed
+	}
+
+	progress, err := h.sessionManager.StartDrain(c.Request.Context(), c.Param("nodeId"), session.DrainOptions{
+		Deadline: deadline,
+		Force:    req.Force,
+		Destroy:  req.Destroy,
+	})
+	if err != nil {
+		c.JSON(drainErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, progress)
+}
+
+// GET /api/nodes/:nodeId/drain
+func (h *NodeHandler) GetDrain(c *gin.Context) {
+	progress, err := h.sessionManager.GetDrain(c.Request.Context(), c.Param("nodeId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, progress)
+}
+
+func nodeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, tree.ErrNodeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, tree.ErrInvalidCordonTTL), errors.Is(err, tree.ErrInvalidRegistration),
+		errors.Is(err, domain.ErrUnknownProfile):
+		return http.StatusBadRequest
+	case errors.Is(err, tree.ErrNodeNotCordonable), errors.Is(err, tree.ErrNodeNotCordoned),
+		errors.Is(err, tree.ErrNodeAlreadyRegistered), errors.Is(err, tree.ErrNodeNotExternal):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func drainErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, session.ErrNodeNotFound), errors.Is(err, session.ErrDrainNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, session.ErrDrainRelayRoot), errors.Is(err, redis.ErrInvalidTransition):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -27,24 +31,87 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 
 	sessionInfo, err := h.sessionManager.CreateSession(c.Request.Context(), req.SessionId)
 	if err != nil {
+		if errors.Is(err, session.ErrScalingNeeded) {
+			c.Header("Retry-After", "10")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusCreated, sessionInfo)
 }
 
-//	GET /api/sessions/:sessionId/view
+//	GET /api/sessions/:sessionId/view?wait=30s
 //
 // Provisiona egress on-demand per viewer
+// Se la mesh è piena il viewer entra in coda: con wait la richiesta resta in long-poll,
+// altrimenti riceve subito un ticket (202) da interrogare
 func (h *SessionHandler) ViewSession(c *gin.Context) {
 	sessionId := c.Param("sessionId")
 
-	viewerInfo, err := h.sessionManager.ProvisionViewer(c.Request.Context(), sessionId)
+	wait, err := parseWait(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticket, err := h.sessionManager.AdmitViewer(c.Request.Context(), sessionId, wait)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, viewerInfo)
+	respondTicket(c, ticket)
+}
+
+//	GET /api/sessions/:sessionId/view/tickets/:ticketId?wait=30s
+//
+// Stato di un viewer in coda
+func (h *SessionHandler) GetViewTicket(c *gin.Context) {
+	sessionId := c.Param("sessionId")
+	ticketId := c.Param("ticketId")
+
+	wait, err := parseWait(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticket, err := h.sessionManager.WaitViewerTicket(c.Request.Context(), sessionId, ticketId, wait)
+	if err != nil {
+		if errors.Is(err, session.ErrTicketNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	respondTicket(c, ticket)
+}
+
+// respondTicket: 200 con le info del viewer, 202 se ancora in coda, 503 se scaduto
+func respondTicket(c *gin.Context, ticket *session.ViewerTicket) {
+	switch ticket.Status {
+	case session.TicketAdmitted:
+		c.JSON(http.StatusOK, ticket.Viewer)
+	case session.TicketWaiting:
+		c.Header("Retry-After", strconv.Itoa(max(1, min(ticket.EstimatedWaitSec, 10))))
+		c.JSON(http.StatusAccepted, ticket)
+	default:
+		c.JSON(http.StatusServiceUnavailable, ticket)
+	}
+}
+
+func parseWait(c *gin.Context) (time.Duration, error) {
+	raw := c.Query("wait")
+	if raw == "" {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid wait: %w", err)
+	}
+	return wait, nil
 }
 
 // GET /api/sessions/:sessionId
@@ -65,6 +132,31 @@ func (h *SessionHandler) GetSession(c *gin.Context) {
 	c.JSON(http.StatusOK, sessionInfo)
 }
 
+// GET /api/sessions/:sessionId/tree?format=json|dot|mermaid
+// Albero di distribuzione reale della sessione
+func (h *SessionHandler) GetSessionTree(c *gin.Context) {
+	tree, err := h.sessionManager.GetSessionTree(c.Request.Context(), c.Param("sessionId"))
+	if err != nil {
+		if errors.Is(err, session.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, tree)
+	case "dot":
+		c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(tree.DOT()))
+	case "mermaid":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(tree.Mermaid()))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, dot or mermaid"})
+	}
+}
+
 // GET /api/sessions
 func (h *SessionHandler) ListSessions(c *gin.Context) {
 	sessions, err := h.sessionManager.ListSessions(c.Request.Context())
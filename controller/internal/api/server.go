@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"controller/internal/api/handlers"
+	"controller/internal/autoscaler"
 	"controller/internal/config"
 	"controller/internal/redis"
 	"controller/internal/session"
@@ -23,12 +24,14 @@ type Server struct {
 	config         *config.Config
 	nodeManager    *tree.TreeManager
 	sessionManager *session.SessionManager
+	autoscalerJob  *autoscaler.AutoscalerJob
 }
 
 func NewServer(cfg *config.Config,
 	redisClient *redis.Client,
 	nodeMgr *tree.TreeManager,
 	sessMgr *session.SessionManager,
+	autoscalerJob *autoscaler.AutoscalerJob,
 ) *Server {
 
 	gin.SetMode(gin.ReleaseMode)
@@ -43,6 +46,7 @@ func NewServer(cfg *config.Config,
 		config:         cfg,
 		nodeManager:    nodeMgr,
 		sessionManager: sessMgr,
+		autoscalerJob:  autoscalerJob,
 	}
 
 	// Setup routes
@@ -57,14 +61,33 @@ func (s *Server) setupRoutes() {
 	})
 
 	// Handlers
-	nodeHandler := handlers.NewNodeHandler(s.nodeManager)
+	nodeHandler := handlers.NewNodeHandler(s.nodeManager, s.sessionManager)
 	sessionHandler := handlers.NewSessionHandler(s.sessionManager)
 	metricsHandler := handlers.NewMetricsHandler(s.redisClient)
+	autoscalerHandler := handlers.NewAutoscalerHandler(s.autoscalerJob)
 
 	// API Nodes
 	s.router.GET("/api/nodes", nodeHandler.ListNodes)
 	s.router.POST("/api/nodes", nodeHandler.CreateNode)
+	s.router.GET("/api/nodes/:nodeId", nodeHandler.GetNode)
 	s.router.DELETE("/api/nodes/:nodeId", nodeHandler.DestroyNode)
+	s.router.GET("/api/nodes/:nodeId/impact", nodeHandler.GetNodeImpact)
+	s.router.GET("/api/nodes/:nodeId/logs", nodeHandler.GetNodeLogs)
+
+	// Profili dei nodi (POST /api/nodes?profile=...)
+	s.router.GET("/api/profiles", nodeHandler.ListProfiles)
+
+	// Drain con migrazione delle sessioni
+	s.router.POST("/api/nodes/:nodeId/drain", nodeHandler.DrainNode)
+	s.router.GET("/api/nodes/:nodeId/drain", nodeHandler.GetDrain)
+
+	// Nodi esterni (backend static): registrazione e deregistrazione con drain
+	s.router.POST("/api/nodes/register", nodeHandler.RegisterNode)
+	s.router.DELETE("/api/nodes/:nodeId/register", nodeHandler.DeregisterNode)
+
+	// Cordon (manutenzione)
+	s.router.POST("/api/nodes/:nodeId/cordon", nodeHandler.CordonNode)
+	s.router.POST("/api/nodes/:nodeId/uncordon", nodeHandler.UncordonNode)
 
 	// API Sessions
 	s.router.POST("/api/sessions", sessionHandler.CreateSession)               // Crea broadcaster
@@ -73,12 +96,26 @@ func (s *Server) setupRoutes() {
 	s.router.GET("/api/sessions/:sessionId/view", sessionHandler.ViewSession)  // Viewer on-demand
 	s.router.DELETE("/api/sessions/:sessionId", sessionHandler.DestroySession) // Kill totale
 
+	// Sala d'attesa viewer (mesh piena)
+	s.router.GET("/api/sessions/:sessionId/view/tickets/:ticketId", sessionHandler.GetViewTicket)
+
 	s.router.DELETE("/api/sessions/:sessionId/path/:egressId", sessionHandler.DestroySessionPath)
 
+	// Albero di distribuzione (json, dot, mermaid)
+	s.router.GET("/api/sessions/:sessionId/tree", sessionHandler.GetSessionTree)
+
+	// Topologia della mesh (json, graphml, dot)
+	s.router.GET("/api/topology", nodeHandler.GetTopology)
+
 	// API Metrics
 	s.router.GET("/api/metrics", metricsHandler.GetGlobalMetrics)
 	s.router.GET("/api/metrics/:nodeId", metricsHandler.GetNodeMetrics)
 
+	// API Autoscaler (pause, freeze scale-down, pin)
+	s.router.GET("/api/autoscaler/controls", autoscalerHandler.ListControls)
+	s.router.POST("/api/autoscaler/controls/:scope/:kind", autoscalerHandler.SetControl)
+	s.router.DELETE("/api/autoscaler/controls/:scope/:kind", autoscalerHandler.ClearControl)
+
 	//File statici
 	s.router.GET("/", func(c *gin.Context) {
 		c.File("web/sessions.html")
@@ -95,10 +132,13 @@ func (s *Server) setupRoutes() {
 			"version": "0.1.0",
 			"status":  "running",
 			"endpoints": gin.H{
-				"health":   "/api/health",
-				"nodes":    "/api/nodes",
-				"sessions": "/api/sessions",
-				"ui":       "/sessions.html",
+				"health":     "/api/health",
+				"nodes":      "/api/nodes",
+				"sessions":   "/api/sessions",
+				"topology":   "/api/topology",
+				"profiles":   "/api/profiles",
+				"autoscaler": "/api/autoscaler/controls",
+				"ui":         "/sessions.html",
 			},
 		})
 	})
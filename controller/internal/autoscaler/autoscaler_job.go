@@ -20,10 +20,11 @@ const (
 	MinActiveEgresses      = 1
 	MinFreeSlotsInjection  = 2
 	MinFreeSlotsEgress     = 5
+	MinFreeSlotsRelay      = 4 // Spazio previsto per almeno due deepening
 )
 
 type ProvisionerClient interface {
-	ScaleUp(ctx context.Context, nodeType domain.NodeType) error
+	ScaleUp(ctx context.Context, nodeType domain.NodeType, profile string) error
 	DestroyNode(ctx context.Context, nodeId, nodeType string) error
 }
 
@@ -33,6 +34,7 @@ type AutoscalerJob struct {
 	relayCalc     *RelayLoadCalculator
 	egressCalc    *EgressLoadCalculator
 	provisioner   ProvisionerClient
+	shortages     chan CapacityShortage
 	stopChan      chan struct{}
 	running       bool
 }
@@ -40,10 +42,11 @@ type AutoscalerJob struct {
 func NewAutoscalerJob(redisClient *redis.Client, provisioner ProvisionerClient) *AutoscalerJob {
 	return &AutoscalerJob{
 		redis:         redisClient,
-		injectionCalc: NewInjectionLoadCalculator(redisClient),
-		relayCalc:     NewRelayLoadCalculator(redisClient),
-		egressCalc:    NewEgressLoadCalculator(redisClient),
+		injectionCalc: NewInjectionLoadCalculator(),
+		relayCalc:     NewRelayLoadCalculator(),
+		egressCalc:    NewEgressLoadCalculator(),
 		provisioner:   provisioner,
+		shortages:     make(chan CapacityShortage, ShortageQueueSize),
 		stopChan:      make(chan struct{}),
 	}
 }
@@ -75,6 +78,11 @@ func (job *AutoscalerJob) orchestratorLoop(ctx context.Context) {
 			tickCtx, cancel := context.WithTimeout(ctx, 25*time.Second)
 			job.runTick(tickCtx)
 			cancel()
+		case shortage := <-job.shortages:
+			// Scale up event-driven: non aspettiamo il prossimo tick
+			shortageCtx, cancel := context.WithTimeout(ctx, ShortageTimeout)
+			job.handleShortage(shortageCtx, shortage)
+			cancel()
 		case <-job.stopChan:
 			return
 		case <-ctx.Done():
@@ -84,126 +92,173 @@ func (job *AutoscalerJob) orchestratorLoop(ctx context.Context) {
 }
 
 func (job *AutoscalerJob) runTick(ctx context.Context) {
+	// I cordon scaduti tornano in servizio prima di valutare i pool
+	if expired, err := job.redis.ExpireCordons(ctx); err == nil && len(expired) > 0 {
+		log.Printf("[Autoscaler] Cordon expired, nodes back in service: %v", expired)
+	}
 
-	job.manageInjectionPool(ctx)
+	controls := job.loadControls(ctx)
 
-	job.manageRelayPool(ctx)
+	// Una sola fotografia per tick: tutti i tier decidono sullo stesso stato
+	snapshot, err := job.redis.GetClusterSnapshot(ctx)
+	if err != nil {
+		log.Printf("[Autoscaler] Cluster snapshot failed, skipping pool evaluation: %v", err)
+	}
 
-	job.manageEgressPool(ctx)
+	for _, tier := range []string{"injection", "relay", "egress"} {
+		tc := controls[tier]
+		if tc.Paused {
+			log.Printf("[Autoscaler-%s] Paused by manual control, skipping", tier)
+			continue
+		}
+		if snapshot == nil {
+			continue
+		}
+		if tc.PinnedSize > 0 {
+			job.enforcePinnedSize(ctx, snapshot, tier, tc)
+			continue
+		}
 
-	job.cleanupDrainingNodes(ctx)
+		switch tier {
+		case "injection":
+			job.manageInjectionPool(ctx, snapshot, tc)
+		case "relay":
+			job.manageRelayPool(ctx, snapshot, tc)
+		case "egress":
+			job.manageEgressPool(ctx, snapshot, tc)
+		}
+	}
+
+	if snapshot != nil {
+		job.cleanupDrainingNodes(ctx, snapshot, controls)
+	}
 }
 
 // Injection
-func (job *AutoscalerJob) manageInjectionPool(ctx context.Context) {
-	report, err := job.injectionCalc.GetPoolReport(ctx)
+func (job *AutoscalerJob) manageInjectionPool(ctx context.Context, snapshot *redis.ClusterSnapshot, controls TierControls) {
+	report, err := job.injectionCalc.GetPoolReport(snapshot)
 	if err != nil {
 		return
 	}
 
-	// Regola: Scale up se posti totali < MinFreeSlotsInjection o hardware sopra soglia
-	if report.TotalNodes < MinActiveInjections || report.TotalAvailableSlots < MinFreeSlotsInjection || report.AvgHardwareLoad >= 100.0 {
+	// Regola: Scale up se i posti previsti a fine provisioning < MinFreeSlotsInjection
+	// o se l'hardware (smussato, con isteresi) è sopra soglia
+	if report.TotalNodes < MinActiveInjections || report.ForecastAvailableSlots < MinFreeSlotsInjection || report.Overloaded {
 		// Tenta di riattivare un nodo esistente in draining
-		if job.tryReactivateNode(ctx, "injection") {
+		if job.tryReactivateNode(ctx, snapshot, "injection") {
 			log.Printf("[Autoscaler-injection] Reactivated node from draining instead of scaling up")
 			return
 		}
 
 		// Se non ci sono nodi da riattivare, procedi con lo Scale up
 		if job.tryAcquireLock(ctx, "injection") {
-			log.Printf("[Autoscaler-injection] Scaling UP (Slots: %d, HW Load: %.2f)", report.TotalAvailableSlots, report.AvgHardwareLoad)
-			go job.provisioner.ScaleUp(context.Background(), domain.NodeTypeInjection)
+			log.Printf("[Autoscaler-injection] Scaling UP (Slots: %d, Forecast: %.1f, HW Load: %.2f, Standby: %d)",
+				report.TotalAvailableSlots, report.ForecastAvailableSlots, report.SmoothedHardwareLoad, report.StandbyNodes)
+			go job.provisioner.ScaleUp(context.Background(), domain.NodeTypeInjection, controls.Profile)
 		}
 	}
 
-	// Scale Down: Se abbiamo troppa capacità e l'hardware è scarico (<20%)
+	// Scale Down: Se abbiamo troppa capacità, l'hardware è scarico (banda <20%)
+	// e la domanda non sta crescendo
 	// modificare variabile harcoded
 
-	if report.TotalNodes > MinActiveInjections && report.AvgHardwareLoad < 20.0 && report.TotalAvailableSlots > 12 {
-		job.markVictimForDraining(ctx, "injection")
+	if !controls.ScaleDownDisabled && report.TotalNodes > MinActiveInjections && report.Underloaded &&
+		report.TotalAvailableSlots > 12 && report.ForecastAvailableSlots > 12 && report.DemandTrend <= 0 {
+		job.markVictimForDraining(ctx, snapshot, "injection")
 	}
 }
 
 // Relay
-func (job *AutoscalerJob) manageRelayPool(ctx context.Context) {
-	report, err := job.relayCalc.GetStandalonePoolReport(ctx)
+func (job *AutoscalerJob) manageRelayPool(ctx context.Context, snapshot *redis.ClusterSnapshot, controls TierControls) {
+	report, err := job.relayCalc.GetStandalonePoolReport(snapshot)
 	if err != nil || report.TotalNodes == 0 {
 		return
 	}
 
 	// Regola: Vogliamo sempre almeno 1 nodo spare e due slot per nuove sessioni
-	if report.SpareNodes < 1 || report.NodesForDeepening < 1 || report.AvgHardwareLoad >= 100.0 {
+	// Viewer in sala d'attesa per mancanza di relay
+	queued := job.admissionQueueLength(ctx, "relay")
+
+	if report.SpareNodes < 1 || report.NodesForDeepening < 1 || report.ForecastFreeSlots < MinFreeSlotsRelay || report.Overloaded || queued > 0 {
 
-		if job.tryReactivateNode(ctx, "relay") {
+		if job.tryReactivateNode(ctx, snapshot, "relay") {
 			log.Printf("[Autoscaler-relay] Reactivated relay from draining")
 			return
 		}
 
 		if job.tryAcquireLock(ctx, "relay") {
-			log.Printf("[Autoscaler-relay] Scaling UP (Spare: %d, Deepening: %d, HW: %.2f)",
-				report.SpareNodes, report.NodesForDeepening, report.AvgHardwareLoad)
-			go job.provisioner.ScaleUp(context.Background(), domain.NodeTypeRelay)
+			log.Printf("[Autoscaler-relay] Scaling UP (Spare: %d, Deepening: %d, Forecast free: %.1f, HW: %.2f, Queued: %d, Standby: %d)",
+				report.SpareNodes, report.NodesForDeepening, report.ForecastFreeSlots, report.SmoothedHardwareLoad, queued, report.StandbyNodes)
+			go job.provisioner.ScaleUp(context.Background(), domain.NodeTypeRelay, controls.Profile)
 		}
 	}
 
-	// Scale Down: Se abbiamo più di 1 nodo completamente vuoto
-	if report.TotalNodes > MinActiveRelays && report.SpareNodes > 1 {
-		job.markVictimForDraining(ctx, "relay")
+	// Scale Down: Se abbiamo più di 1 nodo completamente vuoto e la domanda non cresce
+	if !controls.ScaleDownDisabled && report.TotalNodes > MinActiveRelays && report.SpareNodes > 1 &&
+		!report.Overloaded && report.DemandTrend <= 0 && queued == 0 {
+		job.markVictimForDraining(ctx, snapshot, "relay")
 	}
 }
 
 // Egress
-func (job *AutoscalerJob) manageEgressPool(ctx context.Context) {
-	report, err := job.egressCalc.GetPoolReport(ctx)
+func (job *AutoscalerJob) manageEgressPool(ctx context.Context, snapshot *redis.ClusterSnapshot, controls TierControls) {
+	report, err := job.egressCalc.GetPoolReport(snapshot)
 	if err != nil {
 		return
 	}
 
-	// Regola: Scala up solo se tutti i nodi sono saturi, ci sono meno di 5 posto o hardware saturo
-	if report.TotalFreeSlots < MinFreeSlotsEgress || report.SaturatedNodesCount >= report.TotalNodes || report.AvgHardwareLoad >= 100.0 {
-		if job.tryReactivateNode(ctx, "egress") {
+	// Regola: Scala up solo se tutti i nodi sono saturi, a fine provisioning ci sarebbero meno di 5 posti
+	// o l'hardware è saturo
+	// I viewer in coda sono domanda non ancora servita
+	queued := job.admissionQueueLength(ctx, "egress")
+
+	if report.ForecastFreeSlots-float64(queued) < MinFreeSlotsEgress || report.SaturatedNodesCount >= report.TotalNodes || report.Overloaded {
+		if job.tryReactivateNode(ctx, snapshot, "egress") {
 			log.Printf("[Autoscaler-egress] Reactivated egress from draining")
 			return
 		}
 		if job.tryAcquireLock(ctx, "egress") {
-			log.Printf("[Autoscaler-egress] All %d nodes are saturated. Scaling UP.", report.TotalNodes)
-			go job.provisioner.ScaleUp(context.Background(), domain.NodeTypeEgress)
+			log.Printf("[Autoscaler-egress] Scaling UP (Nodes: %d, Saturated: %d, Free: %d, Forecast free: %.1f, Trend: %.3f viewers/s, Queued: %d, Standby: %d)",
+				report.TotalNodes, report.SaturatedNodesCount, report.TotalFreeSlots, report.ForecastFreeSlots, report.DemandTrend, queued, report.StandbyNodes)
+			go job.provisioner.ScaleUp(context.Background(), domain.NodeTypeEgress, controls.Profile)
 		}
 	}
 
 	// Scale Down
 	// modificare variabile harcoded
-	if report.TotalNodes > MinActiveEgresses && report.TotalFreeSlots > 15 {
-		job.markVictimForDraining(ctx, "egress")
+	if !controls.ScaleDownDisabled && report.TotalNodes > MinActiveEgresses && report.TotalFreeSlots > 15 &&
+		report.ForecastFreeSlots > 15 && report.Underloaded && report.DemandTrend <= 0 && queued == 0 {
+		job.markVictimForDraining(ctx, snapshot, "egress")
 	}
 }
 
 // tryReactivateNode cerca il nodo in draining con più carico per recuperarlo
-func (job *AutoscalerJob) tryReactivateNode(ctx context.Context, nodeType string) bool {
-	nodeIds, _ := job.redis.GetNodePool(ctx, nodeType)
-
-	var bestCandidate string
+func (job *AutoscalerJob) tryReactivateNode(ctx context.Context, snapshot *redis.ClusterSnapshot, nodeType string) bool {
+	var best *redis.ClusterNode
 	maxLoad := -1
 
-	for _, id := range nodeIds {
-		status, _ := job.redis.GetNodeStatus(ctx, id)
-		if status == "draining" {
-			load, _ := job.getNodeLoad(ctx, id, nodeType)
-			if load > maxLoad {
+	for _, node := range snapshot.Pool(nodeType) {
+		// Un drain manuale in corso non va annullato
+		if node.Status == redis.NodeStatusDraining && !node.ManualDrain {
+			if load := nodeLoad(node); load > maxLoad {
 				maxLoad = load
-				bestCandidate = id
+				best = node
 			}
 		}
 	}
 
-	if bestCandidate != "" {
+	if best != nil {
+		bestCandidate := best.Info.NodeId
 		log.Printf("[Autoscaler] Reactivating most loaded draining node: %s (Load: %d)", bestCandidate, maxLoad)
-		job.redis.SetNodeStatus(ctx, bestCandidate, "active")
+		// Il drain può essere stato chiuso nel frattempo: la transizione lo verifica
+		if _, err := job.redis.TransitionNodeStatus(ctx, bestCandidate, redis.NodeStatusActive, "autoscaler", "scale up: reactivating draining node"); err != nil {
+			log.Printf("[WARN] Failed to reactivate %s: %v", bestCandidate, err)
+			return false
+		}
 
 		if nodeType == "injection" {
-			children, _ := job.redis.GetNodeChildren(ctx, bestCandidate)
-			for _, cid := range children {
-				job.redis.SetNodeStatus(ctx, cid, "active")
+			for _, cid := range best.Children {
+				job.redis.TransitionNodeStatus(ctx, cid, redis.NodeStatusActive, "autoscaler", "parent injection reactivated")
 			}
 		}
 
@@ -215,68 +270,73 @@ func (job *AutoscalerJob) tryReactivateNode(ctx context.Context, nodeType string
 }
 
 // markVictimForDraining cerca il nodo attivo con meno carico per metterlo in draining
-func (job *AutoscalerJob) markVictimForDraining(ctx context.Context, nodeType string) {
-	nodeIds, _ := job.redis.GetNodePool(ctx, nodeType)
-
+func (job *AutoscalerJob) markVictimForDraining(ctx context.Context, snapshot *redis.ClusterSnapshot, nodeType string) {
 	var bestVictim string
 	minLoad := math.MaxInt32
 	now := time.Now().Unix()
 
-	for _, id := range nodeIds {
-		nodeInfo, err := job.redis.GetNodeProvisioning(ctx, id)
-		if err != nil || nodeInfo.Role == "root" {
+	for _, node := range snapshot.Pool(nodeType) {
+		// I nodi esterni non si spengono: si deregistrano a mano
+		if node.Info.Role == "root" || node.Info.IsExternal() {
 			continue
 		}
-		status, _ := job.redis.GetNodeStatus(ctx, id)
-		if status == "active" {
+		if node.IsActive() {
 
 			// info.CreatedAt è popolato dal Controller durante il provisioning
-			if (now - nodeInfo.CreatedAt) < int64(NodeMinLifeTime.Seconds()) {
+			if (now - node.Info.CreatedAt) < int64(NodeMinLifeTime.Seconds()) {
 				continue // Il nodo è troppo giovane, non lo spegniamo
 			}
-			load, _ := job.getNodeLoad(ctx, id, nodeType)
-			if load < minLoad {
+			if load := nodeLoad(node); load < minLoad {
 				minLoad = load
-				bestVictim = id
+				bestVictim = node.Info.NodeId
 			}
 		}
 	}
 	if bestVictim != "" {
 		log.Printf("[Autoscaler] DRAINING least loaded node: %s (Load: %d)", bestVictim, minLoad)
-		job.redis.SetNodeStatus(ctx, bestVictim, "draining")
+		// La fotografia può essere vecchia: la transizione verifica lo stato attuale
+		if _, err := job.redis.TransitionNodeStatus(ctx, bestVictim, redis.NodeStatusDraining, "autoscaler", "scale down: least loaded node"); err != nil {
+			log.Printf("[WARN] Failed to drain %s: %v", bestVictim, err)
+		}
 	}
 }
 
-func (job *AutoscalerJob) cleanupDrainingNodes(ctx context.Context) {
+func (job *AutoscalerJob) cleanupDrainingNodes(ctx context.Context, snapshot *redis.ClusterSnapshot, controls map[string]TierControls) {
 	tiers := []string{"injection", "relay", "egress"}
 	for _, tier := range tiers {
-		nodeIds, _ := job.redis.GetNodePool(ctx, tier)
-		for _, id := range nodeIds {
-			status, _ := job.redis.GetNodeStatus(ctx, id)
-			if status == "draining" {
-				if job.isLogicallyEmpty(ctx, id, tier) {
-					log.Printf("[Autoscaler] Final Cleanup: %s (%s) is empty.", id, tier)
-					job.provisioner.DestroyNode(ctx, id, tier)
-				}
-
+		// Con pause o scale-down disabilitato i nodi in draining restano in vita
+		if tc := controls[tier]; tc.Paused || tc.ScaleDownDisabled {
+			continue
+		}
+		for _, node := range snapshot.Pool(tier) {
+			if node.Status == redis.NodeStatusDraining && isLogicallyEmpty(node) {
+				log.Printf("[Autoscaler] Final Cleanup: %s (%s) is empty.", node.Info.NodeId, tier)
+				job.provisioner.DestroyNode(ctx, node.Info.NodeId, tier)
 			}
 		}
 	}
 }
 
-func (job *AutoscalerJob) getNodeLoad(ctx context.Context, nodeId, nodeType string) (int, error) {
-	switch nodeType {
-	case "injection":
-		score, err := job.redis.ZScore(ctx, "pool:injection:load", nodeId)
-		return int(score), err
-	case "relay":
-		score, err := job.redis.ZScore(ctx, "pool:relay:load", nodeId)
-		return int(score), err
-	case "egress":
-		count, err := job.redis.GetNodeTotalViewers(ctx, nodeId)
-		return int(count), err
+// nodeLoad carico del nodo sulla fotografia: sessioni per injection e relay, viewer per egress
+func nodeLoad(node *redis.ClusterNode) int {
+	if node.Info.NodeType == domain.NodeTypeEgress {
+		return EgressViewers(node)
 	}
-	return 1, nil
+	return int(node.Load)
+}
+
+// admissionQueueLength legge quanti viewer aspettano capacità su un tier
+func (job *AutoscalerJob) admissionQueueLength(ctx context.Context, tier string) int64 {
+	queued, err := job.redis.GetAdmissionQueueLength(ctx, tier)
+	if err != nil {
+		return 0
+	}
+	return queued
+}
+
+// tierNodeType converte il nome del pool nel tipo di nodo
+func tierNodeType(tier string) domain.NodeType {
+	return domain.NodeType(tier)
 }
 
 func (job *AutoscalerJob) tryAcquireLock(ctx context.Context, tier string) bool {
@@ -286,14 +346,11 @@ func (job *AutoscalerJob) tryAcquireLock(ctx context.Context, tier string) bool
 }
 
 // isLogicallyEmpty controlla se un nodo non ha più percorsi mesh attivi
-func (job *AutoscalerJob) isLogicallyEmpty(ctx context.Context, id, nodeType string) bool {
-	if nodeType == "egress" {
+func isLogicallyEmpty(node *redis.ClusterNode) bool {
+	if node.Info.NodeType == domain.NodeTypeEgress {
 		// Un Egress è vuoto logicamente solo se non ha più mountpoints
-		key := fmt.Sprintf("node:%s:mountpoints", id)
-		count, _ := job.redis.GetRedisClient().SCard(ctx, key).Result()
-		return count == 0
+		return node.Mountpoints == 0
 	}
 	// Per Injection e Relay, il carico coincide con le sessioni
-	load, _ := job.getNodeLoad(ctx, id, nodeType)
-	return load == 0
+	return nodeLoad(node) == 0
 }
@@ -0,0 +1,201 @@
+package autoscaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"controller/internal/domain"
+	"controller/internal/redis"
+)
+
+const (
+	ControlScopeGlobal = "global"
+
+	ControlPause       = "pause"         // nessuna azione (scale up, scale down, cleanup)
+	ControlNoScaleDown = "no-scale-down" // solo scale up, nessun draining/distruzione
+	ControlPin         = "pin"           // tier bloccato a N nodi attivi
+	ControlProfile     = "profile"       // profilo dei nodi creati dallo scale up
+
+	DefaultControlTTL = 1 * time.Hour
+	MaxControlTTL     = 24 * time.Hour // Un freeze dimenticato non dura per sempre
+)
+
+var (
+	ErrInvalidControlScope = errors.New("invalid control scope")
+	ErrInvalidControlKind  = errors.New("invalid control kind")
+	ErrInvalidPinSize      = errors.New("pin size must be greater than zero")
+	ErrInvalidProfile      = errors.New("invalid profile control")
+)
+
+var (
+	controlScopes = []string{ControlScopeGlobal, "injection", "relay", "egress"}
+	controlKinds  = []string{ControlPause, ControlNoScaleDown, ControlPin, ControlProfile}
+)
+
+// TierControls è la vista effettiva dei controlli per un tier (globali + specifici)
+type TierControls struct {
+	Paused            bool
+	ScaleDownDisabled bool
+	PinnedSize        int    // 0 = nessun pin
+	Profile           string // "" = profilo configurato per il tier
+}
+
+// SetControl attiva un controllo manuale per uno scope con scadenza
+// size vale solo per pin, profile solo per profile (su global deve esistere per tutti i tier)
+func (job *AutoscalerJob) SetControl(ctx context.Context, scope, kind string, size int, profile string, ttl time.Duration, reason string) (*redis.ScalingControl, error) {
+	if !isValidControl(controlScopes, scope) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidControlScope, scope)
+	}
+	if !isValidControl(controlKinds, kind) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidControlKind, kind)
+	}
+	// Il pin ha senso solo su un tier specifico
+	if kind == ControlPin {
+		if scope == ControlScopeGlobal {
+			return nil, fmt.Errorf("%w: pin requires a tier", ErrInvalidControlScope)
+		}
+		if size <= 0 {
+			return nil, ErrInvalidPinSize
+		}
+	} else {
+		size = 0
+	}
+	if kind == ControlProfile {
+		if profile == "" {
+			return nil, fmt.Errorf("%w: profile is required", ErrInvalidProfile)
+		}
+		for _, tier := range controlScopes[1:] {
+			if scope != ControlScopeGlobal && scope != tier {
+				continue
+			}
+			if _, err := domain.LookupProfile(profile, tierNodeType(tier)); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+			}
+		}
+	} else {
+		profile = ""
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultControlTTL
+	}
+	if ttl > MaxControlTTL {
+		ttl = MaxControlTTL
+	}
+
+	control := &redis.ScalingControl{
+		Scope:   scope,
+		Kind:    kind,
+		Size:    size,
+		Profile: profile,
+		Reason:  reason,
+	}
+	if err := job.redis.SetScalingControl(ctx, control, ttl); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Autoscaler] Control %s set on %s (size: %d, profile: %q, ttl: %v, reason: %q)", kind, scope, size, profile, ttl, reason)
+	return control, nil
+}
+
+// ClearControl rimuove un controllo manuale
+func (job *AutoscalerJob) ClearControl(ctx context.Context, scope, kind string) error {
+	if !isValidControl(controlScopes, scope) {
+		return fmt.Errorf("%w: %s", ErrInvalidControlScope, scope)
+	}
+	if !isValidControl(controlKinds, kind) {
+		return fmt.Errorf("%w: %s", ErrInvalidControlKind, kind)
+	}
+
+	log.Printf("[Autoscaler] Control %s cleared on %s", kind, scope)
+	return job.redis.DeleteScalingControl(ctx, scope, kind)
+}
+
+// ListControls ritorna tutti i controlli ancora validi
+func (job *AutoscalerJob) ListControls(ctx context.Context) ([]*redis.ScalingControl, error) {
+	return job.redis.GetScalingControls(ctx, controlScopes, controlKinds)
+}
+
+// loadControls costruisce la vista effettiva per ogni tier
+// In caso di errore Redis restituisce controlli vuoti (comportamento standard)
+func (job *AutoscalerJob) loadControls(ctx context.Context) map[string]TierControls {
+	result := map[string]TierControls{
+		"injection": {},
+		"relay":     {},
+		"egress":    {},
+	}
+
+	controls, err := job.ListControls(ctx)
+	if err != nil {
+		log.Printf("[WARN] Failed to load autoscaler controls: %v", err)
+		return result
+	}
+
+	for _, control := range controls {
+		for tier, tc := range result {
+			if control.Scope != ControlScopeGlobal && control.Scope != tier {
+				continue
+			}
+			switch control.Kind {
+			case ControlPause:
+				tc.Paused = true
+			case ControlNoScaleDown:
+				tc.ScaleDownDisabled = true
+			case ControlPin:
+				tc.PinnedSize = control.Size
+			case ControlProfile:
+				// Il profilo del tier prevale su quello globale
+				if control.Scope == tier || tc.Profile == "" {
+					tc.Profile = control.Profile
+				}
+			}
+			result[tier] = tc
+		}
+	}
+
+	return result
+}
+
+// enforcePinnedSize porta il tier esattamente a N nodi attivi
+func (job *AutoscalerJob) enforcePinnedSize(ctx context.Context, snapshot *redis.ClusterSnapshot, tier string, controls TierControls) {
+	active := countActiveNodes(snapshot, tier)
+
+	switch {
+	case active < controls.PinnedSize:
+		if job.tryReactivateNode(ctx, snapshot, tier) {
+			log.Printf("[Autoscaler-%s] Pinned to %d (active: %d): reactivated draining node", tier, controls.PinnedSize, active)
+			return
+		}
+		if job.tryAcquireLock(ctx, tier) {
+			log.Printf("[Autoscaler-%s] Pinned to %d (active: %d): scaling UP", tier, controls.PinnedSize, active)
+			go job.provisioner.ScaleUp(context.Background(), tierNodeType(tier), controls.Profile)
+		}
+	case active > controls.PinnedSize && !controls.ScaleDownDisabled:
+		log.Printf("[Autoscaler-%s] Pinned to %d (active: %d): draining one node", tier, controls.PinnedSize, active)
+		job.markVictimForDraining(ctx, snapshot, tier)
+	}
+}
+
+// countActiveNodes conta i nodi attivi e gestibili di un tier (esclusi i relay root)
+func countActiveNodes(snapshot *redis.ClusterSnapshot, tier string) int {
+	count := 0
+	for _, node := range snapshot.Pool(tier) {
+		if !node.IsActive() || node.Info.Role == "root" {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+func isValidControl(allowed []string, value string) bool {
+	for _, v := range allowed {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,64 +1,67 @@
 package autoscaler
 
 import (
-	"context"
+	"controller/internal/domain"
 	"controller/internal/redis"
-	"fmt"
-	"strconv"
+	"time"
 )
 
-const (
-	EgressJanusCpuThreshold = 80.0
-	EgressMaxViewers        = 10 // Valore di test
-)
+const EgressJanusCpuThreshold = 80.0
 
 type EgressPoolReport struct {
 	TotalNodes          int
+	StandbyNodes        int // Nodi warm standby, fuori dal pool selezionabile
 	SaturatedNodesCount int
 	TotalViewers        int
 	TotalFreeSlots      int
 	AvgHardwareLoad     float64
+
+	// Segnali smussati e previsione sul lead time di provisioning
+	SmoothedHardwareLoad float64
+	SmoothedViewers      float64
+	ForecastViewers      float64
+	ForecastFreeSlots    float64
+	DemandTrend          float64 // Viewer al secondo
+	Overloaded           bool
+	Underloaded          bool
 }
 
 type EgressLoadCalculator struct {
-	redis *redis.Client
+	signals *TierSignals
 }
 
-func NewEgressLoadCalculator(redisClient *redis.Client) *EgressLoadCalculator {
-	return &EgressLoadCalculator{redis: redisClient}
+func NewEgressLoadCalculator() *EgressLoadCalculator {
+	return &EgressLoadCalculator{
+		signals: newTierSignals(),
+	}
 }
 
-func (calc *EgressLoadCalculator) GetPoolReport(ctx context.Context) (*EgressPoolReport, error) {
-	nodeIds, err := calc.redis.GetNodePool(ctx, "egress")
-	if err != nil {
-		return nil, err
-	}
+func (calc *EgressLoadCalculator) GetPoolReport(snapshot *redis.ClusterSnapshot) (*EgressPoolReport, error) {
+	pool := snapshot.Pool("egress")
 
-	report := &EgressPoolReport{TotalNodes: len(nodeIds)}
+	report := &EgressPoolReport{TotalNodes: len(pool)}
+	report.StandbyNodes = snapshot.StandbyCount("egress")
 	var totalHardwareLoad float64
 
-	for _, id := range nodeIds {
-		status, _ := calc.redis.GetNodeStatus(ctx, id)
-		if status != "active" {
+	for _, node := range pool {
+		if !node.IsActive() {
 			continue
 		}
 		// Hardware Load
-		cpuJanus, _ := calc.redis.GetNodeCPUPercent(ctx, id, "janusStreaming")
-		hwLoad := (cpuJanus / EgressJanusCpuThreshold) * 100.0
+		hwLoad := calc.HardwareLoad(node)
 		totalHardwareLoad += hwLoad
 
 		// Logic Load
-		key := fmt.Sprintf("metrics:node:%s:janusStreaming", id)
-		metrics, _ := calc.redis.HGetAll(ctx, key)
-		viewers, _ := strconv.Atoi(metrics["janusTotalViewers"])
+		viewers := EgressViewers(node)
+		maxViewers := EgressMaxViewers(node)
 		report.TotalViewers += viewers
 
 		// Un nodo è saturo (soglia di allerta) se ha viewers >= 80% o CPU > 80%
-		if viewers >= (EgressMaxViewers*0.8) || hwLoad >= 100.0 {
+		if float64(viewers) >= float64(maxViewers)*0.8 || hwLoad >= 100.0 {
 			report.SaturatedNodesCount++
 		}
 		if hwLoad < 100.0 {
-			free := EgressMaxViewers - viewers
+			free := maxViewers - viewers
 			if free > 0 {
 				report.TotalFreeSlots += free
 			}
@@ -69,20 +72,43 @@ func (calc *EgressLoadCalculator) GetPoolReport(ctx context.Context) (*EgressPoo
 		report.AvgHardwareLoad = totalHardwareLoad / float64(report.TotalNodes)
 	}
 
+	signals := calc.signals.observe(time.Now(), report.AvgHardwareLoad, float64(report.TotalViewers))
+	report.SmoothedHardwareLoad = signals.smoothedLoad
+	report.SmoothedViewers = signals.smoothedDemand
+	report.ForecastViewers = signals.forecastDemand
+	report.DemandTrend = signals.demandTrend
+	report.Overloaded = signals.overloaded
+	report.Underloaded = signals.underloaded
+	report.ForecastFreeSlots = forecastAvailable(report.TotalFreeSlots, report.TotalViewers, signals.forecastDemand)
+
 	return report, nil
 }
 
-func (calc *EgressLoadCalculator) IsNodeSaturated(ctx context.Context, nodeId string) bool {
+// HardwareLoad carico del Janus streaming normalizzato sulla soglia
+func (calc *EgressLoadCalculator) HardwareLoad(node *redis.ClusterNode) float64 {
+	return node.CPUPercent("janusStreaming") / EgressJanusCpuThreshold * 100.0
+}
+
+func (calc *EgressLoadCalculator) IsNodeSaturated(node *redis.ClusterNode) bool {
 	// Check Hardware
-	cpuJanus, _ := calc.redis.GetNodeCPUPercent(ctx, nodeId, "janusStreaming")
-	if (cpuJanus / EgressJanusCpuThreshold * 100.0) >= 100.0 {
+	if calc.HardwareLoad(node) >= 100.0 {
 		return true
 	}
 
 	// Check Slots (limite fisico)
-	key := fmt.Sprintf("metrics:node:%s:janusStreaming", nodeId)
-	val, _ := calc.redis.HGet(ctx, key, "janusTotalViewers")
-	viewers, _ := strconv.Atoi(val)
+	return EgressViewers(node) >= EgressMaxViewers(node)
+}
 
-	return viewers >= EgressMaxViewers
+// EgressViewers numero di viewer serviti dall'egress
+func EgressViewers(node *redis.ClusterNode) int {
+	return int(node.Metric("janusStreaming", "janusTotalViewers"))
+}
+
+// EgressMaxViewers viewer massimi dell'egress secondo il suo profilo
+// Nodi salvati senza capacità: quella del profilo (o di quello di default)
+func EgressMaxViewers(node *redis.ClusterNode) int {
+	if node.Info.MaxViewers > 0 {
+		return node.Info.MaxViewers
+	}
+	return domain.ProfileFor(node.Info.Profile, domain.NodeTypeEgress).MaxViewers
 }
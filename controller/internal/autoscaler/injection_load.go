@@ -1,8 +1,8 @@
 package autoscaler
 
 import (
-	"context"
 	"math"
+	"time"
 
 	"controller/internal/redis"
 )
@@ -16,73 +16,55 @@ type InjectionPoolReport struct {
 	TotalAvailableSlots int     // Somma degli slot liberi
 	AvgHardwareLoad     float64 // Media carico della coppia Injection + Root
 	TotalNodes          int
+	StandbyNodes        int // Nodi warm standby, fuori dal pool selezionabile
+	UsedSlots           int // Sessioni attive sui nodi attivi
+
+	// Segnali smussati e previsione sul lead time di provisioning
+	SmoothedHardwareLoad   float64
+	ForecastUsedSlots      float64
+	ForecastAvailableSlots float64
+	DemandTrend            float64 // Sessioni al secondo
+	Overloaded             bool    // Banda di isteresi sul carico hardware
+	Underloaded            bool
 }
 
 type InjectionLoadCalculator struct {
-	redis     *redis.Client
 	relayCalc *RelayLoadCalculator
+	signals   *TierSignals
 }
 
-func NewInjectionLoadCalculator(redisClient *redis.Client) *InjectionLoadCalculator {
+func NewInjectionLoadCalculator() *InjectionLoadCalculator {
 	return &InjectionLoadCalculator{
-		redis:     redisClient,
-		relayCalc: NewRelayLoadCalculator(redisClient),
+		relayCalc: NewRelayLoadCalculator(),
+		signals:   newTierSignals(),
 	}
 }
 
 // GetPoolReport analizza tutti i nodi injection nel sistema
-func (calc *InjectionLoadCalculator) GetPoolReport(ctx context.Context) (*InjectionPoolReport, error) {
-	// Recupera tutti i nodi dal pool injection
-	nodeIds, err := calc.redis.GetNodePool(ctx, "injection")
-	if err != nil {
-		return nil, err
-	}
-
-	report := &InjectionPoolReport{
-		TotalNodes: len(nodeIds),
-	}
+func (calc *InjectionLoadCalculator) GetPoolReport(snapshot *redis.ClusterSnapshot) (*InjectionPoolReport, error) {
+	report := &InjectionPoolReport{}
 	var totalHardwareLoad float64
+	report.StandbyNodes = snapshot.StandbyCount("injection")
 
-	for _, id := range nodeIds {
-
-		status, _ := calc.redis.GetNodeStatus(ctx, id)
-		if status != "active" {
+	// Tutti i nodi del pool injection
+	for _, node := range snapshot.Pool("injection") {
+		if !node.IsActive() {
 			continue
 		}
 		report.TotalNodes++
 
-		// Info Provisioning (MaxSlots)
-		nodeInfo, err := calc.redis.GetNodeProvisioning(ctx, id)
-		if err != nil {
-			continue
-		}
-
 		// Carico Logico (UsedSlots)
-		score, _ := calc.redis.ZScore(ctx, "pool:injection:load", id)
-		usedSlots := int(score)
-
-		// Carico Fisico della Coppia
-		cpuNode, _ := calc.redis.GetNodeCPUPercent(ctx, id, "nodejs")
-		cpuJanus, _ := calc.redis.GetNodeCPUPercent(ctx, id, "janusVideoroom")
-
-		// Normalizziamo il carico
-		injHardware := math.Max(cpuNode, cpuJanus) / InjectionCpuThreshold * 100.0
-
-		// Salute del RelayRoot associato
-		var rootHardware float64
-		children, _ := calc.redis.GetNodeChildren(ctx, id)
-		if len(children) > 0 {
-			// Passiamo il primo figlio
-			rootHardware, _ = calc.relayCalc.CalculateRelayLoad(ctx, children[0])
-		}
+		usedSlots := int(node.Load)
+		report.UsedSlots += usedSlots
 
-		maxHardware := math.Max(injHardware, rootHardware)
+		// Carico Fisico della Coppia (Injection + RelayRoot)
+		maxHardware := calc.pairHardwareLoad(snapshot, node)
 		totalHardwareLoad += maxHardware
 
 		//  Calcolo Slot Effettivi
 		// Se la coppia è fisicamente satura (maxHardware >= 100), ignoriamo i suoi slot liberi
 		if maxHardware < 100.0 {
-			available := nodeInfo.MaxSlots - usedSlots
+			available := node.Info.MaxSlots - usedSlots
 			if available > 0 {
 				report.TotalAvailableSlots += available
 			}
@@ -93,21 +75,48 @@ func (calc *InjectionLoadCalculator) GetPoolReport(ctx context.Context) (*Inject
 		report.AvgHardwareLoad = totalHardwareLoad / float64(report.TotalNodes)
 	}
 
+	// Serie temporali: la domanda è il numero di sessioni
+	signals := calc.signals.observe(time.Now(), report.AvgHardwareLoad, float64(report.UsedSlots))
+	report.SmoothedHardwareLoad = signals.smoothedLoad
+	report.ForecastUsedSlots = signals.forecastDemand
+	report.DemandTrend = signals.demandTrend
+	report.Overloaded = signals.overloaded
+	report.Underloaded = signals.underloaded
+	report.ForecastAvailableSlots = forecastAvailable(report.TotalAvailableSlots, report.UsedSlots, signals.forecastDemand)
+
 	return report, nil
 }
 
-func (calc *InjectionLoadCalculator) IsNodeHealthy(ctx context.Context, injectionId string) bool {
+// forecastAvailable sottrae alla capacità libera la crescita prevista della domanda
+// forecastUsed = used + max(0, trend) * lead, quindi la crescita non è mai negativa
+func forecastAvailable(available, used int, forecastUsed float64) float64 {
+	growth := math.Max(0, forecastUsed-float64(used))
+	return float64(available) - growth
+}
+
+func (calc *InjectionLoadCalculator) IsNodeHealthy(snapshot *redis.ClusterSnapshot, injectionId string) bool {
+	node := snapshot.Node(injectionId)
+	if node == nil {
+		return false
+	}
+
+	// Se il carico hardware della coppia è >= 100, il nodo non è sano per nuove sessioni
+	return calc.pairHardwareLoad(snapshot, node) < 100.0
+}
 
-	cpuNode, _ := calc.redis.GetNodeCPUPercent(ctx, injectionId, "nodejs")
-	cpuJanus, _ := calc.redis.GetNodeCPUPercent(ctx, injectionId, "janusVideoroom")
+// pairHardwareLoad carico fisico normalizzato della coppia Injection + RelayRoot
+func (calc *InjectionLoadCalculator) pairHardwareLoad(snapshot *redis.ClusterSnapshot, node *redis.ClusterNode) float64 {
+	cpuNode := node.CPUPercent("nodejs")
+	cpuJanus := node.CPUPercent("janusVideoroom")
 	injHardware := math.Max(cpuNode, cpuJanus) / InjectionCpuThreshold * 100.0
 
+	// Salute del RelayRoot associato (primo figlio)
 	var rootHardware float64
-	children, _ := calc.redis.GetNodeChildren(ctx, injectionId)
-	if len(children) > 0 {
-		rootHardware, _ = calc.relayCalc.CalculateRelayLoad(ctx, children[0])
+	if len(node.Children) > 0 {
+		if root := snapshot.Node(node.Children[0]); root != nil {
+			rootHardware = calc.relayCalc.CalculateRelayLoad(root)
+		}
 	}
 
-	// Se il carico hardware della coppia è >= 100, il nodo non è sano per nuove sessioni
-	return math.Max(injHardware, rootHardware) < 100.0
+	return math.Max(injHardware, rootHardware)
 }
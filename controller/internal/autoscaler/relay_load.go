@@ -1,10 +1,10 @@
 package autoscaler
 
 import (
-	"context"
-	"fmt"
 	"math"
+	"time"
 
+	"controller/internal/domain"
 	"controller/internal/redis"
 )
 
@@ -16,67 +16,65 @@ const (
 // StandalonePoolReport fornisce i dati aggregati per decidere lo scaling
 type StandalonePoolReport struct {
 	TotalNodes        int
+	StandbyNodes      int     // Nodi warm standby, fuori dal pool selezionabile
 	SpareNodes        int     // Quanti hanno Score == 0
 	NodesForDeepening int     // Quanti hanno spazio per un nuovo salto (almeno 2 slot liberi)
 	AvgHardwareLoad   float64 // Media carico fisico (CPU/Code) del pool
+	UsedSlots         int     // Slot occupati sui relay standalone attivi
+	FreeSlots         int     // Slot liberi sui relay standalone attivi
+
+	// Segnali smussati e previsione sul lead time di provisioning
+	SmoothedHardwareLoad float64
+	ForecastUsedSlots    float64
+	ForecastFreeSlots    float64
+	DemandTrend          float64 // Slot al secondo
+	Overloaded           bool
+	Underloaded          bool
 }
 
 type RelayLoadCalculator struct {
-	redis *redis.Client
+	signals *TierSignals
 }
 
-func NewRelayLoadCalculator(redisClient *redis.Client) *RelayLoadCalculator {
-	return &RelayLoadCalculator{redis: redisClient}
+func NewRelayLoadCalculator() *RelayLoadCalculator {
+	return &RelayLoadCalculator{
+		signals: newTierSignals(),
+	}
 }
 
-// determina la salute hardware di un Relay
-func (calc *RelayLoadCalculator) CalculateRelayLoad(ctx context.Context, relayId string) (float64, error) {
+// CalculateRelayLoad determina la salute hardware di un Relay
+func (calc *RelayLoadCalculator) CalculateRelayLoad(node *redis.ClusterNode) float64 {
 
 	// CPU del processo Nodejs/C
-	cpuRelay, err := calc.redis.GetNodeCPUPercent(ctx, relayId, "nodejs")
-	if err != nil {
-		cpuRelay = 0
-	}
+	cpuRelay := node.CPUPercent("nodejs")
 
 	// Latenza Code GStreamer
-	queueKey := fmt.Sprintf("metrics:node:%s:gstreamer", relayId)
-	metrics, _ := calc.redis.HGetAll(ctx, queueKey)
-
-	var queueAudio, queueVideo float64
-	fmt.Sscanf(metrics["maxAudioQueueMs"], "%f", &queueAudio)
-	fmt.Sscanf(metrics["maxVideoQueueMs"], "%f", &queueVideo)
+	queueAudio := node.Metric("gstreamer", "maxAudioQueueMs")
+	queueVideo := node.Metric("gstreamer", "maxVideoQueueMs")
 	maxQueue := math.Max(queueAudio, queueVideo)
 
 	loadCPU := (cpuRelay / RelayCpuThreshold) * 100.0
 	loadQueue := (maxQueue / RelayMaxQueueThresholdMs) * 100.0
 
 	// Il carico fisico è il peggiore dei due fattori
-	return math.Max(loadCPU, loadQueue), nil
+	return math.Max(loadCPU, loadQueue)
 }
 
 // GetStandalonePoolReport analizza il pool dei relay per decidere lo scaling
-func (calc *RelayLoadCalculator) GetStandalonePoolReport(ctx context.Context) (*StandalonePoolReport, error) {
-
-	// Prendiamo tutti i relay dal ZSET dei carichi
-	relays, err := calc.redis.GetRedisClient().ZRangeWithScores(ctx, "pool:relay:load", 0, -1).Result()
-	if err != nil {
-		return nil, err
-	}
-
+func (calc *RelayLoadCalculator) GetStandalonePoolReport(snapshot *redis.ClusterSnapshot) (*StandalonePoolReport, error) {
 	report := &StandalonePoolReport{}
+	report.StandbyNodes = snapshot.StandbyCount("relay")
 	var totalHardwareLoad float64
 
-	for _, r := range relays {
-		nodeId := r.Member.(string)
-		status, _ := calc.redis.GetNodeStatus(ctx, nodeId)
-		if status != "active" {
+	// Tutti i relay presenti nel ZSET dei carichi
+	for _, node := range snapshot.Nodes {
+		if node.Info.NodeType != domain.NodeTypeRelay || !node.HasLoad || !node.IsActive() {
 			continue
 		}
-		score := r.Score
+		score := node.Load
 
 		// Recuperiamo il ruolo
-		nodeInfo, err := calc.redis.GetNodeProvisioning(ctx, nodeId)
-		if err != nil || nodeInfo.Role != "standalone" {
+		if node.Info.Role != "standalone" {
 			continue
 		}
 		report.TotalNodes++
@@ -88,13 +86,17 @@ func (calc *RelayLoadCalculator) GetStandalonePoolReport(ctx context.Context) (*
 		}
 
 		// Un nodo è buono per il Deepening se ha almeno 2 slot liberi
-		if (float64(nodeInfo.MaxSlots) - score) >= 2 {
+		if (float64(node.Info.MaxSlots) - score) >= 2 {
 			report.NodesForDeepening++
 		}
 
+		report.UsedSlots += int(score)
+		if free := node.Info.MaxSlots - int(score); free > 0 {
+			report.FreeSlots += free
+		}
+
 		// Analisi hardware
-		hwLoad, _ := calc.CalculateRelayLoad(ctx, nodeId)
-		totalHardwareLoad += hwLoad
+		totalHardwareLoad += calc.CalculateRelayLoad(node)
 
 	}
 
@@ -102,5 +104,13 @@ func (calc *RelayLoadCalculator) GetStandalonePoolReport(ctx context.Context) (*
 		report.AvgHardwareLoad = totalHardwareLoad / float64(report.TotalNodes)
 	}
 
+	signals := calc.signals.observe(time.Now(), report.AvgHardwareLoad, float64(report.UsedSlots))
+	report.SmoothedHardwareLoad = signals.smoothedLoad
+	report.ForecastUsedSlots = signals.forecastDemand
+	report.DemandTrend = signals.demandTrend
+	report.Overloaded = signals.overloaded
+	report.Underloaded = signals.underloaded
+	report.ForecastFreeSlots = forecastAvailable(report.FreeSlots, report.UsedSlots, signals.forecastDemand)
+
 	return report, nil
 }
@@ -0,0 +1,67 @@
+package autoscaler
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	ShortageQueueSize = 64
+	ShortageTimeout   = 10 * time.Second
+)
+
+// CapacityShortage segnala che una selezione del NodeSelector è fallita per mancanza di capacità
+type CapacityShortage struct {
+	Tier      string // injection, relay, egress
+	SessionId string
+	Reason    string
+	At        time.Time
+}
+
+// NotifyShortage accoda un segnale di carenza senza bloccare il chiamante
+// Se la coda è piena il segnale viene scartato: ci penserà il tick periodico
+func (job *AutoscalerJob) NotifyShortage(shortage CapacityShortage) {
+	if shortage.At.IsZero() {
+		shortage.At = time.Now()
+	}
+
+	select {
+	case job.shortages <- shortage:
+	default:
+		log.Printf("[Autoscaler] Shortage queue full, dropping %s signal for session %s", shortage.Tier, shortage.SessionId)
+	}
+}
+
+// handleShortage reagisce subito a una carenza sul tier indicato
+// Rispetta controlli manuali e cooldown (stesso lock del tick)
+func (job *AutoscalerJob) handleShortage(ctx context.Context, shortage CapacityShortage) {
+	controls := job.loadControls(ctx)
+	tc, ok := controls[shortage.Tier]
+	if !ok {
+		return
+	}
+
+	if tc.Paused {
+		log.Printf("[Autoscaler-%s] Shortage ignored: tier paused", shortage.Tier)
+		return
+	}
+	if tc.PinnedSize > 0 {
+		log.Printf("[Autoscaler-%s] Shortage ignored: tier pinned to %d nodes", shortage.Tier, tc.PinnedSize)
+		return
+	}
+
+	log.Printf("[Autoscaler-%s] Capacity shortage (session: %s, reason: %s)", shortage.Tier, shortage.SessionId, shortage.Reason)
+
+	// Prima proviamo a recuperare un nodo in draining: è immediato
+	snapshot, err := job.redis.GetClusterSnapshot(ctx)
+	if err == nil && job.tryReactivateNode(ctx, snapshot, shortage.Tier) {
+		log.Printf("[Autoscaler-%s] Reactivated draining node on shortage", shortage.Tier)
+		return
+	}
+
+	if job.tryAcquireLock(ctx, shortage.Tier) {
+		log.Printf("[Autoscaler-%s] Scaling UP on shortage", shortage.Tier)
+		go job.provisioner.ScaleUp(context.Background(), tierNodeType(shortage.Tier), tc.Profile)
+	}
+}
@@ -0,0 +1,202 @@
+package autoscaler
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	SignalWindowSize     = 15                // Campioni tenuti in memoria (~5 minuti a 20s)
+	SignalEWMAAlpha      = 0.3               // Peso del campione più recente
+	SignalMinSpacing     = 5 * time.Second   // Campioni più ravvicinati sovrascrivono l'ultimo
+	ProvisioningLeadTime = 120 * time.Second // Tempo massimo perché un nuovo pod sia pronto
+)
+
+type signalSample struct {
+	at    time.Time
+	value float64
+}
+
+// SignalSeries mantiene una breve serie temporale di un segnale con smoothing EWMA
+// e stima del trend (regressione lineare sui campioni della finestra)
+type SignalSeries struct {
+	mu          sync.Mutex
+	samples     []signalSample
+	ewma        float64
+	prevEwma    float64 // EWMA prima dell'ultimo campione (per sostituirlo)
+	initialized bool
+	window      int
+	alpha       float64
+}
+
+func NewSignalSeries(window int, alpha float64) *SignalSeries {
+	return &SignalSeries{
+		samples: make([]signalSample, 0, window),
+		window:  window,
+		alpha:   alpha,
+	}
+}
+
+// Observe registra un nuovo campione
+// Un campione troppo vicino al precedente lo sostituisce, anche nell'EWMA:
+// letture ravvicinate (es. report chiesto due volte nello stesso tick) non pesano doppio né falsano il trend
+func (s *SignalSeries) Observe(at time.Time, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n := len(s.samples); n > 0 && at.Sub(s.samples[n-1].at) < SignalMinSpacing {
+		s.samples[n-1] = signalSample{at: at, value: value}
+		if n == 1 {
+			s.ewma = value
+		} else {
+			s.ewma = s.alpha*value + (1-s.alpha)*s.prevEwma
+		}
+		return
+	}
+
+	s.prevEwma = s.ewma
+	if !s.initialized {
+		s.ewma = value
+		s.initialized = true
+	} else {
+		s.ewma = s.alpha*value + (1-s.alpha)*s.ewma
+	}
+
+	s.samples = append(s.samples, signalSample{at: at, value: value})
+	if len(s.samples) > s.window {
+		s.samples = s.samples[len(s.samples)-s.window:]
+	}
+}
+
+// Smoothed ritorna il valore EWMA corrente
+func (s *SignalSeries) Smoothed() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ewma
+}
+
+// Trend ritorna la pendenza del segnale in unità al secondo
+func (s *SignalSeries) Trend() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trendLocked()
+}
+
+// Forecast stima il valore del segnale tra lead partendo dal valore attuale
+// Il trend negativo viene ignorato: per lo scale up interessa solo la crescita.
+// Non si parte dall'EWMA: con domanda in calo resta sopra il valore attuale e simulerebbe crescita
+func (s *SignalSeries) Forecast(current float64, lead time.Duration) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trend := s.trendLocked()
+	if trend < 0 {
+		trend = 0
+	}
+	return current + trend*lead.Seconds()
+}
+
+// minimi quadrati su (secondi dal primo campione, valore)
+func (s *SignalSeries) trendLocked() float64 {
+	n := len(s.samples)
+	if n < 3 {
+		return 0
+	}
+
+	origin := s.samples[0].at
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range s.samples {
+		x := sample.at.Sub(origin).Seconds()
+		sumX += x
+		sumY += sample.value
+		sumXY += x * sample.value
+		sumXX += x * x
+	}
+
+	fn := float64(n)
+	denominator := fn*sumXX - sumX*sumX
+	if math.Abs(denominator) < 1e-9 {
+		return 0
+	}
+	return (fn*sumXY - sumX*sumY) / denominator
+}
+
+// HysteresisBand evita il flapping: lo stato passa ad "alto" sopra Upper
+// e torna "basso" solo sotto Lower. Tra le due soglie mantiene lo stato precedente
+type HysteresisBand struct {
+	mu     sync.Mutex
+	Upper  float64
+	Lower  float64
+	active bool
+}
+
+func NewHysteresisBand(lower, upper float64) *HysteresisBand {
+	return &HysteresisBand{Lower: lower, Upper: upper}
+}
+
+// Update valuta il nuovo valore e ritorna lo stato della banda
+func (h *HysteresisBand) Update(value float64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if value >= h.Upper {
+		h.active = true
+	} else if value <= h.Lower {
+		h.active = false
+	}
+	return h.active
+}
+
+// TierSignals raccoglie i segnali di un tier usati dalle decisioni di scaling
+type TierSignals struct {
+	HardwareLoad *SignalSeries // Carico hardware medio normalizzato (0-100+)
+	Demand       *SignalSeries // Domanda logica (slot usati o viewer)
+	Overload     *HysteresisBand
+	Underload    *HysteresisBand
+}
+
+// newTierSignals: overload entra a 100% ed esce sotto 85%,
+// underload entra sotto 20% ed esce sopra 35%
+func newTierSignals() *TierSignals {
+	return &TierSignals{
+		HardwareLoad: NewSignalSeries(SignalWindowSize, SignalEWMAAlpha),
+		Demand:       NewSignalSeries(SignalWindowSize, SignalEWMAAlpha),
+		Overload:     NewHysteresisBand(85.0, 100.0),
+		Underload:    newInvertedBand(20.0, 35.0),
+	}
+}
+
+// newInvertedBand costruisce una banda attiva sui valori bassi
+// (lo stato è attivo sotto enter e si disattiva sopra exit)
+func newInvertedBand(enter, exit float64) *HysteresisBand {
+	// Lavoriamo sul valore negato per riutilizzare la stessa logica
+	return NewHysteresisBand(-exit, -enter)
+}
+
+// signalSnapshot è il risultato di una osservazione
+type signalSnapshot struct {
+	smoothedLoad   float64
+	smoothedDemand float64
+	forecastDemand float64
+	demandTrend    float64
+	overloaded     bool
+	underloaded    bool
+}
+
+// observe registra il campione del tick e calcola i segnali derivati
+func (ts *TierSignals) observe(at time.Time, hardwareLoad, demand float64) signalSnapshot {
+	ts.HardwareLoad.Observe(at, hardwareLoad)
+	ts.Demand.Observe(at, demand)
+
+	smoothedLoad := ts.HardwareLoad.Smoothed()
+
+	return signalSnapshot{
+		smoothedLoad:   smoothedLoad,
+		smoothedDemand: ts.Demand.Smoothed(),
+		forecastDemand: ts.Demand.Forecast(demand, ProvisioningLeadTime),
+		demandTrend:    ts.Demand.Trend(),
+		overloaded:     ts.Overload.Update(smoothedLoad),
+		underloaded:    ts.Underload.Update(-smoothedLoad),
+	}
+}
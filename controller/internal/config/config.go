@@ -12,6 +12,39 @@ type Config struct {
 	RedisPort     int
 	RedisPassword string
 	RedisDB       int
+
+	// Backend dei nodi (docker, k8s, static, local-process) e route opzionali per tier o ruolo (es. "relay=k8s,egress=docker")
+	Provisioner       string
+	ProvisionerRoutes string
+
+	// Nodi warm standby per tier (0 = disabilitato)
+	StandbyInjection int
+	StandbyRelay     int
+	StandbyEgress    int
+
+	// Profilo per tier dei nodi creati da bootstrap, autoscaler e standby (small, medium, large)
+	ProfileInjection string
+	ProfileRelay     string
+	ProfileEgress    string
+
+	// Secondi di attesa della readiness di un nuovo nodo prima del rollback
+	NodeReadyTimeout int
+
+	// Kubernetes: label dei nodi che ospitano injection/egress e ConfigMap con IP e porte
+	K8sAgentSelector  string
+	K8sAgentConfigMap string
+
+	// Kubernetes: nodi come MediaNode riconciliate nei Pod (false = Pod creati direttamente)
+	K8sOperatorMode bool
+
+	// Local-process: checkout del repository, cartella di log e config, eseguibili sull'host
+	LocalMeshDir         string
+	LocalRunDir          string
+	LocalNodeBin         string
+	LocalJanusPrefix     string
+	LocalRelayForwarder  string
+	LocalEgressForwarder string
+	LocalHost            string
 }
 
 func Load() (*Config, error) {
@@ -22,6 +55,31 @@ func Load() (*Config, error) {
 		RedisPort:     getEnvInt("REDIS_PORT", 6379),
 		RedisPassword: getEnv("REDIS_PASSWORD", ""),
 		RedisDB:       getEnvInt("REDIS_DB", 0),
+
+		Provisioner:       getEnv("PROVISIONER", "k8s"),
+		ProvisionerRoutes: getEnv("PROVISIONER_ROUTES", ""),
+
+		StandbyInjection: getEnvInt("STANDBY_INJECTION", 0),
+		StandbyRelay:     getEnvInt("STANDBY_RELAY", 0),
+		StandbyEgress:    getEnvInt("STANDBY_EGRESS", 0),
+
+		ProfileInjection: getEnv("PROFILE_INJECTION", "medium"),
+		ProfileRelay:     getEnv("PROFILE_RELAY", "medium"),
+		ProfileEgress:    getEnv("PROFILE_EGRESS", "medium"),
+
+		NodeReadyTimeout: getEnvInt("NODE_READY_TIMEOUT", 90),
+
+		K8sAgentSelector:  getEnv("K8S_AGENT_SELECTOR", "media-mesh/agent=true"),
+		K8sAgentConfigMap: getEnv("K8S_AGENT_CONFIGMAP", "media-mesh-agents"),
+		K8sOperatorMode:   getEnv("K8S_OPERATOR_MODE", "true") == "true",
+
+		LocalMeshDir:         getEnv("LOCAL_MESH_DIR", ".."),
+		LocalRunDir:          getEnv("LOCAL_RUN_DIR", "/tmp/media-mesh"),
+		LocalNodeBin:         getEnv("LOCAL_NODE_BIN", "node"),
+		LocalJanusPrefix:     getEnv("LOCAL_JANUS_PREFIX", "/opt/janus"),
+		LocalRelayForwarder:  getEnv("LOCAL_RELAY_FORWARDER", ""),
+		LocalEgressForwarder: getEnv("LOCAL_EGRESS_FORWARDER", ""),
+		LocalHost:            getEnv("LOCAL_HOST", "127.0.0.1"),
 	}
 
 	return cfg, nil
@@ -10,13 +10,18 @@ const (
 	NodeTypeEgress    NodeType = "egress"
 )
 
+// BackendStatic nodi registrati dall'esterno: il controller non ne crea né distrugge la macchina
+const BackendStatic = "static"
+
 // NodeSpec è la specifica per creare un nodo
 // Usata dal controller per richiedere provisioning
 type NodeSpec struct {
 	NodeId      string   `json:"nodeId"`
 	RelayRootId string   `json:"relayRootId,omitempty"`
 	NodeType    NodeType `json:"nodeType"`
+	Profile     string   `json:"profile,omitempty"`
 	MaxSlots    int      `json:"maxSlots"`
+	MaxViewers  int      `json:"maxViewers,omitempty"`
 }
 
 // NodeInfo è quello che ritorna il provisioner dopo aver creato un nodo
@@ -26,6 +31,11 @@ type NodeInfo struct {
 	NodeType NodeType `json:"nodeType"`
 	Role     string   `json:"role"`
 	MaxSlots int      `json:"maxSlots" redis:"maxSlots"`
+	// Profilo di risorse (small, medium, large) e viewer massimi per gli egress
+	Profile    string `json:"profile,omitempty"`
+	MaxViewers int    `json:"maxViewers,omitempty"`
+	// Backend che ha creato il nodo (docker, k8s, ...): DestroyNode va allo stesso
+	Backend string `json:"backend,omitempty"`
 	// Container info
 	ContainerId string `json:"containerId"`
 	CreatedAt   int64  `json:"createdAt"`
@@ -56,6 +66,14 @@ type NodeInfo struct {
 	StreamPortEnd   int `json:"streamPortEnd,omitempty" redis:"streamPortEnd"`
 }
 
+// NodeRegistration nodo gestito esternamente registrato con POST /api/nodes/register
+// Host, porte e capacità li dichiara chi registra. NodeId è il NODE_ID del processo già avviato
+type NodeRegistration struct {
+	NodeInfo
+	// Solo injection: il Relay Root che gira accanto all'injection sulla stessa macchina
+	RelayRoot *NodeInfo `json:"relayRoot,omitempty"`
+}
+
 // Helper methods per controlli veloci
 
 func (n *NodeInfo) IsInjection() bool {
@@ -70,6 +88,11 @@ func (n *NodeInfo) IsEgress() bool {
 	return n.NodeType == NodeTypeEgress
 }
 
+// IsExternal nodo gestito fuori dal controller (registrato via API)
+func (n *NodeInfo) IsExternal() bool {
+	return n.Backend == BackendStatic
+}
+
 func (n *NodeInfo) NeedsJanus() bool {
 	return n.IsInjection() || n.IsEgress()
 }
@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profili dei nodi: taglia di container e capacità logica che ne deriva
+const (
+	ProfileSmall  = "small"
+	ProfileMedium = "medium"
+	ProfileLarge  = "large"
+
+	DefaultProfile = ProfileMedium
+)
+
+var ErrUnknownProfile = errors.New("unknown node profile")
+
+// ContainerResources richieste e limiti di un container (quantità Kubernetes: "250m", "512Mi")
+type ContainerResources struct {
+	CPURequest    string `json:"cpuRequest"`
+	CPULimit      string `json:"cpuLimit"`
+	MemoryRequest string `json:"memoryRequest"`
+	MemoryLimit   string `json:"memoryLimit"`
+}
+
+// NodeProfile risorse e capacità di un nodo di un tier
+type NodeProfile struct {
+	Name     string             `json:"name"`
+	NodeType NodeType           `json:"nodeType"`
+	Node     ContainerResources `json:"node"`  // Processo Node.js (anche il Relay Root dell'injection)
+	Janus    ContainerResources `json:"janus"` // Solo injection/egress
+
+	MaxSlots      int `json:"maxSlots,omitempty"`   // Sessioni per injection/relay
+	MaxViewers    int `json:"maxViewers,omitempty"` // Viewer per egress
+	BandwidthMbps int `json:"bandwidthMbps"`        // Budget di banda riservato sull'host
+}
+
+func resources(cpuRequest, memoryRequest, cpuLimit, memoryLimit string) ContainerResources {
+	return ContainerResources{
+		CPURequest:    cpuRequest,
+		CPULimit:      cpuLimit,
+		MemoryRequest: memoryRequest,
+		MemoryLimit:   memoryLimit,
+	}
+}
+
+// nodeProfiles medium corrisponde ai valori storici dei template K8s; small dimezza, large raddoppia
+// Su Docker i container avevano tutti 1 CPU e 512m senza riserva: con medium il nodo e il Janus
+// dell'egress salgono a 1Gi e 768Mi, injection e relay restano a 512Mi (Janus 384Mi)
+var nodeProfiles = map[string]map[NodeType]NodeProfile{
+	ProfileSmall: {
+		NodeTypeInjection: {
+			Node:          resources("50m", "64Mi", "500m", "256Mi"),
+			Janus:         resources("50m", "64Mi", "500m", "192Mi"),
+			MaxSlots:      5,
+			BandwidthMbps: 5,
+		},
+		NodeTypeRelay: {
+			Node:     resources("50m", "64Mi", "500m", "256Mi"),
+			MaxSlots: 10,
+		},
+		NodeTypeEgress: {
+			Node:          resources("100m", "128Mi", "500m", "512Mi"),
+			Janus:         resources("100m", "128Mi", "500m", "384Mi"),
+			MaxViewers:    5,
+			BandwidthMbps: 15,
+		},
+	},
+	ProfileMedium: {
+		NodeTypeInjection: {
+			Node:          resources("100m", "128Mi", "1000m", "512Mi"),
+			Janus:         resources("100m", "128Mi", "1000m", "384Mi"),
+			MaxSlots:      10,
+			BandwidthMbps: 10,
+		},
+		NodeTypeRelay: {
+			Node:     resources("100m", "128Mi", "1000m", "512Mi"),
+			MaxSlots: 20,
+		},
+		NodeTypeEgress: {
+			Node:          resources("200m", "256Mi", "1000m", "1Gi"),
+			Janus:         resources("200m", "256Mi", "1000m", "768Mi"),
+			MaxViewers:    10,
+			BandwidthMbps: 30,
+		},
+	},
+	ProfileLarge: {
+		NodeTypeInjection: {
+			Node:          resources("200m", "256Mi", "2000m", "1Gi"),
+			Janus:         resources("200m", "256Mi", "2000m", "768Mi"),
+			MaxSlots:      20,
+			BandwidthMbps: 20,
+		},
+		NodeTypeRelay: {
+			Node:     resources("200m", "256Mi", "2000m", "1Gi"),
+			MaxSlots: 40,
+		},
+		NodeTypeEgress: {
+			Node:          resources("400m", "512Mi", "2000m", "2Gi"),
+			Janus:         resources("400m", "512Mi", "2000m", "1536Mi"),
+			MaxViewers:    20,
+			BandwidthMbps: 60,
+		},
+	},
+}
+
+// LookupProfile profilo di un tier ("" = DefaultProfile)
+func LookupProfile(name string, nodeType NodeType) (NodeProfile, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	tiers, ok := nodeProfiles[name]
+	if !ok {
+		return NodeProfile{}, fmt.Errorf("%w: %q (available: %s)", ErrUnknownProfile, name, strings.Join(ProfileNames(), ", "))
+	}
+	profile, ok := tiers[nodeType]
+	if !ok {
+		return NodeProfile{}, fmt.Errorf("%w: %q has no %s nodes", ErrUnknownProfile, name, nodeType)
+	}
+	profile.Name = name
+	profile.NodeType = nodeType
+	return profile, nil
+}
+
+// ProfileFor come LookupProfile, ma un profilo sconosciuto ricade su DefaultProfile
+// Per nodi già esistenti: la capacità va sempre calcolata
+func ProfileFor(name string, nodeType NodeType) NodeProfile {
+	if profile, err := LookupProfile(name, nodeType); err == nil {
+		return profile
+	}
+	profile, _ := LookupProfile(DefaultProfile, nodeType)
+	return profile
+}
+
+// ProfileNames nomi dei profili disponibili
+func ProfileNames() []string {
+	names := make([]string, 0, len(nodeProfiles))
+	for name := range nodeProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profiles tutti i profili, per nome e tier
+func Profiles() []NodeProfile {
+	var profiles []NodeProfile
+	for _, name := range ProfileNames() {
+		for _, nodeType := range []NodeType{NodeTypeInjection, NodeTypeRelay, NodeTypeEgress} {
+			if profile, err := LookupProfile(name, nodeType); err == nil {
+				profiles = append(profiles, profile)
+			}
+		}
+	}
+	return profiles
+}
@@ -0,0 +1,121 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"controller/internal/domain"
+)
+
+// CompositeProvisioner smista i nodi tra più backend (es. relay su Kubernetes, egress su host statici)
+// La scelta avviene per ruolo, poi per tier, infine il backend di default
+// Ogni NodeInfo registra il backend che lo possiede: distruzione e log vanno a quello
+type CompositeProvisioner struct {
+	defaultBackend string
+	backends       map[string]Provisioner
+	routes         map[string]string // tier o ruolo -> backend
+}
+
+// NewCompositeProvisioner verifica che default e route puntino a backend esistenti
+func NewCompositeProvisioner(defaultBackend string, backends map[string]Provisioner, routes map[string]string) (*CompositeProvisioner, error) {
+	if _, ok := backends[defaultBackend]; !ok {
+		return nil, fmt.Errorf("default provisioner backend %q not configured", defaultBackend)
+	}
+	for key, backend := range routes {
+		if _, ok := backends[backend]; !ok {
+			return nil, fmt.Errorf("route %s=%s: provisioner backend not configured", key, backend)
+		}
+	}
+
+	log.Printf("[Provisioner] Hybrid backend: default %s, routes %v", defaultBackend, routes)
+	return &CompositeProvisioner{
+		defaultBackend: defaultBackend,
+		backends:       backends,
+		routes:         routes,
+	}, nil
+}
+
+// route backend di un nuovo nodo
+func (p *CompositeProvisioner) route(spec domain.NodeSpec, role string) string {
+	if backend, ok := p.routes[role]; ok {
+		return backend
+	}
+	if backend, ok := p.routes[string(spec.NodeType)]; ok {
+		return backend
+	}
+	return p.defaultBackend
+}
+
+// owner backend di un nodo esistente (nodi salvati senza backend: quello di default)
+func (p *CompositeProvisioner) owner(nodeInfo *domain.NodeInfo) (string, Provisioner, error) {
+	name := nodeInfo.Backend
+	if name == "" {
+		name = p.defaultBackend
+	}
+	backend, ok := p.backends[name]
+	if !ok {
+		return name, nil, fmt.Errorf("node %s owned by unknown provisioner backend %q", nodeInfo.NodeId, name)
+	}
+	return name, backend, nil
+}
+
+func (p *CompositeProvisioner) CreateNode(ctx context.Context, spec domain.NodeSpec, role string) (*domain.NodeInfo, error) {
+	name := p.route(spec, role)
+	nodeInfo, err := p.backends[name].CreateNode(ctx, spec, role)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	nodeInfo.Backend = name
+	log.Printf("[Provisioner] %s (%s/%s) provisioned on %s", spec.NodeId, spec.NodeType, role, name)
+	return nodeInfo, nil
+}
+
+func (p *CompositeProvisioner) DestroyNode(ctx context.Context, nodeInfo *domain.NodeInfo) error {
+	name, backend, err := p.owner(nodeInfo)
+	if err != nil {
+		return err
+	}
+	if err := backend.DestroyNode(ctx, nodeInfo); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func (p *CompositeProvisioner) NodeLogs(ctx context.Context, nodeInfo *domain.NodeInfo, opts LogOptions) (io.ReadCloser, error) {
+	_, backend, err := p.owner(nodeInfo)
+	if err != nil {
+		return nil, err
+	}
+	return backend.NodeLogs(ctx, nodeInfo, opts)
+}
+
+// RegisterNode registra un nodo esterno sul backend static
+func (p *CompositeProvisioner) RegisterNode(ctx context.Context, nodeInfo *domain.NodeInfo) error {
+	registrar, ok := p.backends[BackendStatic].(NodeRegistrar)
+	if !ok {
+		return fmt.Errorf("provisioner backend %s not configured", BackendStatic)
+	}
+	return registrar.RegisterNode(ctx, nodeInfo)
+}
+
+// SetNodeEvacuator collega l'evacuazione ai backend che la supportano (Kubernetes)
+func (p *CompositeProvisioner) SetNodeEvacuator(evacuator NodeEvacuator) {
+	for _, backend := range p.backends {
+		if b, ok := backend.(interface{ SetNodeEvacuator(NodeEvacuator) }); ok {
+			b.SetNodeEvacuator(evacuator)
+		}
+	}
+}
+
+func (p *CompositeProvisioner) Close() error {
+	var errs []error
+	for name, backend := range p.backends {
+		if err := backend.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -3,44 +3,126 @@ package provisioner
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
-	"os/exec"
-	"strings"
+	"sync"
 	"time"
 
 	"controller/internal/domain"
 	"controller/internal/redis"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Label dei container media: servono a ricostruire l'inventario dopo un riavvio del controller
+const (
+	labelNodeId        = "media-mesh.nodeId"
+	labelContainerType = "media-mesh.containerType" // nodejs | janus
+	labelNodeType      = "media-mesh.nodeType"
+	labelRole          = "media-mesh.role"
+	labelStreamRange   = "media-mesh.streamRange" // Range RTP interno del Janus streaming (non pubblicato)
 )
 
-// DockerProvisioner gestisce creazione/distruzione container via CLI
+const (
+	containerTypeNode  = "nodejs"
+	containerTypeJanus = "janus"
+
+	dockerStopTimeout    = 10 * time.Second
+	dockerHealthyTimeout = 60 * time.Second
+)
+
+// DockerProvisioner gestisce creazione/distruzione container via Docker Engine API
 type DockerProvisioner struct {
+	docker        *client.Client
 	portAllocator *PortAllocator
 	networkName   string
 	redisClient   *redis.Client
+	stopEvents    context.CancelFunc
+
+	mu       sync.Mutex
+	nodes    map[string]*dockerNode // Inventario: nodeId -> container
+	stopping map[string]time.Time   // Container fermati dal controller: eventi die attesi fino a
 }
 
-// NewDockerProvisioner crea provisioner
+// dockerNode container di un nodo presenti sul daemon
+type dockerNode struct {
+	NodeId     string
+	NodeType   string
+	Role       string
+	Containers map[string]string // containerType -> nome
+	State      string            // Stato del container nodejs
+}
+
+// NewDockerProvisioner crea provisioner e ricostruisce porte e inventario dai container esistenti
 func NewDockerProvisioner(networkName string, redisClient *redis.Client) (*DockerProvisioner, error) {
-	return &DockerProvisioner{
-		portAllocator: NewPortAllocator(),
+	docker, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := docker.Ping(ctx); err != nil {
+		docker.Close()
+		return nil, fmt.Errorf("docker daemon not reachable: %w", err)
+	}
+
+	p := &DockerProvisioner{
+		docker:        docker,
+		portAllocator: HostPortAllocator(),
 		networkName:   networkName,
 		redisClient:   redisClient,
-	}, nil
+		nodes:         make(map[string]*dockerNode),
+		stopping:      make(map[string]time.Time),
+	}
+	if err := p.recoverInventory(ctx); err != nil {
+		docker.Close()
+		return nil, err
+	}
+
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	p.stopEvents = stopEvents
+	go p.watchEvents(eventsCtx)
+	return p, nil
 }
 
 // CreateNode: Smistatore.
 // Riceve una richiesta generica (NodeSpec) e decide quale funzione specifica chiamare
 func (p *DockerProvisioner) CreateNode(ctx context.Context, spec domain.NodeSpec, role string) (*domain.NodeInfo, error) {
+	var (
+		nodeInfo *domain.NodeInfo
+		err      error
+	)
 	switch spec.NodeType {
 	case domain.NodeTypeInjection:
-		return p.createInjectionNode(ctx, spec, role)
+		nodeInfo, err = p.createInjectionNode(ctx, spec, role)
 	case domain.NodeTypeRelay:
-		return p.createRelayNode(ctx, spec,role)
+		nodeInfo, err = p.createRelayNode(ctx, spec, role)
 	case domain.NodeTypeEgress:
-		return p.createEgressNode(ctx, spec,role)
+		nodeInfo, err = p.createEgressNode(ctx, spec, role)
 	default:
 		return nil, fmt.Errorf("unknown node type: %s", spec.NodeType)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	containers := map[string]string{containerTypeNode: spec.NodeId}
+	if nodeInfo.NeedsJanus() {
+		containers[containerTypeJanus] = nodeInfo.JanusHost
+	}
+	p.mu.Lock()
+	p.nodes[spec.NodeId] = &dockerNode{
+		NodeId:     spec.NodeId,
+		NodeType:   string(spec.NodeType),
+		Role:       role,
+		Containers: containers,
+		State:      "running",
+	}
+	p.mu.Unlock()
+	return nodeInfo, nil
 }
 
 // DestroyNode
@@ -60,17 +142,18 @@ func (p *DockerProvisioner) DestroyNode(ctx context.Context, nodeInfo *domain.No
 	if nodeInfo.ContainerId != "" {
 		targetContainer = nodeInfo.ContainerId
 	}
-	// (SIGTERM)
+
+	// Gli eventi die dei container fermati qui non sono guasti
+	p.expectStop(nodeInfo.NodeId)
+
+	// SIGTERM: il nodo si deregistra prima di uscire
 	log.Printf("[INFO] Stopping node %s", nodeInfo.NodeId)
-	if err := p.dockerStop(ctx, targetContainer); err != nil {
+	if err := p.stopContainer(ctx, targetContainer); err != nil {
 		log.Printf("[WARN] Failed to stop %s: %v", targetContainer, err)
 	}
 
-	// Attendi che nodo si unregister (max 3s)
-	time.Sleep(3 * time.Second)
-
 	// Rimuovi container principale
-	if err := p.dockerRemove(ctx, targetContainer); err != nil {
+	if err := p.removeContainer(ctx, targetContainer); err != nil {
 		return fmt.Errorf("failed to remove node container: %w", err)
 	}
 
@@ -78,15 +161,11 @@ func (p *DockerProvisioner) DestroyNode(ctx context.Context, nodeInfo *domain.No
 	if nodeInfo.NeedsJanus() {
 		targetJanus := nodeInfo.JanusContainerId
 		if targetJanus == "" {
-			suffix := "-janus-vr"
-			if nodeInfo.IsEgress() {
-				suffix = "-janus-streaming"
-			}
-			targetJanus = nodeInfo.NodeId + suffix
+			targetJanus = janusContainerName(nodeInfo.NodeId, nodeInfo.IsEgress())
 		}
 		log.Printf("[Provisioner] Stopping Janus %s", targetJanus)
-		p.dockerStop(ctx, targetJanus)
-		p.dockerRemove(ctx, targetJanus)
+		p.stopContainer(ctx, targetJanus)
+		p.removeContainer(ctx, targetJanus)
 	}
 
 	// Cleanup redis
@@ -118,34 +197,241 @@ func (p *DockerProvisioner) DestroyNode(ctx context.Context, nodeInfo *domain.No
 		log.Printf("[WARN] Failed to delete provisioning info: %v", err)
 	}
 
+	p.mu.Lock()
+	delete(p.nodes, nodeInfo.NodeId)
+	p.mu.Unlock()
+
 	log.Printf("[INFO] Node %s destroyed successfully", nodeInfo.NodeId)
 	return nil
 }
 
-// dockerRun esegue docker run e ritorna container ID
-func (p *DockerProvisioner) dockerRun(ctx context.Context, args []string) (string, error) {
-	cmd := exec.CommandContext(ctx, "docker", append([]string{"run"}, args...)...)
-	output, err := cmd.CombinedOutput() // Cattura stdout e stderr
+// recoverInventory legge i container con label media-mesh.nodeId:
+// le porte pubblicate tornano occupate e i nodi senza container (o con container morti) vanno in failed
+// I container senza provisioning (creazione interrotta dal riavvio) vengono rimossi e le porte liberate
+func (p *DockerProvisioner) recoverInventory(ctx context.Context) error {
+	containers, err := p.listMediaContainers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list media containers: %w", err)
+	}
+
+	ports := 0
+	reserved := make(map[string][][2]int) // nodeId -> porte e range riservati
+	for _, c := range containers {
+		nodeId := c.Labels[labelNodeId]
+		info, err := p.docker.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			log.Printf("[WARN] Failed to inspect %s: %v", containerName(c), err)
+			continue
+		}
+		for _, port := range hostPorts(info) {
+			p.portAllocator.MarkAsUsed(port)
+			reserved[nodeId] = append(reserved[nodeId], [2]int{port, port})
+			ports++
+		}
+		if start, end, err := parsePortRange(c.Labels[labelStreamRange]); err == nil {
+			p.portAllocator.MarkRangeAsUsed(start, end)
+			reserved[nodeId] = append(reserved[nodeId], [2]int{start, end})
+		}
+
+		node := p.nodes[nodeId]
+		if node == nil {
+			node = &dockerNode{
+				NodeId:     nodeId,
+				NodeType:   c.Labels[labelNodeType],
+				Role:       c.Labels[labelRole],
+				Containers: make(map[string]string),
+			}
+			p.nodes[nodeId] = node
+		}
+		containerType := firstNonEmpty(c.Labels[labelContainerType], containerTypeNode)
+		node.Containers[containerType] = containerName(c)
+		if containerType == containerTypeNode {
+			node.State = string(c.State)
+		}
+	}
+
+	// Senza l'elenco dei nodi provisionati ogni container sembrerebbe orfano
+	provisioned, err := p.redisClient.GetAllProvisionedNodes(ctx)
 	if err != nil {
-		return "", fmt.Errorf("docker run failed: %w, output: %s", err, string(output))
+		return fmt.Errorf("failed to read provisioned nodes: %w", err)
+	}
+	known := make(map[string]bool, len(provisioned))
+	for _, info := range provisioned {
+		// Nodi di altri backend (provisioner ibrido)
+		if info.Backend != "" && info.Backend != BackendDocker {
+			continue
+		}
+		known[info.NodeId] = true
+		node := p.nodes[info.NodeId]
+		switch {
+		case node == nil:
+			p.markContainerFailed(ctx, info.NodeId, "failed", "no containers found after controller restart")
+		case node.State != "running" && node.State != "restarting":
+			p.markContainerFailed(ctx, info.NodeId, "failed", fmt.Sprintf("container %s", firstNonEmpty(node.State, "missing")))
+		}
+	}
+	for nodeId, node := range p.nodes {
+		if known[nodeId] {
+			continue
+		}
+		log.Printf("[WARN] Containers of %s have no provisioning info, removing them", nodeId)
+		for _, name := range node.Containers {
+			if err := p.removeContainer(ctx, name); err != nil {
+				log.Printf("[WARN] Failed to remove %s: %v", name, err)
+			}
+		}
+		for _, r := range reserved[nodeId] {
+			p.portAllocator.ReleaseRange(r[0], r[1])
+		}
+		delete(p.nodes, nodeId)
 	}
 
-	containerID := strings.TrimSpace(string(output))
-	return containerID, nil
+	log.Printf("[Provisioner] Recovered %d nodes from %d containers (%d host ports)", len(p.nodes), len(containers), ports)
+	return nil
 }
 
-// dockerStop: Esegue "docker stop -t 10" (aspetta 10s prima di killare)
-func (p *DockerProvisioner) dockerStop(ctx context.Context, containerName string) error {
-	cmd := exec.CommandContext(ctx, "docker", "stop", "-t", "10", containerName)
-	_, err := cmd.CombinedOutput()
-	return err
+func (p *DockerProvisioner) markContainerFailed(ctx context.Context, nodeId, cause, reason string) {
+	prev, err := p.redisClient.TransitionNodeStatus(ctx, nodeId, redis.NodeStatusFailed, "docker", reason)
+	if err != nil || prev == redis.NodeStatusFailed {
+		return
+	}
+	log.Printf("[WARN] Node %s failed: %s", nodeId, reason)
+	p.redisClient.PublishNodeFailure(ctx, redis.NodeFailureEvent{
+		Type:     redis.NodeEventFailed,
+		NodeId:   nodeId,
+		Cause:    cause,
+		Reason:   reason,
+		Previous: prev,
+	})
 }
 
-// dockerRemove: Esegue "docker rm -f" (forza rimozione)
-func (p *DockerProvisioner) dockerRemove(ctx context.Context, containerName string) error {
-	cmd := exec.CommandContext(ctx, "docker", "rm", "-f", containerName)
-	_, err := cmd.CombinedOutput()
-	return err
+// baseContainer configurazione comune dei container di un nodo
+// Limiti di CPU e memoria dal profilo del nodo (Docker non ha una richiesta di CPU)
+func (p *DockerProvisioner) baseContainer(spec domain.NodeSpec, role, containerType, name, image string) *containerSpec {
+	profile := domain.ProfileFor(spec.Profile, spec.NodeType)
+	res := profile.Node
+	if containerType == containerTypeJanus {
+		res = profile.Janus
+	}
+
+	return &containerSpec{
+		Config: container.Config{
+			Image:    image,
+			Hostname: name,
+			Labels: map[string]string{
+				labelNodeId:        spec.NodeId,
+				labelContainerType: containerType,
+				labelNodeType:      string(spec.NodeType),
+				labelRole:          role,
+			},
+		},
+		HostConfig: container.HostConfig{
+			NetworkMode: container.NetworkMode(p.networkName),
+			Resources: container.Resources{
+				NanoCPUs:          quantityValue(res.CPULimit, resource.Nano),
+				Memory:            quantityValue(res.MemoryLimit, 0),
+				MemoryReservation: quantityValue(res.MemoryRequest, 0),
+			},
+			RestartPolicy: dockerRestartPolicy,
+		},
+	}
+}
+
+// quantityValue converte una quantità Kubernetes nell'unità richiesta ("500m" in resource.Nano = 5e8 nanoCPU)
+// Quantità non valide: 0, cioè nessun limite
+func quantityValue(value string, scale resource.Scale) int64 {
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0
+	}
+	return q.ScaledValue(scale)
+}
+
+// nodeHealthcheck interroga GET /status dell'API del nodo (node:22 ha fetch)
+func nodeHealthcheck(apiPort int) *container.HealthConfig {
+	script := fmt.Sprintf("fetch('http://localhost:%d/status').then(r=>process.exit(r.ok?0:1)).catch(()=>process.exit(1))", apiPort)
+	return &container.HealthConfig{
+		Test:        []string{"CMD", "node", "-e", script},
+		Interval:    10 * time.Second,
+		Timeout:     3 * time.Second,
+		StartPeriod: 15 * time.Second,
+		Retries:     3,
+	}
+}
+
+// janusHealthcheck interroga /janus/info sul transport HTTP
+func janusHealthcheck() *container.HealthConfig {
+	return &container.HealthConfig{
+		Test:        []string{"CMD", "wget", "-q", "-O", "/dev/null", "http://localhost:8088/janus/info"},
+		Interval:    10 * time.Second,
+		Timeout:     3 * time.Second,
+		StartPeriod: 10 * time.Second,
+		Retries:     3,
+	}
+}
+
+func janusContainerName(nodeId string, egress bool) string {
+	if egress {
+		return nodeId + "-janus-streaming"
+	}
+	return nodeId + "-janus-vr"
+}
+
+// runContainer crea e avvia un container, ritorna l'ID
+func (p *DockerProvisioner) runContainer(ctx context.Context, name string, spec *containerSpec) (string, error) {
+	created, err := p.docker.ContainerCreate(ctx, &spec.Config, &spec.HostConfig, nil, nil, name)
+	if err != nil {
+		return "", fmt.Errorf("docker create %s failed: %w", name, err)
+	}
+	if err := p.docker.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		p.removeContainer(ctx, created.ID)
+		return "", fmt.Errorf("docker start %s failed: %w", name, err)
+	}
+	return created.ID, nil
+}
+
+// removeContainers rimuove i container indicati (rollback)
+func (p *DockerProvisioner) removeContainers(ctx context.Context, names ...string) {
+	for _, name := range names {
+		if err := p.removeContainer(ctx, name); err != nil {
+			log.Printf("[WARN] Failed to remove %s: %v", name, err)
+		}
+	}
+}
+
+// waitHealthy aspetta che l'healthcheck del container passi
+// Un container uscito senza riavvio o unhealthy è un errore
+func (p *DockerProvisioner) waitHealthy(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, dockerHealthyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		info, err := p.docker.ContainerInspect(ctx, id)
+		if err != nil {
+			return err
+		}
+		state := info.State
+		if state == nil {
+			return fmt.Errorf("container %s has no state", id)
+		}
+		if !state.Running && !state.Restarting {
+			return fmt.Errorf("container exited (code %d, oom %v)", state.ExitCode, state.OOMKilled)
+		}
+		if state.Health == nil || state.Health.Status == container.Healthy {
+			return nil
+		}
+		if state.Health.Status == container.Unhealthy {
+			return fmt.Errorf("container unhealthy (%d failed checks)", state.Health.FailingStreak)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("container not healthy after %v", dockerHealthyTimeout)
+		case <-ticker.C:
+		}
+	}
 }
 
 // GetPortAllocator ritorna port allocator
@@ -153,23 +439,55 @@ func (p *DockerProvisioner) GetPortAllocator() *PortAllocator {
 	return p.portAllocator
 }
 
-// Close cleanup
+// Close ferma l'osservazione degli eventi (i container restano in esecuzione)
 func (p *DockerProvisioner) Close() error {
-	return nil
+	p.stopEvents()
+	return p.docker.Close()
 }
 
 func (p *DockerProvisioner) CreateAgent(ctx context.Context) error {
 	log.Println("[Provisioner] Starting Metrics Agent")
 
-	args := []string{
-		"-d",
-		"--name", "metrics-agent",
-		"--network", p.networkName,
-		"--restart", "always",
-		"-v", "/var/run/docker.sock:/var/run/docker.sock",
-		"media-tree/metrics-agent:latest",
+	_, err := p.runContainer(ctx, "metrics-agent", &containerSpec{
+		Config: container.Config{Image: "media-tree/metrics-agent:latest"},
+		HostConfig: container.HostConfig{
+			NetworkMode:   container.NetworkMode(p.networkName),
+			RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyAlways},
+			Binds:         []string{"/var/run/docker.sock:/var/run/docker.sock"},
+		},
+	})
+	return err
+}
+
+// NodeLogs legge i log del container del nodo o del suo Janus tramite l'API
+func (p *DockerProvisioner) NodeLogs(ctx context.Context, nodeInfo *domain.NodeInfo, opts LogOptions) (io.ReadCloser, error) {
+	var target string
+	switch opts.Container {
+	case "", LogContainerNode:
+		target = nodeInfo.ContainerId
+		if target == "" {
+			target = nodeInfo.NodeId
+		}
+	case LogContainerJanus:
+		if !nodeInfo.NeedsJanus() {
+			return nil, ErrUnknownContainer
+		}
+		target = nodeInfo.JanusContainerId
+	default:
+		return nil, ErrUnknownContainer
+	}
+	if target == "" {
+		return nil, ErrUnknownContainer
 	}
 
-	_, err := p.dockerRun(ctx, args)
-	return err
+	stream, err := p.containerLogs(ctx, target, opts)
+	if err != nil {
+		return nil, fmt.Errorf("docker logs failed: %w", err)
+	}
+	return stream, nil
+}
+
+// portRange formato start-end usato nelle label
+func portRange(start, end int) string {
+	return fmt.Sprintf("%d-%d", start, end)
 }
@@ -0,0 +1,149 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+)
+
+// Riavvio automatico dei container media: un crash non richiede il controller
+var dockerRestartPolicy = container.RestartPolicy{Name: container.RestartPolicyOnFailure, MaximumRetryCount: 5}
+
+// containerSpec configurazione di creazione di un container
+type containerSpec struct {
+	container.Config
+	HostConfig container.HostConfig
+}
+
+// newDockerClient usa DOCKER_HOST, DOCKER_API_VERSION e DOCKER_CERT_PATH (default /var/run/docker.sock)
+// La versione dell'API è negoziata con il daemon
+func newDockerClient() (*client.Client, error) {
+	docker, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+	return docker, nil
+}
+
+// publishPorts aggiunge il mapping host:container per una porta o un range (stesse porte)
+func (s *containerSpec) publishPorts(hostStart, containerStart, count int, proto string) {
+	if s.ExposedPorts == nil {
+		s.ExposedPorts = make(nat.PortSet)
+	}
+	if s.HostConfig.PortBindings == nil {
+		s.HostConfig.PortBindings = make(nat.PortMap)
+	}
+	for i := range count {
+		port := nat.Port(fmt.Sprintf("%d/%s", containerStart+i, proto))
+		s.ExposedPorts[port] = struct{}{}
+		s.HostConfig.PortBindings[port] = []nat.PortBinding{{HostPort: strconv.Itoa(hostStart + i)}}
+	}
+}
+
+// listMediaContainers elenca i container (anche fermi) dei nodi media
+func (p *DockerProvisioner) listMediaContainers(ctx context.Context) ([]container.Summary, error) {
+	return p.docker.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", labelNodeId)),
+	})
+}
+
+// hostPorts porte dell'host riservate dal container (anche da fermo)
+func hostPorts(info container.InspectResponse) []int {
+	if info.ContainerJSONBase == nil || info.HostConfig == nil {
+		return nil
+	}
+	var ports []int
+	for _, bindings := range info.HostConfig.PortBindings {
+		for _, b := range bindings {
+			if port, err := strconv.Atoi(b.HostPort); err == nil && port > 0 {
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports
+}
+
+// containerName nome senza la barra iniziale dell'API
+func containerName(c container.Summary) string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// stopContainer invia SIGTERM (SIGKILL dopo dockerStopTimeout) e attende l'uscita del container:
+// il nodo si deregistra da Redis prima di terminare. Container inesistente = nessun errore
+func (p *DockerProvisioner) stopContainer(ctx context.Context, id string) error {
+	waitCtx, cancel := context.WithTimeout(ctx, dockerStopTimeout+5*time.Second)
+	defer cancel()
+
+	// In attesa prima dello stop: l'uscita non può sfuggire
+	exited, waitErr := p.docker.ContainerWait(waitCtx, id, container.WaitConditionNotRunning)
+
+	timeout := int(dockerStopTimeout.Seconds())
+	if err := p.docker.ContainerStop(ctx, id, container.StopOptions{Timeout: &timeout}); err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	select {
+	case <-exited:
+		return nil
+	case err := <-waitErr:
+		if cerrdefs.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("waiting for %s to exit: %w", id, err)
+	}
+}
+
+// removeContainer rimuove il container anche se in esecuzione (inesistente = nessun errore)
+func (p *DockerProvisioner) removeContainer(ctx context.Context, id string) error {
+	err := p.docker.ContainerRemove(ctx, id, container.RemoveOptions{Force: true})
+	if cerrdefs.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// containerLogs apre lo stream dei log (stdout e stderr demultiplexati)
+func (p *DockerProvisioner) containerLogs(ctx context.Context, id string, opts LogOptions) (io.ReadCloser, error) {
+	options := container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+	}
+	if opts.Since > 0 {
+		options.Since = strconv.FormatInt(time.Now().Add(-opts.Since).Unix(), 10)
+	}
+	if opts.Tail > 0 {
+		options.Tail = strconv.FormatInt(opts.Tail, 10)
+	}
+
+	body, err := p.docker.ContainerLogs(ctx, id, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Container senza TTY: stdout e stderr arrivano multiplexati
+	reader, writer := io.Pipe()
+	go func() {
+		defer body.Close()
+		_, err := stdcopy.StdCopy(writer, writer, body)
+		writer.CloseWithError(err)
+	}()
+	return reader, nil
+}
@@ -36,27 +36,21 @@ func (p *DockerProvisioner) createEgressNode(ctx context.Context, spec domain.No
 
 	// Crea Janus Streaming
 	dockerName := spec.NodeId
-	janusDockerName := dockerName + "-janus-streaming"
+	janusDockerName := janusContainerName(spec.NodeId, true)
 
-	janusArgs := []string{
-		"-d",
-		"--name", janusDockerName,
-		"--label", "media-mesh.nodeId=" + spec.NodeId,
-		"--label", "media-mesh.containerType=janus",
-		"--cpus", "1.0",
-		"--memory", "512m",
-		"--hostname", janusDockerName,
-		"--network", p.networkName,
-		"-e", fmt.Sprintf("JANUS_RTP_PORT_RANGE=%d-%d", webrtcStart, webrtcEnd),
-		"-e", fmt.Sprintf("JANUS_STREAMING_RTP_PORT_RANGE=%d-%d", streamStart, streamEnd),
-		"-e", "JANUS_LOG_LEVEL=4",
-		"-p", fmt.Sprintf("%d:8088/tcp", janusHTTP),
-		"-p", fmt.Sprintf("%d:8188/tcp", janusWS),
-		"-p", fmt.Sprintf("%d-%d:%d-%d/udp", webrtcStart, webrtcEnd, webrtcStart, webrtcEnd),
-		"media-tree/janus-streaming:latest",
+	janusConfig := p.baseContainer(spec, role, containerTypeJanus, janusDockerName, "media-tree/janus-streaming:latest")
+	janusConfig.Labels[labelStreamRange] = portRange(streamStart, streamEnd)
+	janusConfig.Env = []string{
+		fmt.Sprintf("JANUS_RTP_PORT_RANGE=%d-%d", webrtcStart, webrtcEnd),
+		fmt.Sprintf("JANUS_STREAMING_RTP_PORT_RANGE=%d-%d", streamStart, streamEnd),
+		"JANUS_LOG_LEVEL=4",
 	}
+	janusConfig.Healthcheck = janusHealthcheck()
+	janusConfig.publishPorts(janusHTTP, 8088, 1, "tcp")
+	janusConfig.publishPorts(janusWS, 8188, 1, "tcp")
+	janusConfig.publishPorts(webrtcStart, webrtcStart, webrtcEnd-webrtcStart+1, "udp")
 
-	janusID, err := p.dockerRun(ctx, janusArgs)
+	janusID, err := p.runContainer(ctx, janusDockerName, janusConfig)
 	if err != nil {
 		p.portAllocator.ReleasePorts(apiPort, janusHTTP, janusWS)
 		p.portAllocator.ReleaseRange(webrtcStart, webrtcEnd)
@@ -64,38 +58,38 @@ func (p *DockerProvisioner) createEgressNode(ctx context.Context, spec domain.No
 		return nil, fmt.Errorf("failed to create Janus container: %w", err)
 	}
 
+	// Il nodo si collega a Janus all'avvio: aspettiamo che risponda
+	if err := p.waitHealthy(ctx, janusID); err != nil {
+		p.removeContainers(ctx, janusDockerName)
+		p.portAllocator.ReleasePorts(apiPort, janusHTTP, janusWS)
+		p.portAllocator.ReleaseRange(webrtcStart, webrtcEnd)
+		p.portAllocator.ReleaseRange(streamStart, streamEnd)
+		return nil, fmt.Errorf("janus container %s not healthy: %w", janusDockerName, err)
+	}
+
 	// Crea egress node
-	nodeArgs := []string{
-		"-d",
-		"--name", dockerName,
-		"--label", "media-mesh.nodeId=" + spec.NodeId,
-		"--label", "media-mesh.containerType=nodejs",
-		"--cpus", "1.0",
-		"--memory", "512m",
-		"--hostname", dockerName,
-		"--network", p.networkName,
-		"-e", fmt.Sprintf("NODE_ID=%s", spec.NodeId),
-		"-e", fmt.Sprintf("ROLE=%s", role),
-		"-e", fmt.Sprintf("NODE_HOST=%s", dockerName),
-		"-e", "API_PORT=7070",
-		"-e", "RTP_AUDIO_PORT=5002",
-		"-e", "RTP_VIDEO_PORT=5004",
-		"-e", "REDIS_HOST=redis",
-		"-e", "REDIS_PORT=6379",
-		"-e", fmt.Sprintf("JANUS_STREAMING_WS_URL=ws://%s:8188", janusDockerName),
-		"-e", "JANUS_STREAMING_MOUNTPOINT_SECRET=adminpwd",
-		"-e", "WHEP_BASE_PATH=/whep",
-		"-e", "WHEP_TOKEN=verysecret",
-		"-p", fmt.Sprintf("%d:7070/tcp", apiPort),
-		"media-tree/egress-node:latest",
+	nodeConfig := p.baseContainer(spec, role, containerTypeNode, dockerName, "media-tree/egress-node:latest")
+	nodeConfig.Env = []string{
+		fmt.Sprintf("NODE_ID=%s", spec.NodeId),
+		fmt.Sprintf("ROLE=%s", role),
+		fmt.Sprintf("NODE_HOST=%s", dockerName),
+		"API_PORT=7070",
+		"RTP_AUDIO_PORT=5002",
+		"RTP_VIDEO_PORT=5004",
+		"REDIS_HOST=redis",
+		"REDIS_PORT=6379",
+		fmt.Sprintf("JANUS_STREAMING_WS_URL=ws://%s:8188", janusDockerName),
+		"JANUS_STREAMING_MOUNTPOINT_SECRET=adminpwd",
+		"WHEP_BASE_PATH=/whep",
+		"WHEP_TOKEN=verysecret",
 	}
+	nodeConfig.Healthcheck = nodeHealthcheck(7070)
+	nodeConfig.publishPorts(apiPort, 7070, 1, "tcp")
 
-	nodeID, err := p.dockerRun(ctx, nodeArgs)
+	nodeID, err := p.runContainer(ctx, dockerName, nodeConfig)
 	if err != nil {
 		// Rollback
-		p.dockerRemove(ctx, dockerName)
-		p.dockerStop(ctx, janusDockerName)
-		p.dockerRemove(ctx, janusDockerName)
+		p.removeContainers(ctx, janusDockerName)
 		p.portAllocator.ReleasePorts(apiPort, janusHTTP, janusWS)
 		p.portAllocator.ReleaseRange(webrtcStart, webrtcEnd)
 		p.portAllocator.ReleaseRange(streamStart, streamEnd)
@@ -108,6 +102,9 @@ func (p *DockerProvisioner) createEgressNode(ctx context.Context, spec domain.No
 		NodeType:         spec.NodeType,
 		Role:             role,
 		MaxSlots:         spec.MaxSlots,
+		Profile:          spec.Profile,
+		MaxViewers:       spec.MaxViewers,
+		Backend:          BackendDocker,
 		ContainerId:      nodeID,
 		InternalHost:     dockerName,
 		InternalAPIPort:  7070,
@@ -128,10 +125,7 @@ func (p *DockerProvisioner) createEgressNode(ctx context.Context, spec domain.No
 	if err := p.redisClient.SaveNodeProvisioning(ctx, nodeInfo); err != nil {
 		// Rollback
 		log.Printf("[WARN] Failed to save Egress to Redis, rolling back %s...", spec.NodeId)
-		p.dockerStop(ctx, dockerName)
-		p.dockerRemove(ctx, dockerName)
-		p.dockerStop(ctx, janusDockerName)
-		p.dockerRemove(ctx, janusDockerName)
+		p.removeContainers(ctx, dockerName, janusDockerName)
 		p.portAllocator.ReleasePorts(apiPort, janusHTTP, janusWS)
 		p.portAllocator.ReleaseRange(webrtcStart, webrtcEnd)
 		p.portAllocator.ReleaseRange(streamStart, streamEnd)
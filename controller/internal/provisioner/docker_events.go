@@ -0,0 +1,163 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"controller/internal/redis"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+const dockerEventsRetry = 5 * time.Second
+
+// watchEvents segue /events dei container media dopo l'avvio:
+// un container morto, riavviato dalla restart policy o unhealthy diventa un evento su nodes:failures
+// Alla riconnessione riparte dall'ultimo evento visto
+func (p *DockerProvisioner) watchEvents(ctx context.Context) {
+	since := time.Now()
+	for ctx.Err() == nil {
+		messages, errs := p.docker.Events(ctx, events.ListOptions{
+			Since: fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()),
+			Filters: filters.NewArgs(
+				filters.Arg("type", string(events.ContainerEventType)),
+				filters.Arg("label", labelNodeId),
+				filters.Arg("event", string(events.ActionDie)),
+				filters.Arg("event", string(events.ActionHealthStatus)),
+			),
+		})
+
+	stream:
+		for {
+			select {
+			case msg := <-messages:
+				since = time.Unix(0, msg.TimeNano+1)
+				p.handleEvent(msg)
+			case err := <-errs:
+				if ctx.Err() == nil {
+					log.Printf("[WARN] Docker events stream closed: %v", err)
+				}
+				break stream
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(dockerEventsRetry):
+		}
+	}
+}
+
+// handleEvent gestisce die e health_status di un container del nodo
+func (p *DockerProvisioner) handleEvent(msg events.Message) {
+	nodeId := msg.Actor.Attributes[labelNodeId]
+	containerType := firstNonEmpty(msg.Actor.Attributes[labelContainerType], containerTypeNode)
+
+	p.mu.Lock()
+	node, known := p.nodes[nodeId]
+	var nodeType, nodeContainer string
+	if known {
+		nodeType, nodeContainer = node.NodeType, node.Containers[containerTypeNode]
+	}
+	p.mu.Unlock()
+	// Container in creazione (non ancora in inventario) o fermati dal controller
+	if !known || p.stopExpected(nodeId) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), podEventTimeout)
+	defer cancel()
+
+	switch msg.Action {
+	case events.ActionHealthStatusUnhealthy:
+		p.markContainerFailed(ctx, nodeId, "unhealthy", fmt.Sprintf("%s container unhealthy", containerType))
+	case events.ActionDie:
+		info, err := p.docker.ContainerInspect(ctx, msg.Actor.ID)
+		if err != nil {
+			if cerrdefs.IsNotFound(err) {
+				p.markContainerFailed(ctx, nodeId, "deleted", fmt.Sprintf("%s container removed", containerType))
+			}
+			return
+		}
+		state := info.State
+		exitCode := msg.Actor.Attributes["exitCode"]
+
+		// La restart policy lo sta riavviando: il nodo torna ma ha perso le sessioni
+		if state != nil && (state.Restarting || state.Running) {
+			if containerType == containerTypeJanus {
+				// Il nodo si collega a Janus solo all'avvio: si riavvia anche lui
+				go p.restartWithJanus(nodeId, nodeType, nodeContainer, msg.Actor.ID)
+				return
+			}
+			p.publishRestart(ctx, nodeId, nodeType, fmt.Sprintf("%s container restarted (exit code %s)", containerType, exitCode))
+			return
+		}
+
+		cause := "failed"
+		if state != nil && state.OOMKilled {
+			cause = "oom-killed"
+		}
+		p.markContainerFailed(ctx, nodeId, cause, fmt.Sprintf("%s container exited (code %s), restart policy exhausted", containerType, exitCode))
+	}
+}
+
+// restartWithJanus attende che il Janus riavviato sia healthy e riavvia il container del nodo
+func (p *DockerProvisioner) restartWithJanus(nodeId, nodeType, nodeContainer, janusId string) {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerHealthyTimeout+2*dockerStopTimeout)
+	defer cancel()
+
+	if err := p.waitHealthy(ctx, janusId); err != nil {
+		p.markContainerFailed(ctx, nodeId, "failed", fmt.Sprintf("janus container not healthy after restart: %v", err))
+		return
+	}
+
+	p.expectStop(nodeId)
+	timeout := int(dockerStopTimeout.Seconds())
+	if err := p.docker.ContainerRestart(ctx, nodeContainer, container.StopOptions{Timeout: &timeout}); err != nil {
+		p.markContainerFailed(ctx, nodeId, "failed", fmt.Sprintf("failed to restart node after janus restart: %v", err))
+		return
+	}
+	p.publishRestart(ctx, nodeId, nodeType, "janus container restarted, node restarted with it")
+}
+
+// publishRestart segnala il riavvio: lo stato non cambia, le sessioni del nodo vanno riparate
+func (p *DockerProvisioner) publishRestart(ctx context.Context, nodeId, nodeType, reason string) {
+	status, _ := p.redisClient.GetNodeStatus(ctx, nodeId)
+	switch status {
+	case "", redis.NodeStatusProvisioning, redis.NodeStatusDestroying, redis.NodeStatusGone, redis.NodeStatusFailed:
+		return
+	}
+
+	log.Printf("[WARN] Node %s: %s", nodeId, reason)
+	p.redisClient.PublishNodeFailure(ctx, redis.NodeFailureEvent{
+		Type:     redis.NodeEventRestarted,
+		NodeId:   nodeId,
+		NodeType: nodeType,
+		Cause:    "restarted",
+		Reason:   reason,
+		Previous: status,
+	})
+}
+
+// expectStop segna come attesi gli eventi die del nodo per il tempo di uno stop
+func (p *DockerProvisioner) expectStop(nodeId string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopping[nodeId] = time.Now().Add(2 * dockerStopTimeout)
+}
+
+func (p *DockerProvisioner) stopExpected(nodeId string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	until, ok := p.stopping[nodeId]
+	if ok && time.Now().After(until) {
+		delete(p.stopping, nodeId)
+		return false
+	}
+	return ok
+}
@@ -29,64 +29,56 @@ func (p *DockerProvisioner) createInjectionNode(ctx context.Context, spec domain
 
 	// Crea Janus Videoroom
 	dockerName := spec.NodeId
-	janusDockerName := dockerName + "-janus-vr"
+	janusDockerName := janusContainerName(spec.NodeId, false)
 
-	janusArgs := []string{
-		"-d",
-		"--name", janusDockerName,
-		"--label", "media-mesh.nodeId=" + spec.NodeId,
-		"--label", "media-mesh.containerType=janus",
-		"--cpus", "1.0",
-		"--memory", "512m",
-		"--hostname", janusDockerName,
-		"--network", p.networkName,
-		"-e", fmt.Sprintf("JANUS_RTP_PORT_RANGE=%d-%d", webrtcStart, webrtcEnd),
-		"-e", "JANUS_LOG_LEVEL=4",
-		"-p", fmt.Sprintf("%d:8088/tcp", janusHTTP),
-		"-p", fmt.Sprintf("%d:8188/tcp", janusWS),
-		"-p", fmt.Sprintf("%d-%d:%d-%d/udp", webrtcStart, webrtcEnd, webrtcStart, webrtcEnd),
-		"media-tree/janus-videoroom:latest",
+	janusConfig := p.baseContainer(spec, role, containerTypeJanus, janusDockerName, "media-tree/janus-videoroom:latest")
+	janusConfig.Env = []string{
+		fmt.Sprintf("JANUS_RTP_PORT_RANGE=%d-%d", webrtcStart, webrtcEnd),
+		"JANUS_LOG_LEVEL=4",
 	}
+	janusConfig.Healthcheck = janusHealthcheck()
+	janusConfig.publishPorts(janusHTTP, 8088, 1, "tcp")
+	janusConfig.publishPorts(janusWS, 8188, 1, "tcp")
+	janusConfig.publishPorts(webrtcStart, webrtcStart, webrtcEnd-webrtcStart+1, "udp")
 
-	janusID, err := p.dockerRun(ctx, janusArgs)
+	janusID, err := p.runContainer(ctx, janusDockerName, janusConfig)
 	if err != nil {
 		p.portAllocator.ReleasePorts(apiPort, janusHTTP, janusWS)
 		p.portAllocator.ReleaseRange(webrtcStart, webrtcEnd)
 		return nil, fmt.Errorf("failed to create Janus container: %w", err)
 	}
 
+	// Il nodo si collega a Janus all'avvio: aspettiamo che risponda
+	if err := p.waitHealthy(ctx, janusID); err != nil {
+		p.removeContainers(ctx, janusDockerName)
+		p.portAllocator.ReleasePorts(apiPort, janusHTTP, janusWS)
+		p.portAllocator.ReleaseRange(webrtcStart, webrtcEnd)
+		return nil, fmt.Errorf("janus container %s not healthy: %w", janusDockerName, err)
+	}
+
 	// Crea Injection Node
-	nodeArgs := []string{
-		"-d",
-		"--name", dockerName,
-		"--label", "media-mesh.nodeId=" + spec.NodeId,
-		"--label", "media-mesh.containerType=nodejs",
-		"--cpus", "1.0",
-		"--memory", "512m",
-		"--hostname", dockerName,
-		"--network", p.networkName,
-		"-e", fmt.Sprintf("NODE_ID=%s", spec.NodeId),
-		"-e", fmt.Sprintf("ROLE=%s", role),
-		"-e", fmt.Sprintf("NODE_HOST=%s", dockerName),
-		"-e", "API_PORT=7070",
-		"-e", "RTP_AUDIO_PORT=5000",
-		"-e", "RTP_VIDEO_PORT=5002",
-		"-e", "REDIS_HOST=redis",
-		"-e", "REDIS_PORT=6379",
-		"-e", fmt.Sprintf("JANUS_VIDEOROOM_WS_URL=ws://%s:8188", janusDockerName),
-		"-e", "JANUS_VIDEOROOM_ROOM_SECRET=adminpwd",
-		"-e", "WHIP_BASE_PATH=/whip",
-		"-e", "WHIP_TOKEN=verysecret",
-		"-p", fmt.Sprintf("%d:7070/tcp", apiPort),
-		"media-tree/injection-node:latest",
+	nodeConfig := p.baseContainer(spec, role, containerTypeNode, dockerName, "media-tree/injection-node:latest")
+	nodeConfig.Env = []string{
+		fmt.Sprintf("NODE_ID=%s", spec.NodeId),
+		fmt.Sprintf("ROLE=%s", role),
+		fmt.Sprintf("NODE_HOST=%s", dockerName),
+		"API_PORT=7070",
+		"RTP_AUDIO_PORT=5000",
+		"RTP_VIDEO_PORT=5002",
+		"REDIS_HOST=redis",
+		"REDIS_PORT=6379",
+		fmt.Sprintf("JANUS_VIDEOROOM_WS_URL=ws://%s:8188", janusDockerName),
+		"JANUS_VIDEOROOM_ROOM_SECRET=adminpwd",
+		"WHIP_BASE_PATH=/whip",
+		"WHIP_TOKEN=verysecret",
 	}
+	nodeConfig.Healthcheck = nodeHealthcheck(7070)
+	nodeConfig.publishPorts(apiPort, 7070, 1, "tcp")
 
-	nodeID, err := p.dockerRun(ctx, nodeArgs)
+	nodeID, err := p.runContainer(ctx, dockerName, nodeConfig)
 	if err != nil {
 		// Rollback
-		p.dockerRemove(ctx, dockerName)
-		p.dockerStop(ctx, janusDockerName)
-		p.dockerRemove(ctx, janusDockerName)
+		p.removeContainers(ctx, janusDockerName)
 		p.portAllocator.ReleasePorts(apiPort, janusHTTP, janusWS)
 		p.portAllocator.ReleaseRange(webrtcStart, webrtcEnd)
 		return nil, fmt.Errorf("failed to create injection node: %w", err)
@@ -98,6 +90,9 @@ func (p *DockerProvisioner) createInjectionNode(ctx context.Context, spec domain
 		NodeType:         spec.NodeType,
 		Role:             role,
 		MaxSlots:         spec.MaxSlots,
+		Profile:          spec.Profile,
+		MaxViewers:       spec.MaxViewers,
+		Backend:          BackendDocker,
 		ContainerId:      nodeID,
 		InternalHost:     dockerName,
 		InternalAPIPort:  7070,
@@ -117,10 +112,7 @@ func (p *DockerProvisioner) createInjectionNode(ctx context.Context, spec domain
 	if err := p.redisClient.SaveNodeProvisioning(ctx, nodeInfo); err != nil {
 		// Rollback
 		log.Printf("[WARN] Failed to save to Redis, rolling back %s...", spec.NodeId)
-		p.dockerStop(ctx, dockerName)
-		p.dockerRemove(ctx, dockerName)
-		p.dockerStop(ctx, janusDockerName)
-		p.dockerRemove(ctx, janusDockerName)
+		p.removeContainers(ctx, dockerName, janusDockerName)
 		p.portAllocator.ReleasePorts(apiPort, janusHTTP, janusWS)
 		p.portAllocator.ReleaseRange(webrtcStart, webrtcEnd)
 		return nil, fmt.Errorf("failed to save provisioning to Redis: %w", err)
@@ -17,33 +17,24 @@ func (p *DockerProvisioner) createRelayNode(ctx context.Context, spec domain.Nod
 
 	dockerName := spec.NodeId
 	// Crea Relay Node
-	nodeArgs := []string{
-		"-d",
-		"--name", dockerName,
-		"--label", "media-mesh.nodeId=" + spec.NodeId,
-		"--label", "media-mesh.containerType=nodejs",
-		"--cpus", "1.0",
-		"--memory", "512m",
-		"--hostname", dockerName,
-		"--network", p.networkName,
-		"-e", fmt.Sprintf("NODE_ID=%s", spec.NodeId),
-		"-e", fmt.Sprintf("ROLE=%s", role),
-		"-e", fmt.Sprintf("NODE_HOST=%s", dockerName),
-		"-e", "API_PORT=7070",
-		"-e", "RTP_AUDIO_PORT=5002",
-		"-e", "RTP_VIDEO_PORT=5004",
-		"-e", "REDIS_HOST=redis",
-		"-e", "REDIS_PORT=6379",
-		"-p", fmt.Sprintf("%d:7070/tcp", apiPort),
-		"media-tree/relay-node:latest",
+	nodeConfig := p.baseContainer(spec, role, containerTypeNode, dockerName, "media-tree/relay-node:latest")
+	nodeConfig.Env = []string{
+		fmt.Sprintf("NODE_ID=%s", spec.NodeId),
+		fmt.Sprintf("ROLE=%s", role),
+		fmt.Sprintf("NODE_HOST=%s", dockerName),
+		"API_PORT=7070",
+		"RTP_AUDIO_PORT=5002",
+		"RTP_VIDEO_PORT=5004",
+		"REDIS_HOST=redis",
+		"REDIS_PORT=6379",
 	}
+	nodeConfig.Healthcheck = nodeHealthcheck(7070)
+	nodeConfig.publishPorts(apiPort, 7070, 1, "tcp")
 
-	nodeID, err := p.dockerRun(ctx, nodeArgs)
+	nodeID, err := p.runContainer(ctx, dockerName, nodeConfig)
 	if err != nil {
-		p.dockerRemove(ctx, dockerName)
 		p.portAllocator.Release(apiPort)
 		return nil, fmt.Errorf("failed to create relay node: %w", err)
-
 	}
 
 	// Costruisci NodeInfo
@@ -52,6 +43,9 @@ func (p *DockerProvisioner) createRelayNode(ctx context.Context, spec domain.Nod
 		NodeType:         spec.NodeType,
 		Role:             role,
 		MaxSlots:         spec.MaxSlots,
+		Profile:          spec.Profile,
+		MaxViewers:       spec.MaxViewers,
+		Backend:          BackendDocker,
 		ContainerId:      nodeID,
 		InternalHost:     dockerName,
 		InternalAPIPort:  7070,
@@ -65,8 +59,7 @@ func (p *DockerProvisioner) createRelayNode(ctx context.Context, spec domain.Nod
 	if err := p.redisClient.SaveNodeProvisioning(ctx, nodeInfo); err != nil {
 		// Rollback
 		log.Printf("[WARN] Failed to save Relay to Redis, rolling back %s...", spec.NodeId)
-		p.dockerStop(ctx, dockerName)
-		p.dockerRemove(ctx, dockerName)
+		p.removeContainers(ctx, dockerName)
 		p.portAllocator.Release(apiPort)
 		return nil, fmt.Errorf("failed to save provisioning to Redis: %w", err)
 	}
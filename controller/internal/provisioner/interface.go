@@ -2,12 +2,15 @@ package provisioner
 
 import (
 	"context"
+	"errors"
+	"io"
+	"time"
 
 	"controller/internal/domain"
 )
 
 // Provisioner interface per creazione/distruzione nodi
-// Implementazioni: DockerProvisioner
+// Implementazioni: DockerProvisioner, K8sProvisioner, StaticProvisioner, LocalProvisioner, CompositeProvisioner (scelta in registry.go)
 type Provisioner interface {
 	// CreateNode crea un nuovo nodo
 	CreateNode(ctx context.Context, spec domain.NodeSpec, role string) (*domain.NodeInfo, error)
@@ -15,6 +18,25 @@ type Provisioner interface {
 	// DestroyNode distrugge un nodo esistente
 	DestroyNode(ctx context.Context, nodeInfo *domain.NodeInfo) error
 
+	// NodeLogs apre lo stream dei log di un container del nodo (chiuderlo a fine lettura)
+	NodeLogs(ctx context.Context, nodeInfo *domain.NodeInfo, opts LogOptions) (io.ReadCloser, error)
+
 	// Close cleanup risorse
 	Close() error
 }
+
+// Container di un nodo di cui si possono leggere i log
+const (
+	LogContainerNode  = "node"
+	LogContainerJanus = "janus"
+)
+
+var ErrUnknownContainer = errors.New("node has no such container")
+
+// LogOptions parametri di lettura dei log
+type LogOptions struct {
+	Container string        // node (default) o janus
+	Since     time.Duration // 0 = dall'inizio
+	Tail      int64         // 0 = tutte le righe
+	Follow    bool
+}
@@ -1,14 +1,13 @@
 package provisioner
 
 import (
-	"bytes"
 	"context"
 	"embed"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"sync"
-	"text/template"
 	"time"
 
 	"controller/internal/domain"
@@ -17,30 +16,45 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 )
 
 //go:embed templates/*.yaml
 var templateFS embed.FS
 
+// AgentConfig nodo Kubernetes che può ospitare pod injection ed egress (hostNetwork)
+// I range sono il budget dell'host, diviso in slot (uno per pod)
 type AgentConfig struct {
-	Name     string
-	PublicIP string
-	ExtPort  int
-	WebRTC   string
+	Name          string
+	PublicIP      string
+	APIPorts      string // Porte API esterne, una per slot
+	WebRTC        string // Range UDP WebRTC, es. 20000-20099
+	Stream        string // Range RTP in ingresso al Janus streaming (egress)
+	ServicePorts  string // Porte interne: Janus, relay root, RTP
+	CPUMilli      int64
+	BandwidthMbps int // 0 = non limitata
 }
 
 type K8sProvisioner struct {
-	clientset      *kubernetes.Clientset
-	namespace      string
-	redisClient    *redis.Client
-	agents         []AgentConfig
-	mu             sync.Mutex
-	reservedAgents map[string]bool
+	clientset       *kubernetes.Clientset
+	namespace       string
+	redisClient     *redis.Client
+	defaultPublicIP string
+	discovery       *agentDiscovery
+	agents          map[string]AgentConfig // Aggiornati dagli informer
+	mu              sync.Mutex
+	inflight        map[string]bool // Pod in creazione: il loro slot non va liberato
+	pods            *podWatcher     // Informer sui pod: readiness e guasti
+	operator        *mediaNodeOperator
+	nodeStopCh      chan struct{}
+	evacuator       NodeEvacuator
+	evacuating      map[string]bool // Nodi media già in evacuazione
 }
 
-func NewK8sProvisioner(redisClient *redis.Client) (*K8sProvisioner, error) {
+// NewK8sProvisioner crea il provisioner, avvia la scoperta degli agenti e l'osservazione dei pod
+// agentSelector: label dei nodi idonei, agentConfigMap: ConfigMap con porte e IP per nodo
+// operatorMode: i nodi sono MediaNode riconciliate nei Pod invece di Pod creati direttamente
+func NewK8sProvisioner(redisClient *redis.Client, agentSelector, agentConfigMap string, operatorMode bool) (*K8sProvisioner, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get k8s in-cluster config: %w", err)
@@ -55,85 +69,109 @@ func NewK8sProvisioner(redisClient *redis.Client) (*K8sProvisioner, error) {
 		publicIP = "127.0.0.1"
 	}
 
-	labAgents := []AgentConfig{
-		{Name: "k3d-media-tree-agent-0", PublicIP: publicIP, ExtPort: 11000, WebRTC: "20000-20010"},
-		{Name: "k3d-media-tree-agent-1", PublicIP: publicIP, ExtPort: 12000, WebRTC: "20100-20110"},
-		{Name: "k3d-media-tree-agent-2", PublicIP: publicIP, ExtPort: 13000, WebRTC: "20200-20210"},
+	if agentSelector == "" {
+		agentSelector = DefaultAgentSelector
+	}
+	if agentConfigMap == "" {
+		agentConfigMap = DefaultAgentConfigMap
 	}
 
-	return &K8sProvisioner{
-		clientset:      clientset,
-		namespace:      "default",
-		redisClient:    redisClient,
-		agents:         labAgents,
-		reservedAgents: make(map[string]bool),
-	}, nil
+	p := &K8sProvisioner{
+		clientset:       clientset,
+		namespace:       "default",
+		redisClient:     redisClient,
+		defaultPublicIP: publicIP,
+		agents:          make(map[string]AgentConfig),
+		inflight:        make(map[string]bool),
+		evacuating:      make(map[string]bool),
+	}
+	if err := p.startAgentDiscovery(agentSelector, agentConfigMap); err != nil {
+		return nil, err
+	}
+	if err := p.startPodWatch(); err != nil {
+		p.stopAgentDiscovery()
+		return nil, err
+	}
+	if operatorMode {
+		if err := p.startOperator(config); err != nil {
+			p.stopPodWatch()
+			p.stopAgentDiscovery()
+			return nil, err
+		}
+	}
+	if err := p.startNodeWatch(); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
 }
 
 func (p *K8sProvisioner) CreateNode(ctx context.Context, spec domain.NodeSpec, role string) (*domain.NodeInfo, error) {
 	log.Printf("[K8s] Provisioning started for %s (%s)", spec.NodeId, spec.NodeType)
-	// Trova un nodo fisico libero
 	p.mu.Lock()
-	agent, err := p.scheduleAndAllocate(ctx, spec.NodeType)
-	if err != nil {
+	p.inflight[spec.NodeId] = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.inflight, spec.NodeId)
 		p.mu.Unlock()
-		return nil, err
-	}
-	if agent.Name != "" {
-		p.reservedAgents[agent.Name] = true
+	}()
+
+	// Trova uno slot libero su un nodo fisico (i relay non usano la rete dell'host)
+	var slot *hostSlot
+	if spec.NodeType != domain.NodeTypeRelay {
+		var err error
+		if slot, err = p.allocateSlot(ctx, spec); err != nil {
+			return nil, err
+		}
 	}
-	p.mu.Unlock()
 
-	// Rilascia la prenotazione quando CreateNode ritorna
+	// Su errore lo slot torna libero
+	provisioned := false
 	defer func() {
-		if agent.Name != "" {
-			p.mu.Lock()
-			delete(p.reservedAgents, agent.Name)
-			p.mu.Unlock()
+		if slot != nil && !provisioned {
+			p.redisClient.ReleaseHostSlot(ctx, spec.NodeId)
 		}
 	}()
 
-	// Prepara gli argomenti per il template
-	data := map[string]any{
-		"NodeId":       spec.NodeId,
-		"NodeType":     string(spec.NodeType),
-		"RelayRootId":  spec.RelayRootId,
-		"Role":         role,
-		"SelectedNode": agent.Name,
-		"WebRTCRange":  agent.WebRTC,
-		"PublicIP":     agent.PublicIP,
-		"ApiPort":      agent.ExtPort,
+	// Stato desiderato del nodo: argomenti del template del Pod
+	nodeSpec := MediaNodeSpec{
+		NodeType:    string(spec.NodeType),
+		Role:        role,
+		Profile:     spec.Profile,
+		RelayRootId: spec.RelayRootId,
+		MaxSlots:    spec.MaxSlots,
 	}
-
-	tmpl, err := template.ParseFS(templateFS, "templates/"+string(spec.NodeType)+".yaml")
-	if err != nil {
-		return nil, fmt.Errorf("failed to load template: %w", err)
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return nil, fmt.Errorf("failed to execute template: %w", err)
+	if slot != nil {
+		nodeSpec.Placement = slot.placement()
 	}
 
-	// Decode YAML -> Oggetto Kubernetes Pod
-	decode := scheme.Codecs.UniversalDeserializer().Decode
-	obj, _, err := decode(buf.Bytes(), nil, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode yaml: %w", err)
-	}
-	pod := obj.(*corev1.Pod)
+	if p.operator != nil {
+		// Modalità operator: il Pod lo crea il reconciler della MediaNode
+		if err := p.createMediaNode(ctx, spec.NodeId, nodeSpec); err != nil {
+			return nil, err
+		}
+	} else {
+		pod, err := renderPod(spec.NodeType, podTemplateData(spec.NodeId, nodeSpec))
+		if err != nil {
+			return nil, err
+		}
 
-	// Creazione fisica del Pod su K8s
-	_, err = p.clientset.CoreV1().Pods(p.namespace).Create(ctx, pod, metav1.CreateOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("k8s creation failed: %w", err)
+		// Creazione fisica del Pod su K8s
+		created, err := p.clientset.CoreV1().Pods(p.namespace).Create(ctx, pod, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("k8s creation failed: %w", err)
+		}
+		if err := p.ensurePodDisruptionBudget(ctx, spec.NodeId, podOwner(created)); err != nil {
+			log.Printf("[WARN] %v", err)
+		}
 	}
 
 	// Attesa Pod Ready e assegnazione IP
 	podStatus, err := p.waitForPodReady(ctx, spec.NodeId)
 	if err != nil {
 		// Se fallisce l'assegnazione, puliamo K8s
-		_ = p.clientset.CoreV1().Pods(p.namespace).Delete(ctx, spec.NodeId, metav1.DeleteOptions{})
+		_ = p.removeWorkload(ctx, spec.NodeId)
 		return nil, err
 	}
 
@@ -143,12 +181,13 @@ func (p *K8sProvisioner) CreateNode(ctx context.Context, spec domain.NodeSpec, r
 		NodeType:         spec.NodeType,
 		Role:             role,
 		MaxSlots:         spec.MaxSlots,
+		Profile:          spec.Profile,
+		MaxViewers:       spec.MaxViewers,
+		Backend:          BackendK8s,
 		ContainerId:      spec.NodeId, // In K8s usiamo Pod Name come ID univoco
-		InternalAPIPort:  agent.ExtPort,
 		InternalRTPAudio: 5002,
 		InternalRTPVideo: 5004,
 		ExternalHost:     "localhost",
-		ExternalAPIPort:  agent.ExtPort,
 		CreatedAt:        time.Now().Unix(),
 	}
 
@@ -157,14 +196,22 @@ func (p *K8sProvisioner) CreateNode(ctx context.Context, spec domain.NodeSpec, r
 		nodeInfo.InternalHost = podStatus.Status.PodIP // IP privato del Pod
 	} else {
 		nodeInfo.InternalHost = podStatus.Status.HostIP // IP dell'Agent k3d (visibile agli altri agenti)
+		nodeInfo.InternalAPIPort = slot.APIPort
+		nodeInfo.ExternalAPIPort = slot.APIPort
 		nodeInfo.JanusHost = "localhost"
-		nodeInfo.JanusHTTPPort = 8088
-		nodeInfo.JanusWSPort = 8188
+		nodeInfo.JanusHTTPPort = slot.JanusHTTPPort
+		nodeInfo.JanusWSPort = slot.JanusWSPort
+		nodeInfo.WebRTCPortStart, nodeInfo.WebRTCPortEnd, _ = parsePortRange(slot.WebRTC)
+		if spec.NodeType == domain.NodeTypeEgress {
+			nodeInfo.InternalRTPAudio = slot.RTPAudioPort
+			nodeInfo.InternalRTPVideo = slot.RTPVideoPort
+			nodeInfo.StreamPortStart, nodeInfo.StreamPortEnd, _ = parsePortRange(slot.Stream)
+		}
 	}
 
 	// Salvataggio su Redis
 	if err := p.redisClient.SaveNodeProvisioning(ctx, nodeInfo); err != nil {
-		_ = p.clientset.CoreV1().Pods(p.namespace).Delete(ctx, spec.NodeId, metav1.DeleteOptions{})
+		_ = p.removeWorkload(ctx, spec.NodeId)
 		return nil, fmt.Errorf("failed to save to redis: %w", err)
 	}
 
@@ -175,11 +222,13 @@ func (p *K8sProvisioner) CreateNode(ctx context.Context, spec domain.NodeSpec, r
 			NodeType:         domain.NodeTypeRelay,
 			Role:             "root",
 			MaxSlots:         spec.MaxSlots,
+			Profile:          spec.Profile,
+			Backend:          BackendK8s,
 			ContainerId:      spec.NodeId,             // Stesso Pod
 			InternalHost:     podStatus.Status.HostIP, // Stesso host del Pod Injection
-			InternalAPIPort:  7071,                    // Porta differenziata
-			InternalRTPAudio: 5002,
-			InternalRTPVideo: 5004,
+			InternalAPIPort:  slot.RootAPIPort,        // Porte dello slot dell'injection
+			InternalRTPAudio: slot.RTPAudioPort,
+			InternalRTPVideo: slot.RTPVideoPort,
 			ExternalHost:     "localhost",
 			ExternalAPIPort:  0,
 			CreatedAt:        time.Now().Unix(),
@@ -187,56 +236,26 @@ func (p *K8sProvisioner) CreateNode(ctx context.Context, spec domain.NodeSpec, r
 
 		// Salviamo su Redis
 		if err := p.redisClient.SaveNodeProvisioning(ctx, rootInfo); err != nil {
-			_ = p.clientset.CoreV1().Pods(p.namespace).Delete(ctx, spec.NodeId, metav1.DeleteOptions{})
+			_ = p.removeWorkload(ctx, spec.NodeId)
 			return nil, err
 		}
-		log.Printf("[K8s] Provisioned Injection Pair: %s (7070) <-> %s (7071)", spec.NodeId, spec.RelayRootId)
+		log.Printf("[K8s] Provisioned Injection Pair: %s (%d) <-> %s (%d)", spec.NodeId, slot.APIPort, spec.RelayRootId, slot.RootAPIPort)
 	}
 
+	provisioned = true
+
 	log.Printf("[K8s] Provisioned %s on %s (Ext Port: %d)", spec.NodeId, podStatus.Spec.NodeName, nodeInfo.ExternalAPIPort)
 	return nodeInfo, nil
 }
 
-// scheduleAndAllocate: Cerca un agente libero per Ingress/Egress e mappa le porte
-func (p *K8sProvisioner) scheduleAndAllocate(ctx context.Context, nType domain.NodeType) (AgentConfig, error) {
-	if nType == domain.NodeTypeRelay {
-		return AgentConfig{}, nil
-	}
-
-	// Elenco agenti occupati
-	pods, _ := p.clientset.CoreV1().Pods(p.namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: "app in (injection-pod, egress-pod)",
-	})
-
-	occupied := make(map[string]bool)
-	for _, pod := range pods.Items {
-		if pod.Spec.NodeName != "" {
-			occupied[pod.Spec.NodeName] = true
-		}
-	}
-
-	for _, agent := range p.agents {
-		if !occupied[agent.Name] && !p.reservedAgents[agent.Name] {
-			return agent, nil
-		}
-	}
-	return AgentConfig{}, fmt.Errorf("no physical agents available")
-}
-
-// waitForPodReady aspetta che K8s assegni un IP al Pod
-func (p *K8sProvisioner) waitForPodReady(ctx context.Context, name string) (*corev1.Pod, error) {
-	for range 120 {
-		pod, err := p.clientset.CoreV1().Pods(p.namespace).Get(ctx, name, metav1.GetOptions{})
-		if err == nil && pod.Status.PodIP != "" && pod.Status.Phase == corev1.PodRunning {
-			return pod, nil
-		}
-		time.Sleep(1 * time.Second)
-	}
-	return nil, fmt.Errorf("pod %s failed to become ready (timeout)", name)
+func (p *K8sProvisioner) Close() error {
+	p.stopNodeWatch()
+	p.stopOperator()
+	p.stopPodWatch()
+	p.stopAgentDiscovery()
+	return nil
 }
 
-func (p *K8sProvisioner) Close() error { return nil }
-
 func (p *K8sProvisioner) DestroyNode(ctx context.Context, nodeInfo *domain.NodeInfo) error {
 	log.Printf("[K8s] Destroying node %s", nodeInfo.NodeId)
 
@@ -257,8 +276,8 @@ func (p *K8sProvisioner) DestroyNode(ctx context.Context, nodeInfo *domain.NodeI
 		return nil
 	}
 
-	// Rimuovi Pod da Kubernetes
-	err := p.clientset.CoreV1().Pods(p.namespace).Delete(ctx, nodeInfo.NodeId, metav1.DeleteOptions{})
+	// Rimuovi MediaNode e Pod da Kubernetes
+	err := p.removeWorkload(ctx, nodeInfo.NodeId)
 	if err != nil {
 		log.Printf("[WARN] Failed to delete Pod %s: %v", nodeInfo.NodeId, err)
 	}
@@ -273,6 +292,60 @@ func (p *K8sProvisioner) DestroyNode(ctx context.Context, nodeInfo *domain.NodeI
 		log.Printf("[WARN] Failed to delete provisioning info from Redis: %v", err)
 	}
 
+	// Libera lo slot di porte sull'host
+	if err := p.redisClient.ReleaseHostSlot(ctx, nodeInfo.NodeId); err != nil {
+		log.Printf("[WARN] Failed to release host slot of %s: %v", nodeInfo.NodeId, err)
+	}
+
 	log.Printf("[K8s] Node %s destroyed successfully", nodeInfo.NodeId)
 	return nil
 }
+
+// NodeLogs apre lo stream dei log del container del nodo tramite la pod logs API
+// Il Relay Root vive nel Pod del suo injection (container relay-root)
+func (p *K8sProvisioner) NodeLogs(ctx context.Context, nodeInfo *domain.NodeInfo, opts LogOptions) (io.ReadCloser, error) {
+	podName := nodeInfo.NodeId
+	if nodeInfo.ContainerId != "" {
+		podName = nodeInfo.ContainerId
+	}
+
+	var container string
+	switch opts.Container {
+	case "", LogContainerNode:
+		switch {
+		case nodeInfo.Role == "root":
+			container = "relay-root"
+		case nodeInfo.IsInjection():
+			container = "injection-node"
+		case nodeInfo.IsEgress():
+			container = "egress-node"
+		default:
+			container = "nodejs"
+		}
+	case LogContainerJanus:
+		if !nodeInfo.NeedsJanus() {
+			return nil, ErrUnknownContainer
+		}
+		container = "janus"
+	default:
+		return nil, ErrUnknownContainer
+	}
+
+	logOpts := &corev1.PodLogOptions{
+		Container: container,
+		Follow:    opts.Follow,
+	}
+	if opts.Since > 0 {
+		seconds := int64(opts.Since.Seconds())
+		logOpts.SinceSeconds = &seconds
+	}
+	if opts.Tail > 0 {
+		logOpts.TailLines = &opts.Tail
+	}
+
+	stream, err := p.clientset.CoreV1().Pods(p.namespace).GetLogs(podName, logOpts).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stream logs of %s/%s: %w", podName, container, err)
+	}
+	return stream, nil
+}
@@ -0,0 +1,337 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Annotazioni lette sui nodi Kubernetes idonei a ospitare injection/egress
+const (
+	AgentAnnotationPublicIP     = "media-mesh/public-ip"
+	AgentAnnotationAPIPort      = "media-mesh/api-port"  // Singola porta (un solo slot)
+	AgentAnnotationAPIPorts     = "media-mesh/api-ports" // Range, una porta per slot
+	AgentAnnotationWebRTCRange  = "media-mesh/webrtc-range"
+	AgentAnnotationStreamRange  = "media-mesh/stream-range"
+	AgentAnnotationServicePorts = "media-mesh/service-ports"
+	AgentAnnotationCPU          = "media-mesh/cpu"            // Quantity, es. 4 o 3500m
+	AgentAnnotationBandwidth    = "media-mesh/bandwidth-mbps" // 0 o assente = non limitata
+)
+
+const (
+	DefaultAgentSelector  = "media-mesh/agent=true"
+	DefaultAgentConfigMap = "media-mesh-agents"
+
+	defaultStreamRange  = "6000-6100"
+	defaultServicePorts = "40000-40799"
+	agentResync         = 5 * time.Minute
+	agentSyncTimeout    = 30 * time.Second
+)
+
+// agentOverride voce della ConfigMap degli agenti (chiave = nome del nodo Kubernetes)
+// Le annotazioni sul nodo hanno la precedenza
+type agentOverride struct {
+	PublicIP      string `json:"publicIp"`
+	APIPort       int    `json:"apiPort"`
+	APIPorts      string `json:"apiPorts"`
+	WebRTCRange   string `json:"webrtcRange"`
+	StreamRange   string `json:"streamRange"`
+	ServicePorts  string `json:"servicePorts"`
+	CPU           string `json:"cpu"`
+	BandwidthMbps int    `json:"bandwidthMbps"`
+}
+
+// agentDiscovery tiene in cache nodi etichettati e ConfigMap degli agenti
+type agentDiscovery struct {
+	nodes     listersv1.NodeLister
+	configMap listersv1.ConfigMapLister
+	namespace string
+	cmName    string
+	stopCh    chan struct{}
+}
+
+// startAgentDiscovery avvia gli informer su nodi (per label) e ConfigMap degli agenti
+// Ogni evento ricostruisce l'elenco degli agenti
+func (p *K8sProvisioner) startAgentDiscovery(selector, configMap string) error {
+	if _, err := labels.Parse(selector); err != nil {
+		return fmt.Errorf("invalid agent selector %q: %w", selector, err)
+	}
+
+	nodeFactory := informers.NewSharedInformerFactoryWithOptions(p.clientset, agentResync,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = selector
+		}))
+	cmFactory := informers.NewSharedInformerFactoryWithOptions(p.clientset, agentResync,
+		informers.WithNamespace(p.namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", configMap).String()
+		}))
+
+	nodeInformer := nodeFactory.Core().V1().Nodes()
+	cmInformer := cmFactory.Core().V1().ConfigMaps()
+
+	discovery := &agentDiscovery{
+		nodes:     nodeInformer.Lister(),
+		configMap: cmInformer.Lister(),
+		namespace: p.namespace,
+		cmName:    configMap,
+		stopCh:    make(chan struct{}),
+	}
+	p.mu.Lock()
+	p.discovery = discovery
+	p.mu.Unlock()
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { p.syncAgents() },
+		UpdateFunc: func(any, any) { p.syncAgents() },
+		DeleteFunc: func(any) { p.syncAgents() },
+	}
+	if _, err := nodeInformer.Informer().AddEventHandler(handler); err != nil {
+		return fmt.Errorf("failed to watch agent nodes: %w", err)
+	}
+	if _, err := cmInformer.Informer().AddEventHandler(handler); err != nil {
+		return fmt.Errorf("failed to watch agent configmap: %w", err)
+	}
+
+	nodeFactory.Start(discovery.stopCh)
+	cmFactory.Start(discovery.stopCh)
+
+	// Attesa della prima lista: senza agenti il provisioning fallirebbe subito
+	synced := make(chan struct{})
+	go func() {
+		defer close(synced)
+		cache.WaitForCacheSync(discovery.stopCh, nodeInformer.Informer().HasSynced, cmInformer.Informer().HasSynced)
+	}()
+	select {
+	case <-synced:
+	case <-time.After(agentSyncTimeout):
+		log.Printf("[WARN] Agent discovery not synced after %v, continuing in background", agentSyncTimeout)
+	}
+
+	p.syncAgents()
+	log.Printf("[K8s] Agent discovery started (selector: %s, configmap: %s/%s)", selector, p.namespace, configMap)
+	return nil
+}
+
+// stopAgentDiscovery ferma gli informer
+func (p *K8sProvisioner) stopAgentDiscovery() {
+	p.mu.Lock()
+	discovery := p.discovery
+	p.discovery = nil
+	p.mu.Unlock()
+
+	if discovery != nil {
+		close(discovery.stopCh)
+	}
+}
+
+// syncAgents ricostruisce gli agenti dai nodi in cache e registra ingressi e uscite
+func (p *K8sProvisioner) syncAgents() {
+	// Gli handler degli informer girano in parallelo a Close
+	p.mu.Lock()
+	discovery := p.discovery
+	p.mu.Unlock()
+	if discovery == nil {
+		return
+	}
+
+	nodes, err := discovery.nodes.List(labels.Everything())
+	if err != nil {
+		log.Printf("[WARN] Failed to list agent nodes: %v", err)
+		return
+	}
+	overrides := discovery.loadOverrides()
+
+	agents := make(map[string]AgentConfig, len(nodes))
+	for _, node := range nodes {
+		if !isNodeSchedulable(node) {
+			continue
+		}
+		agent, err := p.agentFromNode(node, overrides[node.Name])
+		if err != nil {
+			log.Printf("[WARN] Ignoring agent %s: %v", node.Name, err)
+			continue
+		}
+		agents[node.Name] = agent
+	}
+
+	p.mu.Lock()
+	previous := p.agents
+	p.agents = agents
+	p.mu.Unlock()
+
+	for name, agent := range agents {
+		if old, ok := previous[name]; !ok {
+			log.Printf("[K8s] Agent joined: %s (%s, %d slots, API %s, WebRTC %s, CPU %dm, BW %d Mbps)",
+				name, agent.PublicIP, agent.slotCount(), agent.APIPorts, agent.WebRTC, agent.CPUMilli, agent.BandwidthMbps)
+		} else if old != agent {
+			log.Printf("[K8s] Agent updated: %s (%s, %d slots, API %s, WebRTC %s, CPU %dm, BW %d Mbps)",
+				name, agent.PublicIP, agent.slotCount(), agent.APIPorts, agent.WebRTC, agent.CPUMilli, agent.BandwidthMbps)
+		}
+	}
+	for name := range previous {
+		if _, ok := agents[name]; !ok {
+			log.Printf("[K8s] Agent left: %s", name)
+		}
+	}
+}
+
+// loadOverrides legge la ConfigMap degli agenti (assente = nessun override)
+func (d *agentDiscovery) loadOverrides() map[string]agentOverride {
+	overrides := make(map[string]agentOverride)
+
+	cm, err := d.configMap.ConfigMaps(d.namespace).Get(d.cmName)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			log.Printf("[WARN] Failed to read agent configmap: %v", err)
+		}
+		return overrides
+	}
+
+	for nodeName, raw := range cm.Data {
+		var override agentOverride
+		if err := json.Unmarshal([]byte(raw), &override); err != nil {
+			log.Printf("[WARN] Invalid agent entry %s in configmap %s: %v", nodeName, d.cmName, err)
+			continue
+		}
+		overrides[nodeName] = override
+	}
+	return overrides
+}
+
+// agentFromNode compone la configurazione dell'agente
+// Priorità: annotazioni del nodo, ConfigMap, poi IP esterno del nodo o MY_IP per l'IP pubblico
+// Senza CPU dichiarata si usa l'allocatable del nodo
+func (p *K8sProvisioner) agentFromNode(node *corev1.Node, override agentOverride) (AgentConfig, error) {
+	annotations := node.Annotations
+
+	agent := AgentConfig{
+		Name:         node.Name,
+		PublicIP:     firstNonEmpty(annotations[AgentAnnotationPublicIP], override.PublicIP, nodeExternalIP(node), p.defaultPublicIP),
+		APIPorts:     firstNonEmpty(annotations[AgentAnnotationAPIPorts], override.APIPorts),
+		WebRTC:       firstNonEmpty(annotations[AgentAnnotationWebRTCRange], override.WebRTCRange),
+		Stream:       firstNonEmpty(annotations[AgentAnnotationStreamRange], override.StreamRange, defaultStreamRange),
+		ServicePorts: firstNonEmpty(annotations[AgentAnnotationServicePorts], override.ServicePorts, defaultServicePorts),
+	}
+
+	// Porta singola: retrocompatibile con un solo pod per host
+	if agent.APIPorts == "" {
+		apiPort := firstNonEmpty(annotations[AgentAnnotationAPIPort])
+		if apiPort == "" && override.APIPort > 0 {
+			apiPort = strconv.Itoa(override.APIPort)
+		}
+		if apiPort == "" {
+			return AgentConfig{}, fmt.Errorf("missing API port")
+		}
+		agent.APIPorts = apiPort + "-" + apiPort
+	}
+
+	if net.ParseIP(agent.PublicIP) == nil {
+		return AgentConfig{}, fmt.Errorf("invalid public IP %q", agent.PublicIP)
+	}
+	if agent.WebRTC == "" {
+		return AgentConfig{}, fmt.Errorf("missing WebRTC port range")
+	}
+	for _, r := range []string{agent.APIPorts, agent.WebRTC, agent.Stream, agent.ServicePorts} {
+		if _, _, err := parsePortRange(r); err != nil {
+			return AgentConfig{}, err
+		}
+	}
+	if start, _, _ := parsePortRange(agent.ServicePorts); start%2 != 0 {
+		return AgentConfig{}, fmt.Errorf("service port range %q must start on an even port (RTP)", agent.ServicePorts)
+	}
+
+	// Capacità dichiarata
+	agent.CPUMilli = node.Status.Allocatable.Cpu().MilliValue()
+	if raw := firstNonEmpty(annotations[AgentAnnotationCPU], override.CPU); raw != "" {
+		cpu, err := resource.ParseQuantity(raw)
+		if err != nil {
+			return AgentConfig{}, fmt.Errorf("invalid CPU %q: %w", raw, err)
+		}
+		agent.CPUMilli = cpu.MilliValue()
+	}
+	agent.BandwidthMbps = override.BandwidthMbps
+	if raw := annotations[AgentAnnotationBandwidth]; raw != "" {
+		bw, err := strconv.Atoi(raw)
+		if err != nil || bw < 0 {
+			return AgentConfig{}, fmt.Errorf("invalid %s %q", AgentAnnotationBandwidth, raw)
+		}
+		agent.BandwidthMbps = bw
+	}
+
+	if agent.slotCount() == 0 {
+		return AgentConfig{}, fmt.Errorf("port ranges too small for a single pod")
+	}
+	return agent, nil
+}
+
+// agentNames ritorna i nomi degli agenti in ordine stabile
+func (p *K8sProvisioner) agentNames() []string {
+	names := make([]string, 0, len(p.agents))
+	for name := range p.agents {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// isNodeSchedulable: nodo Ready e non cordonato
+func isNodeSchedulable(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// nodeExternalIP primo indirizzo ExternalIP del nodo
+func nodeExternalIP(node *corev1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeExternalIP {
+			return addr.Address
+		}
+	}
+	return ""
+}
+
+// parsePortRange interpreta "start-end"
+func parsePortRange(value string) (int, int, error) {
+	startStr, endStr, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid port range %q", value)
+	}
+	start, errStart := strconv.Atoi(strings.TrimSpace(startStr))
+	end, errEnd := strconv.Atoi(strings.TrimSpace(endStr))
+	if errStart != nil || errEnd != nil || start <= 0 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("invalid port range %q", value)
+	}
+	return start, end, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,190 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// Eviction già decisa (DisruptionTarget, taint NoExecute): resta solo il grace period del Pod
+	evictionDrainDeadline = 30 * time.Second
+	evacuationTimeout     = 30 * time.Second
+	nodeResync            = 5 * time.Minute
+)
+
+// NodeEvacuator svuota un nodo media prima che Kubernetes ne tolga il Pod
+// Implementato da SessionManager (cordon + drain con migrazione delle sessioni)
+type NodeEvacuator interface {
+	EvacuateNode(ctx context.Context, nodeId, reason string, deadline time.Duration) error
+}
+
+// SetNodeEvacuator collega cordon e drain del controller agli eventi del cluster
+func (p *K8sProvisioner) SetNodeEvacuator(evacuator NodeEvacuator) {
+	p.mu.Lock()
+	p.evacuator = evacuator
+	p.mu.Unlock()
+}
+
+// startNodeWatch osserva tutti i nodi Kubernetes (i relay possono girare ovunque)
+// Un nodo cordonato o con taint NoExecute fa evacuare i media pod che ospita
+func (p *K8sProvisioner) startNodeWatch() error {
+	factory := informers.NewSharedInformerFactory(p.clientset, nodeResync)
+	nodeInformer := factory.Core().V1().Nodes()
+
+	_, err := nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if node, ok := obj.(*corev1.Node); ok {
+				p.onNodeChange(node)
+			}
+		},
+		UpdateFunc: func(_, obj any) {
+			if node, ok := obj.(*corev1.Node); ok {
+				p.onNodeChange(node)
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch nodes: %w", err)
+	}
+
+	p.nodeStopCh = make(chan struct{})
+	factory.Start(p.nodeStopCh)
+	return nil
+}
+
+func (p *K8sProvisioner) stopNodeWatch() {
+	if p.nodeStopCh != nil {
+		close(p.nodeStopCh)
+		p.nodeStopCh = nil
+	}
+}
+
+// onNodeChange evacua i media pod di un nodo in manutenzione
+func (p *K8sProvisioner) onNodeChange(node *corev1.Node) {
+	reason, deadline, disrupted := nodeDisruption(node)
+	if !disrupted || p.pods == nil {
+		return
+	}
+
+	pods, err := p.pods.pods.Pods(p.namespace).List(labels.Everything())
+	if err != nil {
+		return
+	}
+	for _, pod := range pods {
+		if pod.Spec.NodeName == node.Name {
+			p.evacuatePod(pod, reason, deadline)
+		}
+	}
+}
+
+// nodeDisruption indica se il nodo sta per perdere i suoi pod
+// Cordon (anche primo passo di kubectl drain): drain con deadline di default
+// Taint NoExecute: i pod verranno evicted a breve, drain con deadline corta
+func nodeDisruption(node *corev1.Node) (string, time.Duration, bool) {
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == corev1.TaintEffectNoExecute {
+			return fmt.Sprintf("k8s node %s tainted %s (NoExecute)", node.Name, taint.Key), evictionDrainDeadline, true
+		}
+	}
+	if node.Spec.Unschedulable {
+		return fmt.Sprintf("k8s node %s cordoned", node.Name), 0, true
+	}
+	return "", 0, false
+}
+
+// podDisruption indica se Kubernetes ha deciso di togliere il Pod (eviction API, taint, preemption)
+func podDisruption(pod *corev1.Pod) (string, bool) {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.DisruptionTarget && cond.Status == corev1.ConditionTrue {
+			return fmt.Sprintf("pod %s disruption: %s", pod.Name, firstNonEmpty(cond.Reason, cond.Message)), true
+		}
+	}
+	return "", false
+}
+
+// evacuatePod chiede al controller di svuotare il nodo del Pod (una volta per Pod)
+// Il Relay Root segue il suo injection
+func (p *K8sProvisioner) evacuatePod(pod *corev1.Pod, reason string, deadline time.Duration) {
+	nodeId := pod.Labels["nodeId"]
+	if nodeId == "" || pod.DeletionTimestamp != nil {
+		return
+	}
+
+	p.mu.Lock()
+	evacuator := p.evacuator
+	if evacuator == nil || p.evacuating[nodeId] {
+		p.mu.Unlock()
+		return
+	}
+	p.evacuating[nodeId] = true
+	p.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), evacuationTimeout)
+		defer cancel()
+
+		log.Printf("[K8s] Evacuating %s: %s", nodeId, reason)
+		if err := evacuator.EvacuateNode(ctx, nodeId, reason, deadline); err != nil {
+			log.Printf("[WARN] Failed to evacuate %s: %v", nodeId, err)
+			p.clearEvacuation(nodeId) // Riprova al prossimo evento
+		}
+	}()
+}
+
+func (p *K8sProvisioner) clearEvacuation(nodeId string) {
+	p.mu.Lock()
+	delete(p.evacuating, nodeId)
+	p.mu.Unlock()
+}
+
+// ensurePodDisruptionBudget crea il PDB del nodo: l'eviction (kubectl drain) resta bloccata
+// finché il controller non ha migrato le sessioni e distrutto il Pod
+// Il PDB segue la vita dell'owner (MediaNode o Pod)
+func (p *K8sProvisioner) ensurePodDisruptionBudget(ctx context.Context, nodeId string, owner metav1.OwnerReference) error {
+	maxUnavailable := intstr.FromInt32(0)
+	alwaysAllow := policyv1.AlwaysAllow
+
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            nodeId,
+			Namespace:       p.namespace,
+			Labels:          map[string]string{"media-mesh.nodeId": nodeId},
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"media-mesh.nodeId": nodeId},
+			},
+			// Un Pod non pronto non ha sessioni da salvare: può essere evicted
+			UnhealthyPodEvictionPolicy: &alwaysAllow,
+		},
+	}
+
+	_, err := p.clientset.PolicyV1().PodDisruptionBudgets(p.namespace).Create(ctx, pdb, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create PodDisruptionBudget %s: %w", nodeId, err)
+	}
+	return nil
+}
+
+// podOwner riferimento al Pod come owner (modalità senza MediaNode)
+func podOwner(pod *corev1.Pod) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}
+}
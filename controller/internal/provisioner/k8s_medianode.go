@@ -0,0 +1,576 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"controller/internal/domain"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// CRD MediaNode (k8s/medianode-crd.yaml)
+const (
+	MediaNodeGroup    = "media-mesh.io"
+	MediaNodeVersion  = "v1alpha1"
+	MediaNodeKind     = "MediaNode"
+	MediaNodeResource = "medianodes"
+
+	mediaNodeResync      = 5 * time.Minute
+	mediaNodeSyncTimeout = 30 * time.Second
+)
+
+// Fasi riportate in status.phase
+const (
+	MediaNodePending    = "Pending"
+	MediaNodeRunning    = "Running"
+	MediaNodeFailed     = "Failed"
+	MediaNodeRecreating = "Recreating"
+)
+
+var mediaNodeGVR = schema.GroupVersionResource{
+	Group:    MediaNodeGroup,
+	Version:  MediaNodeVersion,
+	Resource: MediaNodeResource,
+}
+
+// MediaNode stato desiderato di un nodo: il reconciler ne ricava il Pod
+// Il nome coincide con il nodeId e con il nome del Pod
+type MediaNode struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MediaNodeSpec   `json:"spec"`
+	Status MediaNodeStatus `json:"status,omitempty"`
+}
+
+type MediaNodeSpec struct {
+	NodeType    string              `json:"nodeType"`
+	Role        string              `json:"role,omitempty"`
+	Profile     string              `json:"profile,omitempty"`
+	RelayRootId string              `json:"relayRootId,omitempty"`
+	MaxSlots    int                 `json:"maxSlots,omitempty"`
+	Placement   *MediaNodePlacement `json:"placement,omitempty"`
+}
+
+// MediaNodePlacement slot di porte assegnato sull'agente (solo injection/egress)
+// Resta nella spec: un Pod ricreato riusa le stesse porte
+type MediaNodePlacement struct {
+	Agent         string `json:"agent"`
+	PublicIP      string `json:"publicIp,omitempty"`
+	Slot          int    `json:"slot"`
+	APIPort       int    `json:"apiPort"`
+	WebRTCRange   string `json:"webrtcRange,omitempty"`
+	StreamRange   string `json:"streamRange,omitempty"`
+	JanusHTTPPort int    `json:"janusHttpPort,omitempty"`
+	JanusWSPort   int    `json:"janusWsPort,omitempty"`
+	RootAPIPort   int    `json:"rootApiPort,omitempty"`
+	RTPAudioPort  int    `json:"rtpAudioPort,omitempty"`
+	RTPVideoPort  int    `json:"rtpVideoPort,omitempty"`
+}
+
+type MediaNodeStatus struct {
+	Phase              string `json:"phase,omitempty"`
+	PodName            string `json:"podName,omitempty"`
+	PodIP              string `json:"podIP,omitempty"`
+	HostIP             string `json:"hostIP,omitempty"`
+	NodeName           string `json:"nodeName,omitempty"`
+	Restarts           int    `json:"restarts,omitempty"`
+	Recreations        int    `json:"recreations,omitempty"`
+	Message            string `json:"message,omitempty"`
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+}
+
+// mediaNodeOperator informer e coda di riconciliazione delle MediaNode
+type mediaNodeOperator struct {
+	client   dynamic.ResourceInterface
+	lister   cache.GenericNamespaceLister
+	queue    workqueue.TypedRateLimitingInterface[string]
+	stopCh   chan struct{}
+	mu       sync.Mutex
+	removing map[string]bool // MediaNode in cancellazione: il Pod non va ricreato
+}
+
+// placement converte lo slot nella parte di spec della MediaNode
+func (s *hostSlot) placement() *MediaNodePlacement {
+	return &MediaNodePlacement{
+		Agent:         s.Agent.Name,
+		PublicIP:      s.Agent.PublicIP,
+		Slot:          s.Index,
+		APIPort:       s.APIPort,
+		WebRTCRange:   s.WebRTC,
+		StreamRange:   s.Stream,
+		JanusHTTPPort: s.JanusHTTPPort,
+		JanusWSPort:   s.JanusWSPort,
+		RootAPIPort:   s.RootAPIPort,
+		RTPAudioPort:  s.RTPAudioPort,
+		RTPVideoPort:  s.RTPVideoPort,
+	}
+}
+
+// podTemplateData argomenti del template del Pod ricavati dalla spec
+func podTemplateData(nodeId string, spec MediaNodeSpec) map[string]any {
+	data := map[string]any{
+		"NodeId":      nodeId,
+		"NodeType":    spec.NodeType,
+		"RelayRootId": spec.RelayRootId,
+		"Role":        spec.Role,
+		// Risorse dei container (MediaNode senza profilo o con profilo rimosso: quello di default)
+		"Profile": domain.ProfileFor(spec.Profile, domain.NodeType(spec.NodeType)),
+	}
+	if pl := spec.Placement; pl != nil {
+		data["SelectedNode"] = pl.Agent
+		data["PublicIP"] = pl.PublicIP
+		data["ApiPort"] = pl.APIPort
+		data["WebRTCRange"] = pl.WebRTCRange
+		data["StreamRange"] = pl.StreamRange
+		data["JanusHTTPPort"] = pl.JanusHTTPPort
+		data["JanusWSPort"] = pl.JanusWSPort
+		data["RootApiPort"] = pl.RootAPIPort
+		data["RtpAudioPort"] = pl.RTPAudioPort
+		data["RtpVideoPort"] = pl.RTPVideoPort
+	}
+	return data
+}
+
+// startOperator avvia informer e worker delle MediaNode (modalità operator)
+// Richiede che l'osservazione dei pod sia già attiva
+func (p *K8sProvisioner) startOperator(config *rest.Config) error {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, mediaNodeResync, p.namespace, nil)
+	informer := factory.ForResource(mediaNodeGVR)
+
+	p.operator = &mediaNodeOperator{
+		client:   client.Resource(mediaNodeGVR).Namespace(p.namespace),
+		lister:   informer.Lister().ByNamespace(p.namespace),
+		queue:    workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+		stopCh:   make(chan struct{}),
+		removing: make(map[string]bool),
+	}
+
+	enqueue := func(obj any) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if meta, ok := obj.(metav1.Object); ok {
+			p.enqueueMediaNode(meta.GetName())
+		}
+	}
+	_, err = informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		UpdateFunc: func(_, obj any) { enqueue(obj) },
+		DeleteFunc: enqueue,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch medianodes: %w", err)
+	}
+
+	factory.Start(p.operator.stopCh)
+
+	synced := make(chan struct{})
+	go func() {
+		defer close(synced)
+		cache.WaitForCacheSync(p.operator.stopCh, informer.Informer().HasSynced)
+	}()
+	select {
+	case <-synced:
+	case <-time.After(mediaNodeSyncTimeout):
+		log.Printf("[WARN] MediaNode informer not synced after %v (CRD installed?), continuing in background", mediaNodeSyncTimeout)
+	}
+
+	go func() {
+		for p.processNextMediaNode() {
+		}
+	}()
+
+	log.Printf("[K8s] Operator mode: reconciling %s in %s", mediaNodeGVR.GroupResource(), p.namespace)
+	return nil
+}
+
+// stopOperator ferma informer e worker
+func (p *K8sProvisioner) stopOperator() {
+	if p.operator == nil {
+		return
+	}
+	close(p.operator.stopCh)
+	p.operator.queue.ShutDown()
+	p.operator = nil
+}
+
+func (p *K8sProvisioner) enqueueMediaNode(name string) {
+	if op := p.operator; op != nil {
+		op.queue.Add(name)
+	}
+}
+
+func (p *K8sProvisioner) processNextMediaNode() bool {
+	op := p.operator
+	if op == nil {
+		return false
+	}
+	name, shutdown := op.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer op.queue.Done(name)
+
+	if err := p.reconcileMediaNode(name); err != nil {
+		log.Printf("[WARN] Reconcile of MediaNode %s failed: %v", name, err)
+		op.queue.AddRateLimited(name)
+		return true
+	}
+	op.queue.Forget(name)
+	return true
+}
+
+// createMediaNode registra lo stato desiderato: il Pod lo crea il reconciler
+func (p *K8sProvisioner) createMediaNode(ctx context.Context, nodeId string, spec MediaNodeSpec) error {
+	mn := &MediaNode{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: MediaNodeGroup + "/" + MediaNodeVersion,
+			Kind:       MediaNodeKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nodeId,
+			Namespace: p.namespace,
+			Labels: map[string]string{
+				"type":              spec.NodeType,
+				"media-mesh.nodeId": nodeId,
+			},
+		},
+		Spec: spec,
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(mn)
+	if err != nil {
+		return fmt.Errorf("failed to encode MediaNode %s: %w", nodeId, err)
+	}
+	if _, err := p.operator.client.Create(ctx, &unstructured.Unstructured{Object: obj}, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create MediaNode %s: %w", nodeId, err)
+	}
+	log.Printf("[K8s] MediaNode %s created (%s)", nodeId, spec.NodeType)
+	return nil
+}
+
+// deleteMediaNode cancella la MediaNode: il reconciler smette di ricreare il Pod
+func (p *K8sProvisioner) deleteMediaNode(ctx context.Context, name string) error {
+	op := p.operator
+	op.mu.Lock()
+	op.removing[name] = true
+	op.mu.Unlock()
+
+	err := op.client.Delete(ctx, name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// removeWorkload cancella MediaNode (in modalità operator) e Pod del nodo
+func (p *K8sProvisioner) removeWorkload(ctx context.Context, name string) error {
+	if p.operator != nil {
+		if err := p.deleteMediaNode(ctx, name); err != nil {
+			log.Printf("[WARN] Failed to delete MediaNode %s: %v", name, err)
+		}
+	}
+	err := p.deletePod(ctx, name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// mediaNodeNames nomi delle MediaNode in cache (nil fuori dalla modalità operator)
+func (p *K8sProvisioner) mediaNodeNames() []string {
+	op := p.operator
+	if op == nil {
+		return nil
+	}
+	objs, err := op.lister.List(labels.Everything())
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		if meta, ok := obj.(metav1.Object); ok {
+			names = append(names, meta.GetName())
+		}
+	}
+	return names
+}
+
+// reconcileMediaNode porta il Pod della MediaNode allo stato desiderato e aggiorna lo status
+// Pod assente: creato (o ricreato, riportando il nodo in registering)
+// Pod fallito o evicted: cancellato, il prossimo giro lo ricrea
+func (p *K8sProvisioner) reconcileMediaNode(name string) error {
+	op := p.operator
+	watcher := p.pods
+	if op == nil || watcher == nil {
+		return nil
+	}
+
+	obj, err := op.lister.Get(name)
+	if apierrors.IsNotFound(err) {
+		op.mu.Lock()
+		delete(op.removing, name)
+		op.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unexpected object %T", obj)
+	}
+	var mn MediaNode
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &mn); err != nil {
+		return fmt.Errorf("invalid MediaNode %s: %w", name, err)
+	}
+
+	op.mu.Lock()
+	removing := op.removing[name]
+	op.mu.Unlock()
+	if removing || mn.DeletionTimestamp != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), podEventTimeout)
+	defer cancel()
+
+	status := mn.Status
+	status.ObservedGeneration = mn.Generation
+	status.PodName = name
+
+	pod, err := watcher.pods.Pods(p.namespace).Get(name)
+	switch {
+	case apierrors.IsNotFound(err):
+		// Agente cordonato o sparito: il Pod verrebbe vincolato a un host che non lo ospiterà
+		if pl := mn.Spec.Placement; pl != nil && !p.agentAvailable(pl.Agent) {
+			if u, err = p.replaceMediaNodePlacement(ctx, u, &mn); err != nil {
+				return err
+			}
+		}
+
+		created, err := p.createMediaNodePod(ctx, &mn)
+		if err != nil {
+			return err
+		}
+		if !created {
+			return nil // Pod non ancora nella cache: arriverà il suo evento
+		}
+		status.Phase = MediaNodePending
+		status.PodIP, status.HostIP, status.Restarts = "", "", 0
+		if mn.Status.Phase != "" {
+			status.Phase = MediaNodeRecreating
+			status.Recreations++
+			p.recoverMediaNode(ctx, &mn)
+		}
+
+	case err != nil:
+		return err
+
+	default:
+		status.PodIP = pod.Status.PodIP
+		status.HostIP = pod.Status.HostIP
+		status.NodeName = pod.Spec.NodeName
+		status.Restarts = podRestarts(pod)
+		status.Message = ""
+
+		if cause, reason := podFailure(pod); cause != "" && cause != podCauseDeleted {
+			status.Phase = MediaNodeFailed
+			status.Message = cause + ": " + reason
+			// Un Pod fallito non riparte da solo: lo si cancella e il giro successivo lo ricrea
+			log.Printf("[K8s] MediaNode %s: pod %s (%s), recreating", name, cause, reason)
+			if err := p.clientset.CoreV1().Pods(p.namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete failed pod %s: %w", name, err)
+			}
+		} else if podReady(pod) {
+			if mn.Status.Phase == MediaNodeRecreating {
+				p.syncNodePlacement(ctx, &mn, pod.Status.HostIP)
+			}
+			status.Phase = MediaNodeRunning
+		} else if pod.DeletionTimestamp == nil && status.Phase != MediaNodeRecreating {
+			status.Phase = MediaNodePending
+		}
+	}
+
+	return p.updateMediaNodeStatus(ctx, u, mn.Status, status)
+}
+
+// createMediaNodePod crea il Pod dal template con la MediaNode come owner
+// Ritorna false se il Pod esiste già
+func (p *K8sProvisioner) createMediaNodePod(ctx context.Context, mn *MediaNode) (bool, error) {
+	pod, err := renderPod(domain.NodeType(mn.Spec.NodeType), podTemplateData(mn.Name, mn.Spec))
+	if err != nil {
+		return false, err
+	}
+
+	isController := true
+	owner := metav1.OwnerReference{
+		APIVersion:         MediaNodeGroup + "/" + MediaNodeVersion,
+		Kind:               MediaNodeKind,
+		Name:               mn.Name,
+		UID:                mn.UID,
+		Controller:         &isController,
+		BlockOwnerDeletion: &isController,
+	}
+	pod.OwnerReferences = []metav1.OwnerReference{owner}
+
+	// Il PDB appartiene alla MediaNode: sopravvive alla ricreazione del Pod
+	if err := p.ensurePodDisruptionBudget(ctx, mn.Name, owner); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+
+	_, err = p.clientset.CoreV1().Pods(p.namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("k8s creation failed: %w", err)
+	}
+	log.Printf("[K8s] MediaNode %s: pod created on %s", mn.Name, firstNonEmpty(pod.Spec.NodeSelector["kubernetes.io/hostname"], "any node"))
+	return true, nil
+}
+
+// agentAvailable indica se l'agente è tra quelli schedulabili
+func (p *K8sProvisioner) agentAvailable(name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.agents[name]
+	return ok
+}
+
+// replaceMediaNodePlacement riserva uno slot su un altro agente e lo scrive nella spec
+// Host e porte in Redis vengono aggiornati quando il Pod ricreato è pronto
+func (p *K8sProvisioner) replaceMediaNodePlacement(ctx context.Context, u *unstructured.Unstructured, mn *MediaNode) (*unstructured.Unstructured, error) {
+	previous := mn.Spec.Placement.Agent
+	p.redisClient.ReleaseHostSlot(ctx, mn.Name)
+
+	slot, err := p.allocateSlot(ctx, domain.NodeSpec{
+		NodeId:   mn.Name,
+		NodeType: domain.NodeType(mn.Spec.NodeType),
+		Profile:  mn.Spec.Profile,
+		MaxSlots: mn.Spec.MaxSlots,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("MediaNode %s: agent %s unavailable: %w", mn.Name, previous, err)
+	}
+
+	placement, err := runtime.DefaultUnstructuredConverter.ToUnstructured(slot.placement())
+	if err != nil {
+		p.redisClient.ReleaseHostSlot(ctx, mn.Name)
+		return nil, err
+	}
+	updated := u.DeepCopy()
+	if err := unstructured.SetNestedMap(updated.Object, placement, "spec", "placement"); err != nil {
+		p.redisClient.ReleaseHostSlot(ctx, mn.Name)
+		return nil, err
+	}
+	result, err := p.operator.client.Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		p.redisClient.ReleaseHostSlot(ctx, mn.Name)
+		return nil, fmt.Errorf("failed to update placement of MediaNode %s: %w", mn.Name, err)
+	}
+
+	mn.Spec.Placement = slot.placement()
+	log.Printf("[K8s] MediaNode %s: agent %s unavailable, moved to %s (slot %d)", mn.Name, previous, slot.Agent.Name, slot.Index)
+	return result, nil
+}
+
+// syncNodePlacement allinea host e porte in Redis allo slot della spec (injection + relay root)
+// Un Pod ricreato su un altro agente cambia host e porte
+func (p *K8sProvisioner) syncNodePlacement(ctx context.Context, mn *MediaNode, hostIP string) {
+	pl := mn.Spec.Placement
+	if pl == nil {
+		return
+	}
+
+	if info, err := p.redisClient.GetNodeProvisioning(ctx, mn.Name); err == nil && info != nil {
+		info.InternalHost = hostIP
+		info.InternalAPIPort = pl.APIPort
+		info.ExternalAPIPort = pl.APIPort
+		info.JanusHTTPPort = pl.JanusHTTPPort
+		info.JanusWSPort = pl.JanusWSPort
+		info.WebRTCPortStart, info.WebRTCPortEnd, _ = parsePortRange(pl.WebRTCRange)
+		if info.NodeType == domain.NodeTypeEgress {
+			info.InternalRTPAudio = pl.RTPAudioPort
+			info.InternalRTPVideo = pl.RTPVideoPort
+			info.StreamPortStart, info.StreamPortEnd, _ = parsePortRange(pl.StreamRange)
+		}
+		if err := p.redisClient.SaveNodeProvisioning(ctx, info); err != nil {
+			log.Printf("[WARN] Node %s: failed to update placement: %v", mn.Name, err)
+		}
+	}
+
+	if mn.Spec.RelayRootId == "" {
+		return
+	}
+	if root, err := p.redisClient.GetNodeProvisioning(ctx, mn.Spec.RelayRootId); err == nil && root != nil {
+		root.InternalHost = hostIP
+		root.InternalAPIPort = pl.RootAPIPort
+		root.InternalRTPAudio = pl.RTPAudioPort
+		root.InternalRTPVideo = pl.RTPVideoPort
+		if err := p.redisClient.SaveNodeProvisioning(ctx, root); err != nil {
+			log.Printf("[WARN] Node %s: failed to update placement: %v", root.NodeId, err)
+		}
+	}
+}
+
+// recoverMediaNode riporta in registering i nodi del Pod ricreato (injection + relay root)
+func (p *K8sProvisioner) recoverMediaNode(ctx context.Context, mn *MediaNode) {
+	for _, nodeId := range []string{mn.Name, mn.Spec.RelayRootId} {
+		if nodeId == "" {
+			continue
+		}
+		if err := p.redisClient.RecoverNodeLifecycle(ctx, nodeId, "k8s", "pod recreated by operator"); err != nil {
+			log.Printf("[WARN] Node %s: %v", nodeId, err)
+		}
+	}
+}
+
+// updateMediaNodeStatus scrive il subresource status solo se cambiato
+func (p *K8sProvisioner) updateMediaNodeStatus(ctx context.Context, u *unstructured.Unstructured, old, status MediaNodeStatus) error {
+	if reflect.DeepEqual(old, status) {
+		return nil
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+
+	updated := u.DeepCopy()
+	updated.Object["status"] = obj
+	if _, err := p.operator.client.UpdateStatus(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update status of MediaNode %s: %w", u.GetName(), err)
+	}
+	return nil
+}
+
+// podRestarts somma i riavvii dei container del Pod
+func podRestarts(pod *corev1.Pod) int {
+	total := 0
+	for _, c := range pod.Status.ContainerStatuses {
+		total += int(c.RestartCount)
+	}
+	return total
+}
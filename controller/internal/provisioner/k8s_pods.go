@@ -0,0 +1,391 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"controller/internal/domain"
+	"controller/internal/redis"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	mediaPodSelector = "app in (injection-pod, egress-pod, relay-pod)"
+	podReadyTimeout  = 120 * time.Second
+	podResync        = 5 * time.Minute
+	podEventTimeout  = 5 * time.Second
+)
+
+// Cause di guasto riportate negli eventi
+const (
+	podCauseFailed    = "failed"
+	podCauseOOMKilled = "oom-killed"
+	podCauseEvicted   = "evicted"
+	podCauseDeleted   = "deleted"
+	podCauseRestarted = "restarted"
+)
+
+// podWatcher informer sui pod del media tree
+// Risolve le attese di readiness e rileva guasti, riavvii, eviction e cancellazioni
+type podWatcher struct {
+	pods     listersv1.PodLister
+	stopCh   chan struct{}
+	mu       sync.Mutex
+	waiters  map[string][]chan podResult // Pod -> attese di waitForPodReady
+	expected map[string]bool             // Pod cancellati dal controller: non sono guasti
+}
+
+type podResult struct {
+	pod *corev1.Pod
+	err error
+}
+
+// startPodWatch avvia l'informer sui pod injection, egress e relay
+func (p *K8sProvisioner) startPodWatch() error {
+	factory := informers.NewSharedInformerFactoryWithOptions(p.clientset, podResync,
+		informers.WithNamespace(p.namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = mediaPodSelector
+		}))
+	podInformer := factory.Core().V1().Pods()
+
+	p.pods = &podWatcher{
+		pods:     podInformer.Lister(),
+		stopCh:   make(chan struct{}),
+		waiters:  make(map[string][]chan podResult),
+		expected: make(map[string]bool),
+	}
+
+	_, err := podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		// In modalità operator ogni evento riconcilia anche la MediaNode del Pod (stesso nome)
+		AddFunc: func(obj any) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				p.onPodChange(nil, pod)
+				p.enqueueMediaNode(pod.Name)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			old, _ := oldObj.(*corev1.Pod)
+			if pod, ok := newObj.(*corev1.Pod); ok {
+				p.onPodChange(old, pod)
+				p.enqueueMediaNode(pod.Name)
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				p.onPodDeleted(pod)
+				p.enqueueMediaNode(pod.Name)
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch media pods: %w", err)
+	}
+
+	factory.Start(p.pods.stopCh)
+	log.Printf("[K8s] Pod watch started (selector: %s)", mediaPodSelector)
+	return nil
+}
+
+// stopPodWatch ferma l'informer e sblocca le attese in corso
+func (p *K8sProvisioner) stopPodWatch() {
+	if p.pods == nil {
+		return
+	}
+	close(p.pods.stopCh)
+	p.pods.mu.Lock()
+	for name := range p.pods.waiters {
+		p.pods.notifyLocked(name, podResult{err: errors.New("pod watch stopped")})
+	}
+	p.pods.mu.Unlock()
+	p.pods = nil
+}
+
+// waitForPodReady aspetta che K8s assegni un IP al Pod (eventi dell'informer, nessun polling)
+// Ritorna subito un errore se il pod fallisce o viene cancellato durante l'attesa
+func (p *K8sProvisioner) waitForPodReady(ctx context.Context, name string) (*corev1.Pod, error) {
+	watcher := p.pods
+	ch := watcher.wait(name)
+	defer watcher.cancel(name, ch)
+
+	// Il pod potrebbe essere già pronto prima della registrazione dell'attesa
+	if pod, err := watcher.pods.Pods(p.namespace).Get(name); err == nil {
+		if podReady(pod) {
+			return pod, nil
+		}
+		if cause, reason := podFailure(pod); cause != "" {
+			return nil, fmt.Errorf("pod %s %s: %s", name, cause, reason)
+		}
+	}
+
+	timer := time.NewTimer(podReadyTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-ch:
+		return res.pod, res.err
+	case <-timer.C:
+		return nil, fmt.Errorf("pod %s failed to become ready (timeout)", name)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// deletePod cancella il pod segnandolo come atteso: l'informer non lo tratta come guasto
+func (p *K8sProvisioner) deletePod(ctx context.Context, name string) error {
+	watcher := p.pods
+	if watcher == nil {
+		return p.clientset.CoreV1().Pods(p.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	}
+
+	watcher.mu.Lock()
+	watcher.expected[name] = true
+	watcher.mu.Unlock()
+
+	err := p.clientset.CoreV1().Pods(p.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil {
+		// Nessun evento di cancellazione in arrivo
+		watcher.mu.Lock()
+		delete(watcher.expected, name)
+		watcher.mu.Unlock()
+	}
+	return err
+}
+
+func (w *podWatcher) wait(name string) chan podResult {
+	ch := make(chan podResult, 1)
+	w.mu.Lock()
+	w.waiters[name] = append(w.waiters[name], ch)
+	w.mu.Unlock()
+	return ch
+}
+
+func (w *podWatcher) cancel(name string, ch chan podResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	waiters := w.waiters[name]
+	for i, waiter := range waiters {
+		if waiter == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(w.waiters, name)
+	} else {
+		w.waiters[name] = waiters
+	}
+}
+
+func (w *podWatcher) notify(name string, res podResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.notifyLocked(name, res)
+}
+
+func (w *podWatcher) notifyLocked(name string, res podResult) {
+	for _, ch := range w.waiters[name] {
+		ch <- res // Buffer 1, una sola notifica per attesa
+	}
+	delete(w.waiters, name)
+}
+
+func (w *podWatcher) isExpected(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.expected[name]
+}
+
+// onPodChange gestisce creazione e aggiornamento di un pod
+func (p *K8sProvisioner) onPodChange(old, pod *corev1.Pod) {
+	watcher := p.pods
+	if watcher == nil {
+		return
+	}
+
+	// Eviction decisa da Kubernetes: le sessioni vanno spostate prima che il Pod sparisca
+	if reason, disrupted := podDisruption(pod); disrupted {
+		p.evacuatePod(pod, reason, evictionDrainDeadline)
+	}
+
+	if cause, reason := podFailure(pod); cause != "" {
+		watcher.notify(pod.Name, podResult{err: fmt.Errorf("pod %s %s: %s", pod.Name, cause, reason)})
+		if cause == podCauseDeleted && watcher.isExpected(pod.Name) {
+			return
+		}
+		p.handlePodFailure(pod, cause, reason)
+		return
+	}
+
+	if podReady(pod) {
+		watcher.notify(pod.Name, podResult{pod: pod})
+	}
+
+	if old != nil {
+		for _, container := range restartedContainers(old, pod) {
+			p.handleContainerRestart(pod, container)
+		}
+	}
+}
+
+// onPodDeleted gestisce la rimozione definitiva di un pod
+func (p *K8sProvisioner) onPodDeleted(pod *corev1.Pod) {
+	watcher := p.pods
+	if watcher == nil {
+		return
+	}
+
+	watcher.notify(pod.Name, podResult{err: fmt.Errorf("pod %s deleted", pod.Name)})
+	p.clearEvacuation(pod.Labels["nodeId"])
+
+	watcher.mu.Lock()
+	expected := watcher.expected[pod.Name]
+	delete(watcher.expected, pod.Name)
+	watcher.mu.Unlock()
+
+	if !expected {
+		p.handlePodFailure(pod, podCauseDeleted, "pod deleted outside the controller")
+	}
+}
+
+// handlePodFailure porta in failed i nodi del pod (injection + relay root) e pubblica il guasto
+// Nodi già in distruzione o senza stato sono ignorati
+func (p *K8sProvisioner) handlePodFailure(pod *corev1.Pod, cause, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), podEventTimeout)
+	defer cancel()
+
+	for _, nodeId := range podNodeIds(pod) {
+		prev, err := p.redisClient.TransitionNodeStatus(ctx, nodeId, redis.NodeStatusFailed, "k8s", cause+": "+reason)
+		if err != nil {
+			if !errors.Is(err, redis.ErrInvalidTransition) {
+				log.Printf("[WARN] Failed to mark %s as failed: %v", nodeId, err)
+			}
+			continue
+		}
+		if prev == redis.NodeStatusFailed {
+			continue // Già segnalato
+		}
+
+		log.Printf("[K8s] Node %s failed (%s: %s), was %s", nodeId, cause, reason, prev)
+		p.redisClient.PublishNodeFailure(ctx, redis.NodeFailureEvent{
+			Type:     redis.NodeEventFailed,
+			NodeId:   nodeId,
+			NodeType: podNodeType(pod, nodeId),
+			Cause:    cause,
+			Reason:   reason,
+			Previous: prev,
+		})
+	}
+}
+
+// handleContainerRestart segnala il riavvio di un container: il nodo si riregistra da solo
+// ma ha perso le sessioni in memoria, lo stato non cambia
+func (p *K8sProvisioner) handleContainerRestart(pod *corev1.Pod, container corev1.ContainerStatus) {
+	ctx, cancel := context.WithTimeout(context.Background(), podEventTimeout)
+	defer cancel()
+
+	// Il container relay-root appartiene al Relay Root, gli altri al nodo del pod
+	nodeId := pod.Labels["nodeId"]
+	if nodeId == "" {
+		return
+	}
+	if container.Name == "relay-root" && pod.Labels["relay-root-id"] != "" {
+		nodeId = pod.Labels["relay-root-id"]
+	}
+
+	status, _ := p.redisClient.GetNodeStatus(ctx, nodeId)
+	switch status {
+	case "", redis.NodeStatusProvisioning, redis.NodeStatusDestroying, redis.NodeStatusGone, redis.NodeStatusFailed:
+		return
+	}
+
+	reason := fmt.Sprintf("container %s restarted (%d restarts)", container.Name, container.RestartCount)
+	cause := podCauseRestarted
+	if term := container.LastTerminationState.Terminated; term != nil {
+		reason = fmt.Sprintf("%s, last exit: %s (code %d)", reason, term.Reason, term.ExitCode)
+		if term.Reason == "OOMKilled" {
+			cause = podCauseOOMKilled
+		}
+	}
+
+	log.Printf("[WARN] Node %s: %s", nodeId, reason)
+	p.redisClient.PublishNodeFailure(ctx, redis.NodeFailureEvent{
+		Type:     redis.NodeEventRestarted,
+		NodeId:   nodeId,
+		NodeType: podNodeType(pod, nodeId),
+		Cause:    cause,
+		Reason:   reason,
+		Previous: status,
+	})
+}
+
+// podReady pod in esecuzione con IP assegnato
+func podReady(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodRunning && pod.Status.PodIP != "" && pod.DeletionTimestamp == nil
+}
+
+// podFailure ritorna causa e dettaglio se il pod non tornerà a servire ("" se sano)
+func podFailure(pod *corev1.Pod) (string, string) {
+	if pod.Status.Reason == "Evicted" {
+		return podCauseEvicted, pod.Status.Message
+	}
+	if pod.Status.Phase == corev1.PodFailed {
+		for _, c := range pod.Status.ContainerStatuses {
+			if term := c.State.Terminated; term != nil && term.Reason == "OOMKilled" {
+				return podCauseOOMKilled, fmt.Sprintf("container %s OOMKilled", c.Name)
+			}
+		}
+		return podCauseFailed, firstNonEmpty(pod.Status.Message, pod.Status.Reason, "pod phase Failed")
+	}
+	if pod.DeletionTimestamp != nil {
+		return podCauseDeleted, "pod terminating"
+	}
+	return "", ""
+}
+
+// restartedContainers container il cui contatore di riavvii è aumentato
+func restartedContainers(old, pod *corev1.Pod) []corev1.ContainerStatus {
+	previous := make(map[string]int32, len(old.Status.ContainerStatuses))
+	for _, c := range old.Status.ContainerStatuses {
+		previous[c.Name] = c.RestartCount
+	}
+
+	var restarted []corev1.ContainerStatus
+	for _, c := range pod.Status.ContainerStatuses {
+		if count, ok := previous[c.Name]; ok && c.RestartCount > count {
+			restarted = append(restarted, c)
+		}
+	}
+	return restarted
+}
+
+// podNodeIds nodi ospitati dal pod: il pod injection contiene anche il Relay Root
+func podNodeIds(pod *corev1.Pod) []string {
+	var ids []string
+	if nodeId := pod.Labels["nodeId"]; nodeId != "" {
+		ids = append(ids, nodeId)
+	}
+	if root := pod.Labels["relay-root-id"]; root != "" {
+		ids = append(ids, root)
+	}
+	return ids
+}
+
+func podNodeType(pod *corev1.Pod, nodeId string) string {
+	if nodeId != pod.Labels["nodeId"] {
+		return string(domain.NodeTypeRelay) // Relay Root del pod injection
+	}
+	return pod.Labels["type"]
+}
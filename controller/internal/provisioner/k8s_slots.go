@@ -0,0 +1,217 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"text/template"
+
+	"controller/internal/domain"
+	"controller/internal/redis"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// Ogni host è diviso in slot: ogni pod injection/egress occupa uno slot con
+// una porta API, una fetta dei range WebRTC e streaming e un blocco di porte interne
+const (
+	servicePortsPerSlot   = 8
+	minWebRTCPortsPerSlot = 10
+	minStreamPortsPerSlot = 20
+)
+
+// Offset nel blocco di porte interne dello slot (hostNetwork: niente porte fisse)
+const (
+	slotOffsetJanusHTTP = 0
+	slotOffsetJanusWS   = 1
+	slotOffsetRootAPI   = 2
+	slotOffsetRTPAudio  = 4 // +1 RTCP
+	slotOffsetRTPVideo  = 6 // +1 RTCP
+)
+
+// hostSlot porte assegnate a un pod su un agente
+type hostSlot struct {
+	Agent         AgentConfig
+	Index         int
+	APIPort       int
+	WebRTC        string
+	Stream        string
+	JanusHTTPPort int
+	JanusWSPort   int
+	RootAPIPort   int
+	RTPAudioPort  int
+	RTPVideoPort  int
+}
+
+// slotCount quanti pod può ospitare l'agente in base ai range di porte
+func (a AgentConfig) slotCount() int {
+	slots := rangeSize(a.APIPorts)
+	slots = min(slots, rangeSize(a.ServicePorts)/servicePortsPerSlot)
+	slots = min(slots, rangeSize(a.WebRTC)/minWebRTCPortsPerSlot)
+	slots = min(slots, rangeSize(a.Stream)/minStreamPortsPerSlot)
+	return slots
+}
+
+func (a AgentConfig) budget() redis.HostBudget {
+	return redis.HostBudget{
+		Slots:         a.slotCount(),
+		CPUMilli:      a.CPUMilli,
+		BandwidthMbps: a.BandwidthMbps,
+	}
+}
+
+// slot calcola le porte dello slot index: i range sono divisi in parti uguali
+func (a AgentConfig) slot(index int) hostSlot {
+	slots := a.slotCount()
+	apiStart, _, _ := parsePortRange(a.APIPorts)
+	serviceStart, _, _ := parsePortRange(a.ServicePorts)
+	base := serviceStart + index*servicePortsPerSlot
+
+	return hostSlot{
+		Agent:         a,
+		Index:         index,
+		APIPort:       apiStart + index,
+		WebRTC:        subRange(a.WebRTC, index, slots),
+		Stream:        subRange(a.Stream, index, slots),
+		JanusHTTPPort: base + slotOffsetJanusHTTP,
+		JanusWSPort:   base + slotOffsetJanusWS,
+		RootAPIPort:   base + slotOffsetRootAPI,
+		RTPAudioPort:  base + slotOffsetRTPAudio,
+		RTPVideoPort:  base + slotOffsetRTPVideo,
+	}
+}
+
+// allocateSlot sceglie un agente con slot, CPU e banda liberi e vi riserva uno slot su Redis
+// Gli agenti sono riempiti in ordine di nome prima di passare al successivo
+func (p *K8sProvisioner) allocateSlot(ctx context.Context, spec domain.NodeSpec) (*hostSlot, error) {
+	cpuMilli, err := p.podCPURequest(spec)
+	if err != nil {
+		return nil, err
+	}
+	// Banda stimata dal profilo: l'egress serve fino a MaxViewers viewer
+	bandwidth := domain.ProfileFor(spec.Profile, spec.NodeType).BandwidthMbps
+
+	live := p.liveMediaPods(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var lastErr error
+	for _, name := range p.agentNames() {
+		agent := p.agents[name]
+		p.pruneHostSlots(ctx, name, live)
+
+		index, err := p.redisClient.AllocateHostSlot(ctx, name, spec.NodeId, agent.budget(), cpuMilli, bandwidth)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		slot := agent.slot(index)
+		log.Printf("[K8s] Slot %d on %s reserved for %s (API %d, WebRTC %s)", index, name, spec.NodeId, slot.APIPort, slot.WebRTC)
+		return &slot, nil
+	}
+
+	if lastErr == nil {
+		return nil, fmt.Errorf("no physical agents available (%d discovered)", len(p.agents))
+	}
+	return nil, fmt.Errorf("no physical agents available (%d discovered): %w", len(p.agents), lastErr)
+}
+
+// pruneHostSlots libera gli slot di pod che non esistono più (crash del controller, pod rimossi a mano)
+// I pod in creazione non sono ancora visibili: restano riservati
+func (p *K8sProvisioner) pruneHostSlots(ctx context.Context, host string, live map[string]bool) {
+	if live == nil {
+		return
+	}
+	allocations, _ := p.redisClient.GetHostAllocations(ctx, host)
+	for _, alloc := range allocations {
+		if live[alloc.NodeId] || p.inflight[alloc.NodeId] {
+			continue
+		}
+		log.Printf("[K8s] Releasing stale slot %d on %s (pod %s gone)", alloc.Slot, host, alloc.NodeId)
+		p.redisClient.ReleaseHostSlot(ctx, alloc.NodeId)
+	}
+}
+
+// liveMediaPods pod injection/egress esistenti e MediaNode (nil se la lista fallisce: nessuna pulizia)
+func (p *K8sProvisioner) liveMediaPods(ctx context.Context) map[string]bool {
+	pods, err := p.clientset.CoreV1().Pods(p.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app in (injection-pod, egress-pod)",
+	})
+	if err != nil {
+		log.Printf("[WARN] Failed to list media pods: %v", err)
+		return nil
+	}
+
+	live := make(map[string]bool, len(pods.Items))
+	for _, pod := range pods.Items {
+		live[pod.Name] = true
+	}
+	// Una MediaNode senza Pod (in ricreazione) conserva il suo slot
+	for _, name := range p.mediaNodeNames() {
+		live[name] = true
+	}
+	return live
+}
+
+// podCPURequest somma le richieste CPU dei container del template renderizzato con il profilo del nodo
+func (p *K8sProvisioner) podCPURequest(spec domain.NodeSpec) (int64, error) {
+	pod, err := renderPod(spec.NodeType, podTemplateData(spec.NodeId, MediaNodeSpec{
+		NodeType: string(spec.NodeType),
+		Profile:  spec.Profile,
+	}))
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, c := range pod.Spec.Containers {
+		total += c.Resources.Requests.Cpu().MilliValue()
+	}
+	return total, nil
+}
+
+// renderPod esegue il template del tipo di nodo e lo decodifica in un Pod
+func renderPod(nodeType domain.NodeType, data map[string]any) (*corev1.Pod, error) {
+	tmpl, err := template.ParseFS(templateFS, "templates/"+string(nodeType)+".yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	// Decode YAML -> Oggetto Kubernetes Pod
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	obj, _, err := decode(buf.Bytes(), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode yaml: %w", err)
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, fmt.Errorf("template %s is not a Pod", nodeType)
+	}
+	return pod, nil
+}
+
+// rangeSize numero di porte del range (0 se non valido)
+func rangeSize(value string) int {
+	start, end, err := parsePortRange(value)
+	if err != nil {
+		return 0
+	}
+	return end - start + 1
+}
+
+// subRange parte index di parts del range
+func subRange(value string, index, parts int) string {
+	start, _, _ := parsePortRange(value)
+	size := rangeSize(value) / parts
+	from := start + index*size
+	return fmt.Sprintf("%d-%d", from, from+size-1)
+}
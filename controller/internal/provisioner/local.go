@@ -0,0 +1,571 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"controller/internal/domain"
+	"controller/internal/redis"
+)
+
+const localJanusTimeout = 60 * time.Second
+
+// Processi di un nodo locale (nomi dei file di log in RunDir/{nodeId})
+const (
+	localProcessNode  = "node"
+	localProcessJanus = "janus"
+	localProcessRoot  = "root" // Relay Root che accompagna l'injection
+)
+
+// LocalConfig percorsi del backend local-process
+type LocalConfig struct {
+	MeshDir         string // Checkout del repository: *-node e janus-*/config
+	RunDir          string // Config Janus e log, una cartella per nodo
+	NodeBin         string // Eseguibile Node.js
+	JanusPrefix     string // Installazione Janus (bin/janus, lib/janus/...)
+	RelayForwarder  string // Binario relay-forwarder (vuoto = relay-node/forwarder)
+	EgressForwarder string // Binario egress-forwarder (vuoto = egress-node/forwarder)
+	Host            string // Indirizzo su cui rispondono i nodi
+	RedisHost       string
+	RedisPort       int
+}
+
+// LocalProvisioner avvia i processi dei nodi direttamente sull'host, senza container
+// Pensato per lo sviluppo: un'intera mesh su una sola macchina Linux
+type LocalProvisioner struct {
+	cfg           LocalConfig
+	portAllocator *PortAllocator
+	redisClient   *redis.Client
+	httpClient    *http.Client
+	mu            sync.Mutex
+	nodes         map[string]*localNode
+}
+
+// localNode processi e porte di un nodo (l'injection porta con sé il suo Relay Root)
+type localNode struct {
+	nodeId    string
+	rootId    string
+	dir       string
+	janusHTTP int
+	mu        sync.Mutex // processes: letto anche dai callback di supervisione
+	processes map[string]*localProcess
+	ports     []int
+	ranges    [][2]int
+}
+
+// NewLocalProvisioner verifica i percorsi e deregistra i nodi locali di un controller precedente
+// (i loro processi sono terminati insieme a lui)
+func NewLocalProvisioner(cfg LocalConfig, redisClient *redis.Client) (*LocalProvisioner, error) {
+	if cfg.Host == "" {
+		cfg.Host = "127.0.0.1"
+	}
+	meshDir, err := filepath.Abs(cfg.MeshDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mesh dir %q: %w", cfg.MeshDir, err)
+	}
+	cfg.MeshDir = meshDir
+
+	// I nodi girano nella cartella del proprio tier: i percorsi relativi non valgono
+	if cfg.RelayForwarder == "" {
+		cfg.RelayForwarder = filepath.Join(meshDir, "relay-node", "forwarder", "relay-forwarder")
+	}
+	if cfg.EgressForwarder == "" {
+		cfg.EgressForwarder = filepath.Join(meshDir, "egress-node", "forwarder", "egress-forwarder")
+	}
+	cfg.RelayForwarder, _ = filepath.Abs(cfg.RelayForwarder)
+	cfg.EgressForwarder, _ = filepath.Abs(cfg.EgressForwarder)
+	cfg.RunDir, _ = filepath.Abs(cfg.RunDir)
+	for _, dir := range []string{"injection-node", "relay-node", "egress-node"} {
+		if _, err := os.Stat(filepath.Join(meshDir, dir, "src", "index.js")); err != nil {
+			return nil, fmt.Errorf("mesh dir %s: missing %s: %w", meshDir, dir, err)
+		}
+	}
+	if err := os.MkdirAll(cfg.RunDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create run dir: %w", err)
+	}
+
+	p := &LocalProvisioner{
+		cfg:           cfg,
+		portAllocator: HostPortAllocator(),
+		redisClient:   redisClient,
+		httpClient:    &http.Client{Timeout: 2 * time.Second},
+		nodes:         make(map[string]*localNode),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	provisioned, _ := redisClient.GetAllProvisionedNodes(ctx)
+	for _, info := range provisioned {
+		if info.Backend == BackendLocalProcess {
+			log.Printf("[Local] Node %s lost its processes with the previous controller, removing it", info.NodeId)
+			p.DestroyNode(ctx, info)
+		}
+	}
+
+	log.Printf("[Local] Provisioner ready (mesh %s, logs %s)", meshDir, cfg.RunDir)
+	return p, nil
+}
+
+func (p *LocalProvisioner) CreateNode(ctx context.Context, spec domain.NodeSpec, role string) (*domain.NodeInfo, error) {
+	switch spec.NodeType {
+	case domain.NodeTypeInjection, domain.NodeTypeRelay, domain.NodeTypeEgress:
+	default:
+		return nil, fmt.Errorf("unknown node type: %s", spec.NodeType)
+	}
+
+	// Gli ID vengono riusati: log e config del nodo precedente vanno via
+	dir := filepath.Join(p.cfg.RunDir, spec.NodeId)
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create node dir: %w", err)
+	}
+
+	node := &localNode{
+		nodeId:    spec.NodeId,
+		dir:       dir,
+		processes: make(map[string]*localProcess),
+	}
+	infos, err := p.launch(ctx, node, spec, role)
+	if err != nil {
+		p.teardown(node)
+		return nil, err
+	}
+
+	for _, info := range infos {
+		if err := p.redisClient.SaveNodeProvisioning(ctx, info); err != nil {
+			p.teardown(node)
+			return nil, fmt.Errorf("failed to save provisioning to Redis: %w", err)
+		}
+	}
+
+	p.mu.Lock()
+	p.nodes[spec.NodeId] = node
+	p.mu.Unlock()
+
+	log.Printf("[Local] Provisioned %s on %s:%d (logs in %s)", spec.NodeId, p.cfg.Host, infos[0].InternalAPIPort, dir)
+	return infos[0], nil
+}
+
+// launch alloca le porte e avvia Janus (injection/egress), il nodo e l'eventuale Relay Root
+func (p *LocalProvisioner) launch(ctx context.Context, node *localNode, spec domain.NodeSpec, role string) ([]*domain.NodeInfo, error) {
+	info, env, err := p.nodeInfo(node, spec.NodeId, spec.NodeType, role, spec.MaxSlots)
+	if err != nil {
+		return nil, err
+	}
+	// Del profilo conta solo la capacità: i processi non hanno limiti di risorse
+	info.Profile = spec.Profile
+	info.MaxViewers = spec.MaxViewers
+
+	if info.NeedsJanus() {
+		if err := p.startJanus(ctx, node, info); err != nil {
+			return nil, err
+		}
+		wsURL := fmt.Sprintf("ws://%s:%d", p.cfg.Host, info.JanusWSPort)
+		if info.IsInjection() {
+			env = append(env,
+				"JANUS_VIDEOROOM_WS_URL="+wsURL,
+				"JANUS_VIDEOROOM_ROOM_SECRET=adminpwd",
+				"WHIP_BASE_PATH=/whip",
+				"WHIP_TOKEN=verysecret",
+			)
+		} else {
+			env = append(env,
+				"JANUS_STREAMING_WS_URL="+wsURL,
+				"JANUS_STREAMING_MOUNTPOINT_SECRET=adminpwd",
+				"WHEP_BASE_PATH=/whep",
+				"WHEP_TOKEN=verysecret",
+			)
+		}
+	}
+
+	if err := p.startProcess(node, localProcessNode, spec.NodeId, spec.NodeType, env); err != nil {
+		return nil, err
+	}
+	infos := []*domain.NodeInfo{info}
+
+	// Il Relay Root vive e muore con il suo injection
+	if spec.NodeType == domain.NodeTypeInjection && spec.RelayRootId != "" {
+		rootInfo, rootEnv, err := p.nodeInfo(node, spec.RelayRootId, domain.NodeTypeRelay, "root", spec.MaxSlots)
+		if err != nil {
+			return nil, err
+		}
+		rootInfo.ContainerId = spec.NodeId // Stessi processi dell'injection
+		rootInfo.Profile = spec.Profile
+		if err := p.startProcess(node, localProcessRoot, spec.RelayRootId, domain.NodeTypeRelay, rootEnv); err != nil {
+			return nil, err
+		}
+		node.rootId = spec.RelayRootId
+		infos = append(infos, rootInfo)
+		log.Printf("[Local] Provisioned Injection Pair: %s (%d) <-> %s (%d)", spec.NodeId, info.InternalAPIPort, spec.RelayRootId, rootInfo.InternalAPIPort)
+	}
+	return infos, nil
+}
+
+// nodeInfo riserva API e RTP del processo Node.js e ne prepara l'ambiente
+func (p *LocalProvisioner) nodeInfo(node *localNode, nodeId string, nodeType domain.NodeType, role string, maxSlots int) (*domain.NodeInfo, []string, error) {
+	apiPort, err := p.portAllocator.AllocateAPIPort()
+	if err != nil {
+		return nil, nil, err
+	}
+	node.ports = append(node.ports, apiPort)
+
+	audio, video, err := p.portAllocator.AllocateRTPPorts()
+	if err != nil {
+		return nil, nil, err
+	}
+	node.ranges = append(node.ranges, [2]int{audio, audio + 3})
+
+	info := &domain.NodeInfo{
+		NodeId:           nodeId,
+		NodeType:         nodeType,
+		Role:             role,
+		MaxSlots:         maxSlots,
+		Backend:          BackendLocalProcess,
+		ContainerId:      nodeId,
+		InternalHost:     p.cfg.Host,
+		InternalAPIPort:  apiPort,
+		InternalRTPAudio: audio,
+		InternalRTPVideo: video,
+		ExternalHost:     p.cfg.Host,
+		ExternalAPIPort:  apiPort,
+		CreatedAt:        time.Now().Unix(),
+	}
+	if role == "root" {
+		info.ExternalAPIPort = 0
+	}
+
+	env := []string{
+		"NODE_ID=" + nodeId,
+		"ROLE=" + role,
+		"NODE_HOST=" + p.cfg.Host,
+		"API_PORT=" + strconv.Itoa(apiPort),
+		"RTP_AUDIO_PORT=" + strconv.Itoa(audio),
+		"RTP_VIDEO_PORT=" + strconv.Itoa(video),
+		"REDIS_HOST=" + p.cfg.RedisHost,
+		"REDIS_PORT=" + strconv.Itoa(p.cfg.RedisPort),
+	}
+	switch nodeType {
+	case domain.NodeTypeRelay:
+		env = append(env, "FORWARDER_PATH="+p.cfg.RelayForwarder)
+	case domain.NodeTypeEgress:
+		env = append(env, "FORWARDER_PATH="+p.cfg.EgressForwarder)
+	}
+	return info, env, nil
+}
+
+// startJanus genera la config del nodo dai template dell'immagine e attende che Janus risponda
+func (p *LocalProvisioner) startJanus(ctx context.Context, node *localNode, info *domain.NodeInfo) error {
+	janusHTTP, janusWS, err := p.portAllocator.AllocateJanusPorts()
+	if err != nil {
+		return err
+	}
+	node.ports = append(node.ports, janusHTTP, janusWS)
+
+	webrtcStart, webrtcEnd, err := p.portAllocator.AllocateWebRTCRange()
+	if err != nil {
+		return err
+	}
+	node.ranges = append(node.ranges, [2]int{webrtcStart, webrtcEnd})
+
+	vars := map[string]string{
+		"JANUS_RTP_PORT_RANGE":  portRange(webrtcStart, webrtcEnd),
+		"JANUS_LOG_LEVEL":       "4",
+		"JANUS_HTTP_PORT":       strconv.Itoa(janusHTTP),
+		"JANUS_WS_PORT":         strconv.Itoa(janusWS),
+		"JANUS_NAT_1_1_MAPPING": p.cfg.Host,
+	}
+	if info.IsEgress() {
+		streamStart, streamEnd, err := p.portAllocator.AllocateStreamingRange()
+		if err != nil {
+			return err
+		}
+		node.ranges = append(node.ranges, [2]int{streamStart, streamEnd})
+		vars["JANUS_STREAMING_RTP_PORT_RANGE"] = portRange(streamStart, streamEnd)
+		info.StreamPortStart, info.StreamPortEnd = streamStart, streamEnd
+	}
+
+	configDir := filepath.Join(node.dir, "janus")
+	if err := p.renderJanusConfig(configDir, info.NodeType, vars); err != nil {
+		return err
+	}
+
+	janus := &localProcess{
+		name:    localProcessJanus,
+		path:    filepath.Join(p.cfg.JanusPrefix, "bin", "janus"),
+		args:    []string{"-F", configDir},
+		dir:     configDir,
+		logPath: filepath.Join(node.dir, localProcessJanus+".log"),
+	}
+	node.janusHTTP = janusHTTP
+	if err := p.supervise(node, janus, info.NodeId, info.NodeType); err != nil {
+		return err
+	}
+
+	info.JanusContainerId = info.NodeId
+	info.JanusHost = p.cfg.Host
+	info.JanusHTTPPort = janusHTTP
+	info.JanusWSPort = janusWS
+	info.WebRTCPortStart, info.WebRTCPortEnd = webrtcStart, webrtcEnd
+
+	// Il nodo si collega a Janus all'avvio: aspettiamo che risponda
+	return p.waitJanus(ctx, janus, janusHTTP)
+}
+
+// renderJanusConfig copia la config dell'immagine Janus sostituendo le variabili dei template
+// e le cartelle /opt/janus con quelle del nodo e dell'installazione locale
+func (p *LocalProvisioner) renderJanusConfig(dst string, nodeType domain.NodeType, vars map[string]string) error {
+	src := filepath.Join(p.cfg.MeshDir, "janus-videoroom", "config")
+	if nodeType == domain.NodeTypeEgress {
+		src = filepath.Join(p.cfg.MeshDir, "janus-streaming", "config")
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("failed to read Janus config %s: %w", src, err)
+	}
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return fmt.Errorf("failed to create Janus config dir: %w", err)
+	}
+
+	var pairs []string
+	for key, value := range vars {
+		pairs = append(pairs, "${"+key+"}", value)
+	}
+	pairs = append(pairs, "/opt/janus/etc/janus", dst, "/opt/janus", p.cfg.JanusPrefix)
+	replacer := strings.NewReplacer(pairs...)
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, ".template") {
+			name = strings.TrimSuffix(name, ".template")
+		} else if _, err := os.Stat(filepath.Join(src, name+".template")); err == nil {
+			continue // Sostituito dal template
+		}
+
+		data, err := os.ReadFile(filepath.Join(src, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read Janus config: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(dst, name), []byte(replacer.Replace(string(data))), 0o644); err != nil {
+			return fmt.Errorf("failed to write Janus config: %w", err)
+		}
+	}
+	return nil
+}
+
+// waitJanus attende GET /janus/info (come l'healthcheck dei container)
+func (p *LocalProvisioner) waitJanus(ctx context.Context, janus *localProcess, httpPort int) error {
+	ctx, cancel := context.WithTimeout(ctx, localJanusTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s:%d/janus/info", p.cfg.Host, httpPort)
+	for {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if resp, err := p.httpClient.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		if !janus.running() {
+			return fmt.Errorf("janus exited, see %s", janus.logPath)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("janus not ready within %v, see %s", localJanusTimeout, janus.logPath)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// startProcess avvia il processo Node.js del nodo dalla sua cartella nel repository
+func (p *LocalProvisioner) startProcess(node *localNode, name, nodeId string, nodeType domain.NodeType, env []string) error {
+	process := &localProcess{
+		name:    name,
+		path:    p.cfg.NodeBin,
+		args:    []string{"src/index.js"},
+		dir:     filepath.Join(p.cfg.MeshDir, string(nodeType)+"-node"),
+		env:     env,
+		logPath: filepath.Join(node.dir, name+".log"),
+	}
+	return p.supervise(node, process, nodeId, nodeType)
+}
+
+// supervise avvia il processo: i riavvii sono notificati, l'abbandono segna il nodo failed
+// Un riavvio di Janus riavvia anche il nodo, che a Janus si collega solo all'avvio
+func (p *LocalProvisioner) supervise(node *localNode, process *localProcess, nodeId string, nodeType domain.NodeType) error {
+	process.onRestart = func(restarts int, exitErr error) {
+		if process.name == localProcessJanus {
+			go p.restartWithJanus(node, process, exitErr)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), podEventTimeout)
+		defer cancel()
+
+		status, _ := p.redisClient.GetNodeStatus(ctx, nodeId)
+		switch status {
+		case "", redis.NodeStatusProvisioning, redis.NodeStatusDestroying, redis.NodeStatusGone, redis.NodeStatusFailed:
+			return
+		}
+
+		reason := fmt.Sprintf("process %s restarted (%d restarts), last exit: %v", process.name, restarts, exitErr)
+		log.Printf("[WARN] Node %s: %s", nodeId, reason)
+		p.redisClient.PublishNodeFailure(ctx, redis.NodeFailureEvent{
+			Type:     redis.NodeEventRestarted,
+			NodeId:   nodeId,
+			NodeType: string(nodeType),
+			Cause:    "restarted",
+			Reason:   reason,
+			Previous: status,
+		})
+	}
+	process.onGiveUp = func(err error) {
+		ctx, cancel := context.WithTimeout(context.Background(), podEventTimeout)
+		defer cancel()
+
+		// Senza i processi dell'injection anche il suo Relay Root è perso
+		nodeIds := []string{nodeId}
+		if process.name != localProcessRoot && node.rootId != "" {
+			nodeIds = append(nodeIds, node.rootId)
+		}
+		for _, id := range nodeIds {
+			p.markFailed(ctx, id, err.Error())
+		}
+	}
+
+	if err := process.start(); err != nil {
+		return err
+	}
+	node.mu.Lock()
+	node.processes[process.name] = process
+	node.mu.Unlock()
+	return nil
+}
+
+// restartWithJanus attende che il Janus riavviato risponda e riavvia il processo del nodo:
+// la sua supervisione lo rilancia e notifica il riavvio (sessioni perse)
+func (p *LocalProvisioner) restartWithJanus(node *localNode, janus *localProcess, exitErr error) {
+	node.mu.Lock()
+	process, ok := node.processes[localProcessNode]
+	node.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	log.Printf("[WARN] Node %s: janus restarted (last exit: %v), restarting the node", node.nodeId, exitErr)
+	if err := p.waitJanus(context.Background(), janus, node.janusHTTP); err != nil {
+		log.Printf("[WARN] Node %s: %v", node.nodeId, err)
+	}
+	process.restart()
+}
+
+func (p *LocalProvisioner) markFailed(ctx context.Context, nodeId, reason string) {
+	prev, err := p.redisClient.TransitionNodeStatus(ctx, nodeId, redis.NodeStatusFailed, "local", reason)
+	if err != nil {
+		if !errors.Is(err, redis.ErrInvalidTransition) {
+			log.Printf("[WARN] Failed to mark %s as failed: %v", nodeId, err)
+		}
+		return
+	}
+	if prev == redis.NodeStatusFailed {
+		return // Già segnalato
+	}
+
+	log.Printf("[Local] Node %s failed (%s), was %s", nodeId, reason, prev)
+	p.redisClient.PublishNodeFailure(ctx, redis.NodeFailureEvent{
+		Type:     redis.NodeEventFailed,
+		NodeId:   nodeId,
+		Cause:    "failed",
+		Reason:   reason,
+		Previous: prev,
+	})
+}
+
+// teardown ferma i processi (Relay Root, nodo, poi Janus) e libera le porte
+func (p *LocalProvisioner) teardown(node *localNode) {
+	node.mu.Lock()
+	processes := maps.Clone(node.processes)
+	node.mu.Unlock()
+
+	for _, name := range []string{localProcessRoot, localProcessNode, localProcessJanus} {
+		if process, ok := processes[name]; ok {
+			process.stop(localStopTimeout)
+		}
+	}
+	p.portAllocator.ReleasePorts(node.ports...)
+	for _, r := range node.ranges {
+		p.portAllocator.ReleaseRange(r[0], r[1])
+	}
+}
+
+// DestroyNode ferma i processi del nodo e pulisce Redis
+// Il Relay Root di un injection non ha processi propri: si ferma con l'injection
+func (p *LocalProvisioner) DestroyNode(ctx context.Context, nodeInfo *domain.NodeInfo) error {
+	p.mu.Lock()
+	node, ok := p.nodes[nodeInfo.NodeId]
+	delete(p.nodes, nodeInfo.NodeId)
+	p.mu.Unlock()
+
+	if ok {
+		log.Printf("[INFO] Stopping node %s", nodeInfo.NodeId)
+		p.teardown(node)
+	}
+
+	if nodeInfo.NodeType != "" {
+		p.redisClient.ForceDeleteNode(ctx, nodeInfo.NodeId, string(nodeInfo.NodeType))
+	}
+	if err := p.redisClient.DeleteNodeProvisioning(ctx, nodeInfo.NodeId); err != nil {
+		log.Printf("[WARN] Failed to delete provisioning info: %v", err)
+	}
+
+	log.Printf("[Local] Node %s destroyed successfully", nodeInfo.NodeId)
+	return nil
+}
+
+// NodeLogs legge il file di log del processo (il Relay Root ha il suo nella cartella dell'injection)
+func (p *LocalProvisioner) NodeLogs(ctx context.Context, nodeInfo *domain.NodeInfo, opts LogOptions) (io.ReadCloser, error) {
+	dir := filepath.Join(p.cfg.RunDir, nodeInfo.NodeId)
+	name := localProcessNode
+	switch {
+	case opts.Container == LogContainerJanus:
+		if !nodeInfo.NeedsJanus() {
+			return nil, fmt.Errorf("%w: %s has no janus", ErrUnknownContainer, nodeInfo.NodeId)
+		}
+		name = localProcessJanus
+	case opts.Container != "" && opts.Container != LogContainerNode:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownContainer, opts.Container)
+	case nodeInfo.Role == "root" && nodeInfo.ContainerId != nodeInfo.NodeId:
+		dir = filepath.Join(p.cfg.RunDir, nodeInfo.ContainerId)
+		name = localProcessRoot
+	}
+	return openLogFile(ctx, filepath.Join(dir, name+".log"), opts)
+}
+
+// Close ferma tutti i processi ancora in vita
+func (p *LocalProvisioner) Close() error {
+	p.mu.Lock()
+	nodes := p.nodes
+	p.nodes = make(map[string]*localNode)
+	p.mu.Unlock()
+
+	for _, node := range nodes {
+		p.teardown(node)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	localRestartBackoff = 2 * time.Second
+	localMaxRestarts    = 5 // Riavvii entro localRestartWindow prima di arrendersi
+	localRestartWindow  = time.Minute
+	localStopTimeout    = 10 * time.Second
+	localLogPoll        = 500 * time.Millisecond
+)
+
+// localProcess processo figlio supervisionato: riavviato quando termina, output su file
+// Ha un suo process group: lo stop raggiunge anche i figli (es. forwarder avviato dal nodo)
+type localProcess struct {
+	name    string // node, janus, root
+	path    string
+	args    []string
+	dir     string
+	env     []string
+	logPath string
+
+	onRestart func(restarts int, exitErr error)
+	onGiveUp  func(err error)
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	stopping bool
+	restarts int
+	stopCh   chan struct{}
+	done     chan struct{} // Chiuso a supervisione terminata
+}
+
+// start avvia il processo e la sua supervisione
+func (lp *localProcess) start() error {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+
+	if err := lp.spawn(); err != nil {
+		return err
+	}
+	lp.stopCh = make(chan struct{})
+	lp.done = make(chan struct{})
+	go lp.supervise()
+	return nil
+}
+
+// spawn lancia il processo (lp.mu acquisito)
+func (lp *localProcess) spawn() error {
+	logFile, err := os.OpenFile(lp.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log %s: %w", lp.logPath, err)
+	}
+	// Il figlio ha la sua copia del descrittore
+	defer logFile.Close()
+
+	cmd := exec.Command(lp.path, lp.args...)
+	cmd.Dir = lp.dir
+	cmd.Env = append(os.Environ(), lp.env...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", lp.path, err)
+	}
+	lp.cmd = cmd
+	return nil
+}
+
+// supervise riavvia il processo finché non viene fermato o muore troppe volte di fila
+func (lp *localProcess) supervise() {
+	defer close(lp.done)
+
+	var exits []time.Time
+	for {
+		lp.mu.Lock()
+		cmd := lp.cmd
+		lp.mu.Unlock()
+
+		exitErr := cmd.Wait()
+		if exitErr == nil {
+			exitErr = fmt.Errorf("%s exited", lp.name)
+		}
+		// I figli sopravvissuti (es. forwarder) terrebbero le porte del processo rilanciato
+		signalProcessGroup(cmd, syscall.SIGKILL)
+
+		now := time.Now()
+		exits = append(exits, now)
+		for len(exits) > 0 && now.Sub(exits[0]) > localRestartWindow {
+			exits = exits[1:]
+		}
+
+		lp.mu.Lock()
+		stopping := lp.stopping
+		lp.mu.Unlock()
+		if stopping {
+			return
+		}
+		if len(exits) > localMaxRestarts {
+			lp.onGiveUp(fmt.Errorf("%s crashed %d times in %v, last: %w", lp.name, len(exits), localRestartWindow, exitErr))
+			return
+		}
+
+		select {
+		case <-lp.stopCh:
+			return
+		case <-time.After(localRestartBackoff):
+		}
+
+		lp.mu.Lock()
+		if lp.stopping {
+			lp.mu.Unlock()
+			return
+		}
+		err := lp.spawn()
+		lp.restarts++
+		restarts := lp.restarts
+		lp.mu.Unlock()
+
+		if err != nil {
+			lp.onGiveUp(err)
+			return
+		}
+		lp.onRestart(restarts, exitErr)
+	}
+}
+
+// stop invia SIGTERM al process group e dopo timeout SIGKILL
+func (lp *localProcess) stop(timeout time.Duration) {
+	lp.mu.Lock()
+	if lp.stopping || lp.done == nil {
+		lp.mu.Unlock()
+		return
+	}
+	lp.stopping = true
+	close(lp.stopCh)
+	cmd := lp.cmd
+	lp.mu.Unlock()
+
+	signalProcessGroup(cmd, syscall.SIGTERM)
+	select {
+	case <-lp.done:
+	case <-time.After(timeout):
+		signalProcessGroup(cmd, syscall.SIGKILL)
+		<-lp.done
+	}
+}
+
+// restart termina il process group: la supervisione lo rilancia come dopo un crash
+func (lp *localProcess) restart() {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	if lp.stopping {
+		return
+	}
+	signalProcessGroup(lp.cmd, syscall.SIGKILL)
+}
+
+// running il processo è supervisionato (non fermato né abbandonato)
+func (lp *localProcess) running() bool {
+	select {
+	case <-lp.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// openLogFile apre il log di un processo locale
+// I file non hanno timestamp: Since non è applicabile e viene ignorato
+func openLogFile(ctx context.Context, path string, opts LogOptions) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log %s: %w", path, err)
+	}
+
+	if opts.Tail > 0 {
+		offset, err := tailOffset(file, opts.Tail)
+		if err == nil {
+			_, err = file.Seek(offset, io.SeekStart)
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read log %s: %w", path, err)
+		}
+	}
+
+	if !opts.Follow {
+		return file, nil
+	}
+
+	// Follow: a fine file si attende che il processo scriva ancora (come tail -f)
+	reader, writer := io.Pipe()
+	go func() {
+		defer file.Close()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := file.Read(buf)
+			if n > 0 {
+				if _, werr := writer.Write(buf[:n]); werr != nil {
+					return
+				}
+			}
+			if err == io.EOF {
+				select {
+				case <-ctx.Done():
+					writer.Close()
+					return
+				case <-time.After(localLogPoll):
+				}
+				continue
+			}
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return reader, nil
+}
+
+// tailOffset posizione da cui iniziano le ultime lines righe del file
+func tailOffset(file *os.File, lines int64) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	const chunk = 32 * 1024
+	buf := make([]byte, chunk)
+	end := info.Size()
+	// Un newline finale chiude l'ultima riga, non ne apre una nuova
+	count := int64(-1)
+
+	for end > 0 {
+		start := max(end-chunk, 0)
+		n, err := file.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		data := buf[:n]
+		for i := bytes.LastIndexByte(data, '\n'); i >= 0; i = bytes.LastIndexByte(data, '\n') {
+			count++
+			if count == lines {
+				return start + int64(i) + 1, nil
+			}
+			data = data[:i]
+		}
+		end = start
+	}
+	return 0, nil
+}
@@ -0,0 +1,22 @@
+//go:build linux
+
+package provisioner
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup mette il processo in un suo process group
+// Se il controller muore i figli ricevono SIGTERM: nessun processo orfano da ritrovare al riavvio
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGTERM}
+}
+
+// signalProcessGroup segnala il processo e i suoi figli
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	syscall.Kill(-cmd.Process.Pid, sig)
+}
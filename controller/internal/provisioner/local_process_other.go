@@ -0,0 +1,22 @@
+//go:build !linux
+
+package provisioner
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup fuori da Linux niente process group: si segnala il solo processo
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	if sig == syscall.SIGKILL {
+		cmd.Process.Kill()
+		return
+	}
+	cmd.Process.Signal(sig)
+}
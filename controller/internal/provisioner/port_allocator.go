@@ -5,7 +5,7 @@ import (
 	"sync"
 )
 
-// PortAllocator gestisce allocazione porte per Docker locale
+// PortAllocator gestisce allocazione porte per Docker locale e processi locali
 // Previene conflitti tra container assicurando che ogni porta sia usata una sola volta
 type PortAllocator struct {
 	mu sync.Mutex
@@ -30,6 +30,10 @@ type PortAllocator struct {
 	streamRangeStart int
 	streamRangeSize  int
 	streamRangeMax   int
+
+	rtpRangeStart int // Blocchi RTP per processi sullo stesso host (local-process)
+	rtpBlockSize  int
+	rtpRangeMax   int
 }
 
 // NewPortAllocator inizializza l'allocatore
@@ -58,9 +62,18 @@ func NewPortAllocator() *PortAllocator {
 		webrtcRangeStart: 20000,
 		webrtcRangeSize:  100,
 		webrtcRangeMax:   25000,
+
+		// RTP nodi: 5000-5999 (blocchi da 4: audio, video e RTCP)
+		rtpRangeStart: 5000,
+		rtpBlockSize:  4,
+		rtpRangeMax:   5999,
 	}
 }
 
+// HostPortAllocator allocatore condiviso dai backend che pubblicano porte su questo host
+// (docker e local-process): con PROVISIONER_ROUTES misti le porte non si sovrappongono
+var HostPortAllocator = sync.OnceValue(NewPortAllocator)
+
 // helper: findFreePort cerca il primo buco libero
 func (pa *PortAllocator) findFreePort(min, max int) (int, error) {
 	for port := min; port <= max; port++ {
@@ -168,6 +181,30 @@ func (pa *PortAllocator) AllocateStreamingRange() (int, int, error) {
 	return 0, 0, fmt.Errorf("no streaming input ranges available")
 }
 
+// AllocateRTPPorts riserva un blocco RTP: audio = inizio, video = inizio+2
+// Da rilasciare con ReleaseRange(audio, audio+3)
+func (pa *PortAllocator) AllocateRTPPorts() (int, int, error) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	for start := pa.rtpRangeStart; start+pa.rtpBlockSize-1 <= pa.rtpRangeMax; start += pa.rtpBlockSize {
+		free := true
+		for port := start; port < start+pa.rtpBlockSize; port++ {
+			if pa.usedPorts[port] {
+				free = false
+				break
+			}
+		}
+		if free {
+			for port := start; port < start+pa.rtpBlockSize; port++ {
+				pa.usedPorts[port] = true
+			}
+			return start, start + 2, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("no RTP port blocks available in range %d-%d", pa.rtpRangeStart, pa.rtpRangeMax)
+}
+
 // Release libera una porta
 func (pa *PortAllocator) Release(port int) {
 	pa.mu.Lock()
@@ -200,6 +237,15 @@ func (pa *PortAllocator) MarkAsUsed(port int) {
 	pa.usedPorts[port] = true
 }
 
+// MarkRangeAsUsed forza un range come usato (recupero dei container esistenti)
+func (pa *PortAllocator) MarkRangeAsUsed(startPort, endPort int) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	for p := startPort; p <= endPort; p++ {
+		pa.usedPorts[p] = true
+	}
+}
+
 // IsPortUsed verifica se una porta è allocata
 func (pa *PortAllocator) IsPortUsed(port int) bool {
 	pa.mu.Lock()
@@ -0,0 +1,156 @@
+package provisioner
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"controller/internal/config"
+	"controller/internal/domain"
+	"controller/internal/redis"
+)
+
+// Backend di provisioning selezionabili da configurazione (PROVISIONER, PROVISIONER_ROUTES)
+const (
+	BackendDocker = "docker"
+	BackendK8s    = "k8s"
+	BackendStatic = domain.BackendStatic
+
+	BackendLocalProcess = "local-process"
+)
+
+// Factory crea un backend a partire dalla configurazione del controller
+type Factory func(cfg *config.Config, redisClient *redis.Client) (Provisioner, error)
+
+var factories = map[string]Factory{
+	BackendDocker: func(cfg *config.Config, redisClient *redis.Client) (Provisioner, error) {
+		return NewDockerProvisioner(cfg.DockerNetwork, redisClient)
+	},
+	BackendK8s: func(cfg *config.Config, redisClient *redis.Client) (Provisioner, error) {
+		return NewK8sProvisioner(redisClient, cfg.K8sAgentSelector, cfg.K8sAgentConfigMap, cfg.K8sOperatorMode)
+	},
+	BackendStatic: func(cfg *config.Config, redisClient *redis.Client) (Provisioner, error) {
+		return NewStaticProvisioner(redisClient), nil
+	},
+	BackendLocalProcess: func(cfg *config.Config, redisClient *redis.Client) (Provisioner, error) {
+		return NewLocalProvisioner(LocalConfig{
+			MeshDir:         cfg.LocalMeshDir,
+			RunDir:          cfg.LocalRunDir,
+			NodeBin:         cfg.LocalNodeBin,
+			JanusPrefix:     cfg.LocalJanusPrefix,
+			RelayForwarder:  cfg.LocalRelayForwarder,
+			EgressForwarder: cfg.LocalEgressForwarder,
+			Host:            cfg.LocalHost,
+			RedisHost:       cfg.RedisHost,
+			RedisPort:       cfg.RedisPort,
+		}, redisClient)
+	},
+}
+
+// Backends nomi dei backend registrati
+func Backends() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New crea il provisioner scelto da configurazione
+// Il backend static è sempre presente: i nodi esterni si registrano via API qualunque sia il default
+// Con più backend (static incluso) ritorna un CompositeProvisioner che ne istanzia uno per nome
+func New(cfg *config.Config, redisClient *redis.Client) (Provisioner, error) {
+	routes, err := ParseRoutes(cfg.ProvisionerRoutes)
+	if err != nil {
+		return nil, err
+	}
+
+	names := append([]string{cfg.Provisioner}, routeBackends(routes)...)
+	names = append(names, BackendStatic)
+
+	backends := make(map[string]Provisioner)
+	for _, name := range names {
+		if _, ok := backends[name]; ok {
+			continue
+		}
+		backend, err := newBackend(name, cfg, redisClient)
+		if err != nil {
+			for _, created := range backends {
+				created.Close()
+			}
+			return nil, err
+		}
+		backends[name] = backend
+	}
+
+	if len(backends) == 1 {
+		log.Printf("[Provisioner] Backend: %s", cfg.Provisioner)
+		return backends[cfg.Provisioner], nil
+	}
+	return NewCompositeProvisioner(cfg.Provisioner, backends, routes)
+}
+
+// Lookup ritorna il backend con il nome indicato, anche dentro un CompositeProvisioner
+func Lookup(p Provisioner, name string) (Provisioner, bool) {
+	if composite, ok := p.(*CompositeProvisioner); ok {
+		backend, found := composite.backends[name]
+		return backend, found
+	}
+	return p, backendName(p) == name
+}
+
+func backendName(p Provisioner) string {
+	switch p.(type) {
+	case *DockerProvisioner:
+		return BackendDocker
+	case *K8sProvisioner:
+		return BackendK8s
+	case *StaticProvisioner:
+		return BackendStatic
+	case *LocalProvisioner:
+		return BackendLocalProcess
+	}
+	return ""
+}
+
+func newBackend(name string, cfg *config.Config, redisClient *redis.Client) (Provisioner, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provisioner backend %q (available: %s)", name, strings.Join(Backends(), ", "))
+	}
+	backend, err := factory(cfg, redisClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s provisioner: %w", name, err)
+	}
+	return backend, nil
+}
+
+// ParseRoutes legge "relay=k8s,egress=static,root=k8s"
+// La chiave è un tier (injection, relay, egress) o un ruolo (ingress, standalone, edge, root)
+func ParseRoutes(value string) (map[string]string, error) {
+	routes := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, backend, ok := strings.Cut(entry, "=")
+		key, backend = strings.TrimSpace(key), strings.TrimSpace(backend)
+		if !ok || key == "" || backend == "" {
+			return nil, fmt.Errorf("invalid provisioner route %q (expected tier=backend or role=backend)", entry)
+		}
+		routes[key] = backend
+	}
+	return routes, nil
+}
+
+func routeBackends(routes map[string]string) []string {
+	var names []string
+	for _, backend := range routes {
+		names = append(names, backend)
+	}
+	sort.Strings(names)
+	return names
+}
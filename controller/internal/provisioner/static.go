@@ -0,0 +1,74 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"controller/internal/domain"
+	"controller/internal/redis"
+)
+
+var ErrStaticCreate = errors.New("static nodes cannot be created by the controller, register them with POST /api/nodes/register")
+
+// NodeRegistrar backend che accetta nodi gestiti esternamente
+type NodeRegistrar interface {
+	RegisterNode(ctx context.Context, nodeInfo *domain.NodeInfo) error
+}
+
+// StaticProvisioner nodi su macchine esterne (bring-your-own)
+// Il controller ne salva host e porte e li usa come gli altri, ma non crea né distrugge la macchina
+type StaticProvisioner struct {
+	redisClient *redis.Client
+}
+
+func NewStaticProvisioner(redisClient *redis.Client) *StaticProvisioner {
+	return &StaticProvisioner{redisClient: redisClient}
+}
+
+// CreateNode: la macchina esiste già, si registra via API
+func (p *StaticProvisioner) CreateNode(ctx context.Context, spec domain.NodeSpec, role string) (*domain.NodeInfo, error) {
+	return nil, ErrStaticCreate
+}
+
+// RegisterNode salva host, porte e capacità dichiarati dal nodo
+func (p *StaticProvisioner) RegisterNode(ctx context.Context, nodeInfo *domain.NodeInfo) error {
+	nodeInfo.Backend = BackendStatic
+	if nodeInfo.ContainerId == "" {
+		nodeInfo.ContainerId = nodeInfo.NodeId
+	}
+	if nodeInfo.CreatedAt == 0 {
+		nodeInfo.CreatedAt = time.Now().Unix()
+	}
+
+	if err := p.redisClient.SaveNodeProvisioning(ctx, nodeInfo); err != nil {
+		return fmt.Errorf("failed to save provisioning to Redis: %w", err)
+	}
+	log.Printf("[Static] Registered %s (%s) at %s:%d", nodeInfo.NodeId, nodeInfo.NodeType, nodeInfo.InternalHost, nodeInfo.InternalAPIPort)
+	return nil
+}
+
+// DestroyNode deregistra il nodo: la macchina resta accesa
+func (p *StaticProvisioner) DestroyNode(ctx context.Context, nodeInfo *domain.NodeInfo) error {
+	if nodeInfo.NodeType != "" {
+		p.redisClient.ForceDeleteNode(ctx, nodeInfo.NodeId, string(nodeInfo.NodeType))
+	}
+	if err := p.redisClient.DeleteNodeProvisioning(ctx, nodeInfo.NodeId); err != nil {
+		log.Printf("[WARN] Failed to delete provisioning info from Redis: %v", err)
+	}
+
+	log.Printf("[Static] Node %s deregistered (machine left untouched)", nodeInfo.NodeId)
+	return nil
+}
+
+// NodeLogs: i log restano sulla macchina esterna
+func (p *StaticProvisioner) NodeLogs(ctx context.Context, nodeInfo *domain.NodeInfo, opts LogOptions) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("%w: logs of externally managed node %s are not available", ErrUnknownContainer, nodeInfo.NodeId)
+}
+
+func (p *StaticProvisioner) Close() error {
+	return nil
+}
@@ -0,0 +1,252 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrViewerTicketNotFound hash del ticket assente (mai creato o scaduto per TTL)
+var ErrViewerTicketNotFound = errors.New("ticket not found")
+
+// AdmissionTicket rappresenta un viewer in sala d'attesa per una sessione
+type AdmissionTicket struct {
+	TicketId  string `json:"ticketId" redis:"ticketId"`
+	SessionId string `json:"sessionId" redis:"sessionId"`
+	Tier      string `json:"tier" redis:"tier"`     // tier che ha causato l'attesa
+	Status    string `json:"status" redis:"status"` // waiting, admitting, admitted, expired
+	CreatedAt int64  `json:"createdAt" redis:"createdAt"`
+	Deadline  int64  `json:"deadline" redis:"deadline"`
+	// Ultimo poll del client: un ticket in testa non più letto viene scartato
+	LastPollAt int64  `json:"lastPollAt" redis:"lastPollAt"`
+	Result     string `json:"-" redis:"result"` // JSON della risposta di ProvisionViewer
+}
+
+// Chiavi:
+// admission:ticket:{ticketId}     HASH ticket (TTL)
+// admission:session:{sessionId}   ZSET ticketId -> createdAt (ordine FIFO)
+// admission:tier:{tier}           ZSET ticketId -> deadline (lunghezza coda per l'autoscaler)
+// admission:sessions              SET sessioni con ticket in coda (lavoro del worker di ammissione)
+
+const admissionSessionsKey = "admission:sessions"
+
+func admissionTicketKey(ticketId string) string {
+	return fmt.Sprintf("admission:ticket:%s", ticketId)
+}
+
+func admissionSessionKey(sessionId string) string {
+	return fmt.Sprintf("admission:session:%s", sessionId)
+}
+
+func admissionTierKey(tier string) string {
+	return fmt.Sprintf("admission:tier:%s", tier)
+}
+
+// EnqueueViewerTicket inserisce un ticket in coda
+// Il ticket sopravvive alla deadline per ttlGrace, così il client può leggere l'esito
+func (c *Client) EnqueueViewerTicket(ctx context.Context, ticket *AdmissionTicket, ttlGrace time.Duration) error {
+	ticketKey := admissionTicketKey(ticket.TicketId)
+	ttl := time.Until(time.UnixMilli(ticket.Deadline)) + ttlGrace
+
+	pipe := c.rdb.TxPipeline()
+	pipe.HSet(ctx, ticketKey, ticket)
+	pipe.Expire(ctx, ticketKey, ttl)
+	pipe.ZAdd(ctx, admissionSessionKey(ticket.SessionId), redis.Z{Score: float64(ticket.CreatedAt), Member: ticket.TicketId})
+	pipe.ZAdd(ctx, admissionTierKey(ticket.Tier), redis.Z{Score: float64(ticket.Deadline), Member: ticket.TicketId})
+	pipe.SAdd(ctx, admissionSessionsKey, ticket.SessionId)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to enqueue ticket %s: %w", ticket.TicketId, err)
+	}
+	return nil
+}
+
+// GetViewerTicket legge un ticket
+func (c *Client) GetViewerTicket(ctx context.Context, ticketId string) (*AdmissionTicket, error) {
+	cmd := c.rdb.HGetAll(ctx, admissionTicketKey(ticketId))
+	result, err := cmd.Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ticket: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrViewerTicketNotFound, ticketId)
+	}
+
+	var ticket AdmissionTicket
+	if err := cmd.Scan(&ticket); err != nil {
+		return nil, fmt.Errorf("failed to scan ticket: %w", err)
+	}
+	ticket.Result = result["result"]
+	return &ticket, nil
+}
+
+// GetViewerTicketPosition ritorna posizione (0 = primo) e lunghezza della coda della sessione
+// I ticket scaduti (hash sparito per TTL) vengono rimossi durante la lettura
+func (c *Client) GetViewerTicketPosition(ctx context.Context, sessionId, ticketId string) (int, int, error) {
+	queueKey := admissionSessionKey(sessionId)
+
+	members, err := c.rdb.ZRange(ctx, queueKey, 0, -1).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Pulizia ticket orfani
+	pipe := c.rdb.Pipeline()
+	existsCmds := make([]*redis.IntCmd, len(members))
+	for i, member := range members {
+		existsCmds[i] = pipe.Exists(ctx, admissionTicketKey(member))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, 0, err
+	}
+
+	position := -1
+	length := 0
+	for i, member := range members {
+		if existsCmds[i].Val() == 0 {
+			c.rdb.ZRem(ctx, queueKey, member)
+			continue
+		}
+		if member == ticketId {
+			position = length
+		}
+		length++
+	}
+
+	if position < 0 {
+		return 0, length, fmt.Errorf("ticket %s not queued for session %s", ticketId, sessionId)
+	}
+	return position, length, nil
+}
+
+// TouchViewerTicket registra il poll del client: il ticket resta vivo in coda
+func (c *Client) TouchViewerTicket(ctx context.Context, ticketId string, at time.Time) error {
+	// HSET solo se il ticket esiste ancora (non ricrea hash scaduti)
+	return c.rdb.Eval(ctx, `if redis.call('EXISTS', KEYS[1]) == 1 then redis.call('HSET', KEYS[1], 'lastPollAt', ARGV[1]) end return 1`,
+		[]string{admissionTicketKey(ticketId)}, at.UnixMilli()).Err()
+}
+
+// GetAdmissionHead primo ticket in coda della sessione (nil se la coda è vuota)
+func (c *Client) GetAdmissionHead(ctx context.Context, sessionId string) (*AdmissionTicket, error) {
+	heads, err := c.rdb.ZRange(ctx, admissionSessionKey(sessionId), 0, 0).Result()
+	if err != nil || len(heads) == 0 {
+		return nil, err
+	}
+	return c.GetViewerTicket(ctx, heads[0])
+}
+
+// GetAdmissionSessions sessioni con ticket in coda
+func (c *Client) GetAdmissionSessions(ctx context.Context) ([]string, error) {
+	return c.rdb.SMembers(ctx, admissionSessionsKey).Result()
+}
+
+// claimAdmissionHeadLua:
+// Scorre la testa della coda della sessione scartando ticket spariti, oltre la deadline
+// o abbandonati (nessun poll da staleBefore), poi prende in carico il primo in attesa
+// Un ticket già in carico blocca la coda finché la presa non scade (controller morto a metà)
+var claimAdmissionHeadLua = `
+-- KEYS[1] -> admission:session:{sessionId}, KEYS[2] -> admission:sessions
+-- ARGV[1] -> sessionId, ARGV[2] -> now (ms), ARGV[3] -> staleBefore (ms), ARGV[4] -> claimExpiredBefore (ms)
+local result = {''}
+while true do
+    local head = redis.call('ZRANGE', KEYS[1], 0, 0)[1]
+    if not head then
+        redis.call('SREM', KEYS[2], ARGV[1])
+        return result
+    end
+
+    local ticketKey = 'admission:ticket:' .. head
+    local t = redis.call('HMGET', ticketKey, 'status', 'deadline', 'lastPollAt', 'tier', 'claimedAt')
+    local status = t[1]
+    if not status then
+        redis.call('ZREM', KEYS[1], head)
+    elseif status == 'admitting' and tonumber(t[5] or 0) >= tonumber(ARGV[4]) then
+        return result
+    elseif tonumber(t[2]) <= tonumber(ARGV[2]) or tonumber(t[3] or 0) < tonumber(ARGV[3]) then
+        redis.call('HSET', ticketKey, 'status', 'expired', 'result', '')
+        redis.call('ZREM', KEYS[1], head)
+        redis.call('ZREM', 'admission:tier:' .. t[4], head)
+        table.insert(result, head)
+    elseif status == 'waiting' or status == 'admitting' then
+        redis.call('HSET', ticketKey, 'status', 'admitting', 'claimedAt', ARGV[2])
+        result[1] = head
+        return result
+    else
+        redis.call('ZREM', KEYS[1], head)
+    end
+end
+`
+
+// ClaimAdmissionHead prende in carico il primo ticket valido della coda ("" se nessuno)
+// Ritorna anche i ticket scartati (scaduti o abbandonati)
+func (c *Client) ClaimAdmissionHead(ctx context.Context, sessionId string, now, staleBefore, claimExpiredBefore time.Time) (string, []string, error) {
+	keys := []string{admissionSessionKey(sessionId), admissionSessionsKey}
+	values, err := c.rdb.Eval(ctx, claimAdmissionHeadLua, keys,
+		sessionId, now.UnixMilli(), staleBefore.UnixMilli(), claimExpiredBefore.UnixMilli()).StringSlice()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to claim admission head for %s: %w", sessionId, err)
+	}
+	if len(values) == 0 {
+		return "", nil, nil
+	}
+	return values[0], values[1:], nil
+}
+
+// ReleaseAdmissionClaim rimette in attesa un ticket preso in carico (capacità ancora insufficiente)
+func (c *Client) ReleaseAdmissionClaim(ctx context.Context, ticketId string) error {
+	return c.rdb.Eval(ctx, `if redis.call('HGET', KEYS[1], 'status') == 'admitting' then redis.call('HSET', KEYS[1], 'status', 'waiting') end return 1`,
+		[]string{admissionTicketKey(ticketId)}).Err()
+}
+
+// CompleteViewerTicket chiude il ticket (admitted o expired) e lo toglie dalle code
+func (c *Client) CompleteViewerTicket(ctx context.Context, ticket *AdmissionTicket, status, result string) error {
+	pipe := c.rdb.TxPipeline()
+	pipe.HSet(ctx, admissionTicketKey(ticket.TicketId), map[string]any{
+		"status": status,
+		"result": result,
+	})
+	pipe.ZRem(ctx, admissionSessionKey(ticket.SessionId), ticket.TicketId)
+	pipe.ZRem(ctx, admissionTierKey(ticket.Tier), ticket.TicketId)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to complete ticket %s: %w", ticket.TicketId, err)
+	}
+	return nil
+}
+
+// GetAdmissionQueueLength ritorna i viewer in attesa per colpa di un tier
+func (c *Client) GetAdmissionQueueLength(ctx context.Context, tier string) (int64, error) {
+	key := admissionTierKey(tier)
+
+	// Rimuove i ticket oltre la deadline
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	c.rdb.ZRemRangeByScore(ctx, key, "-inf", now)
+
+	return c.rdb.ZCard(ctx, key).Result()
+}
+
+// DeleteSessionAdmissionQueue svuota la coda di una sessione distrutta
+func (c *Client) DeleteSessionAdmissionQueue(ctx context.Context, sessionId string) error {
+	queueKey := admissionSessionKey(sessionId)
+
+	members, err := c.rdb.ZRange(ctx, queueKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := c.rdb.Pipeline()
+	for _, member := range members {
+		pipe.Del(ctx, admissionTicketKey(member))
+		for _, tier := range []string{"injection", "relay", "egress"} {
+			pipe.ZRem(ctx, admissionTierKey(tier), member)
+		}
+	}
+	pipe.Del(ctx, queueKey)
+	pipe.SRem(ctx, admissionSessionsKey, sessionId)
+	_, err = pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ScalingControl è un override manuale dell'autoscaler (pause, freeze scale-down, pin, profile)
+// Ogni controllo vive in una chiave con TTL: alla scadenza sparisce da solo
+type ScalingControl struct {
+	Scope     string `json:"scope"` // global, injection, relay, egress
+	Kind      string `json:"kind"`  // pause, no-scale-down, pin, profile
+	Size      int    `json:"size,omitempty"`
+	Profile   string `json:"profile,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+func scalingControlKey(scope, kind string) string {
+	return fmt.Sprintf("autoscaler:control:%s:%s", scope, kind)
+}
+
+// SetScalingControl salva un controllo con scadenza
+func (c *Client) SetScalingControl(ctx context.Context, control *ScalingControl, ttl time.Duration) error {
+	now := time.Now()
+	control.CreatedAt = now.Unix()
+	control.ExpiresAt = now.Add(ttl).Unix()
+
+	data, err := json.Marshal(control)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scaling control: %w", err)
+	}
+
+	key := scalingControlKey(control.Scope, control.Kind)
+	if err := c.rdb.Set(ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save scaling control %s: %w", key, err)
+	}
+	return nil
+}
+
+// DeleteScalingControl rimuove un controllo prima della scadenza
+func (c *Client) DeleteScalingControl(ctx context.Context, scope, kind string) error {
+	return c.rdb.Del(ctx, scalingControlKey(scope, kind)).Err()
+}
+
+// GetScalingControls legge in pipeline tutti i controlli attivi per gli scope richiesti
+func (c *Client) GetScalingControls(ctx context.Context, scopes, kinds []string) ([]*ScalingControl, error) {
+	pipe := c.rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, 0, len(scopes)*len(kinds))
+
+	for _, scope := range scopes {
+		for _, kind := range kinds {
+			cmds = append(cmds, pipe.Get(ctx, scalingControlKey(scope, kind)))
+		}
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read scaling controls: %w", err)
+	}
+
+	controls := make([]*ScalingControl, 0)
+	for _, cmd := range cmds {
+		raw, err := cmd.Result()
+		if err != nil {
+			// redis.Nil: controllo non impostato o scaduto
+			continue
+		}
+		var control ScalingControl
+		if err := json.Unmarshal([]byte(raw), &control); err != nil {
+			continue
+		}
+		controls = append(controls, &control)
+	}
+
+	return controls, nil
+}
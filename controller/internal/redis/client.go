@@ -12,7 +12,8 @@ import (
 )
 
 type Client struct {
-	rdb *redis.Client
+	rdb           *redis.Client
+	snapshotStats *snapshotStats
 }
 
 // Crea connessione
@@ -24,7 +25,8 @@ func NewClient(cfg *config.Config) *Client {
 	})
 
 	return &Client{
-		rdb: rdb,
+		rdb:           rdb,
+		snapshotStats: &snapshotStats{},
 	}
 }
 
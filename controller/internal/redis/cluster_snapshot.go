@@ -0,0 +1,270 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"controller/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Componenti di cui la fotografia legge le metriche (metrics:node:{id}:{component})
+var snapshotMetricComponents = []string{"application", "nodejs", "janusVideoroom", "janusStreaming", "gstreamer"}
+
+// Oltre questa durata la lettura viene segnalata nei log
+const slowSnapshotThreshold = 250 * time.Millisecond
+
+// ClusterSnapshot stato di tutti i nodi letto con una sola chiamata atomica
+// Autoscaler e selector decidono su questa fotografia invece di leggere nodo per nodo
+type ClusterSnapshot struct {
+	TakenAt time.Time
+	Latency time.Duration
+	Nodes   map[string]*ClusterNode
+}
+
+type ClusterNode struct {
+	Info     *domain.NodeInfo
+	Status   string // Stato grezzo di node:{id} ("" se assente)
+	Children []string
+	InPool   bool    // pool:{type}
+	Standby  bool    // pool:{type}:standby
+	Load     float64 // pool:{type}:load (relay e injection)
+	HasLoad  bool
+	Metrics  map[string]map[string]string // componente -> campi
+
+	Mountpoints int  // node:{id}:mountpoints (solo egress)
+	ManualDrain bool // drain:{id} in corso
+}
+
+// SnapshotStats latenza delle letture della fotografia
+type SnapshotStats struct {
+	Count  int64   `json:"count"`
+	Errors int64   `json:"errors"`
+	LastMs float64 `json:"lastMs"`
+	AvgMs  float64 `json:"avgMs"` // Media mobile esponenziale
+	MaxMs  float64 `json:"maxMs"`
+	Nodes  int     `json:"nodes"` // Nodi nell'ultima fotografia
+	LastAt int64   `json:"lastAt"`
+}
+
+type snapshotStats struct {
+	mu    sync.Mutex
+	stats SnapshotStats
+}
+
+// snapshotNodesLua:
+// Legge indice dei nodi, provisioning, stato, figli, appartenenza ai pool, carichi, metriche,
+// mountpoint degli egress e drain manuali in corso
+// Le liste vuote sono omesse (cjson codifica una tabella vuota come oggetto)
+// Condivisa dagli script delle fotografie: dentro uno script le letture sono atomiche
+var snapshotNodesLua = `
+local function to_map(flat)
+    local m = {}
+    for i = 1, #flat, 2 do
+        m[flat[i]] = flat[i + 1]
+    end
+    return m
+end
+
+local function read_nodes(components)
+    local nodes = {}
+    for _, node_id in ipairs(redis.call('SMEMBERS', 'nodes:provisioned')) do
+        local prov = redis.call('HGETALL', 'node:' .. node_id .. ':provisioning')
+        if #prov > 0 then
+            local node = {provisioning = to_map(prov), metrics = {}}
+            local node_type = node.provisioning.nodeType or ''
+
+            node.status = redis.call('HGET', 'node:' .. node_id, 'status') or ''
+            local children = redis.call('SMEMBERS', 'node:' .. node_id .. ':children')
+            if #children > 0 then
+                node.children = children
+            end
+            node.inPool = redis.call('SISMEMBER', 'pool:' .. node_type, node_id) == 1
+            node.standby = redis.call('SISMEMBER', 'pool:' .. node_type .. ':standby', node_id) == 1
+            local load = redis.call('ZSCORE', 'pool:' .. node_type .. ':load', node_id)
+            if load then
+                node.load = tonumber(load)
+            end
+            if node_type == 'egress' then
+                node.mountpoints = redis.call('SCARD', 'node:' .. node_id .. ':mountpoints')
+            end
+            node.manualDrain = redis.call('HGET', 'drain:' .. node_id, 'status') == 'running'
+
+            for _, component in ipairs(components) do
+                local metrics = redis.call('HGETALL', 'metrics:node:' .. node_id .. ':' .. component)
+                if #metrics > 0 then
+                    node.metrics[component] = to_map(metrics)
+                end
+            end
+            nodes[node_id] = node
+        end
+    end
+    return nodes
+end
+`
+
+// clusterSnapshotLua fotografia dei nodi con le metriche
+var clusterSnapshotLua = snapshotNodesLua + `
+-- ARGV[1..] -> componenti delle metriche
+return cjson.encode({nodes = read_nodes(ARGV)})
+`
+
+type rawClusterSnapshot struct {
+	Nodes map[string]rawSnapshotNode `json:"nodes"`
+}
+
+type rawSnapshotNode struct {
+	Provisioning map[string]string            `json:"provisioning"`
+	Status       string                       `json:"status"`
+	Children     []string                     `json:"children"`
+	InPool       bool                         `json:"inPool"`
+	Standby      bool                         `json:"standby"`
+	Load         *float64                     `json:"load"`
+	Metrics      map[string]map[string]string `json:"metrics"`
+	Mountpoints  int                          `json:"mountpoints"`
+	ManualDrain  bool                         `json:"manualDrain"`
+}
+
+// toClusterNode decodifica un nodo letto da snapshotNodesLua (nil se il provisioning non è valido)
+func (raw rawSnapshotNode) toClusterNode() *ClusterNode {
+	var data NodeProvisioningData
+	if err := redis.NewMapStringStringResult(raw.Provisioning, nil).Scan(&data); err != nil || data.NodeId == "" {
+		return nil
+	}
+	node := &ClusterNode{
+		Info:     data.toNodeInfo(),
+		Status:   raw.Status,
+		Children: raw.Children,
+		InPool:   raw.InPool,
+		Standby:  raw.Standby,
+		Metrics:  raw.Metrics,
+
+		Mountpoints: raw.Mountpoints,
+		ManualDrain: raw.ManualDrain,
+	}
+	if raw.Load != nil {
+		node.Load = *raw.Load
+		node.HasLoad = true
+	}
+	return node
+}
+
+// GetClusterSnapshot legge lo stato di tutti i nodi in un'unica chiamata Lua
+// La latenza di ogni lettura alimenta SnapshotStats
+func (c *Client) GetClusterSnapshot(ctx context.Context) (*ClusterSnapshot, error) {
+	args := make([]any, 0, len(snapshotMetricComponents))
+	for _, component := range snapshotMetricComponents {
+		args = append(args, component)
+	}
+
+	start := time.Now()
+	res, err := c.rdb.Eval(ctx, clusterSnapshotLua, nil, args...).Text()
+	latency := time.Since(start)
+	if err != nil {
+		c.snapshotStats.record(latency, 0, err)
+		return nil, fmt.Errorf("failed to read cluster snapshot: %w", err)
+	}
+
+	var raw rawClusterSnapshot
+	if err := json.Unmarshal([]byte(res), &raw); err != nil {
+		c.snapshotStats.record(latency, 0, err)
+		return nil, fmt.Errorf("failed to decode cluster snapshot: %w", err)
+	}
+
+	snapshot := &ClusterSnapshot{
+		TakenAt: start,
+		Latency: latency,
+		Nodes:   make(map[string]*ClusterNode, len(raw.Nodes)),
+	}
+	for nodeId, rawNode := range raw.Nodes {
+		if node := rawNode.toClusterNode(); node != nil {
+			snapshot.Nodes[nodeId] = node
+		}
+	}
+
+	c.snapshotStats.record(latency, len(snapshot.Nodes), nil)
+	if latency > slowSnapshotThreshold {
+		log.Printf("[WARN] Cluster snapshot took %v (%d nodes)", latency, len(snapshot.Nodes))
+	}
+	return snapshot, nil
+}
+
+// GetSnapshotStats ritorna le statistiche di latenza della fotografia
+func (c *Client) GetSnapshotStats() SnapshotStats {
+	c.snapshotStats.mu.Lock()
+	defer c.snapshotStats.mu.Unlock()
+	return c.snapshotStats.stats
+}
+
+func (s *snapshotStats) record(latency time.Duration, nodes int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.stats.Errors++
+		return
+	}
+
+	ms := float64(latency.Microseconds()) / 1000.0
+	s.stats.Count++
+	s.stats.LastMs = ms
+	s.stats.Nodes = nodes
+	s.stats.LastAt = time.Now().UnixMilli()
+	if ms > s.stats.MaxMs {
+		s.stats.MaxMs = ms
+	}
+	if s.stats.Count == 1 {
+		s.stats.AvgMs = ms
+	} else {
+		s.stats.AvgMs = 0.8*s.stats.AvgMs + 0.2*ms
+	}
+}
+
+// Node ritorna il nodo se presente nella fotografia
+func (s *ClusterSnapshot) Node(nodeId string) *ClusterNode {
+	return s.Nodes[nodeId]
+}
+
+// Pool ritorna i nodi del pool selezionabile di un tipo
+func (s *ClusterSnapshot) Pool(nodeType string) []*ClusterNode {
+	var nodes []*ClusterNode
+	for _, node := range s.Nodes {
+		if node.InPool && string(node.Info.NodeType) == nodeType {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// StandbyCount conta i nodi warm standby di un tipo
+func (s *ClusterSnapshot) StandbyCount(nodeType string) int {
+	count := 0
+	for _, node := range s.Nodes {
+		if node.Standby && string(node.Info.NodeType) == nodeType {
+			count++
+		}
+	}
+	return count
+}
+
+// IsActive indica se il nodo è selezionabile
+func (n *ClusterNode) IsActive() bool {
+	return n.Status == NodeStatusActive
+}
+
+// Metric legge un campo numerico delle metriche (0 se assente o non valido)
+func (n *ClusterNode) Metric(component, field string) float64 {
+	value, _ := strconv.ParseFloat(n.Metrics[component][field], 64)
+	return value
+}
+
+// CPUPercent legge cpuPercent di un componente (0 se assente)
+func (n *ClusterNode) CPUPercent(component string) float64 {
+	return n.Metric(component, "cpuPercent")
+}
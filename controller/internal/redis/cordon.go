@@ -0,0 +1,154 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// NodeCordon descrive un nodo in manutenzione
+type NodeCordon struct {
+	NodeId    string `json:"nodeId" redis:"nodeId"`
+	Reason    string `json:"reason,omitempty" redis:"reason"`
+	CreatedAt int64  `json:"createdAt" redis:"createdAt"`
+	ExpiresAt int64  `json:"expiresAt,omitempty" redis:"expiresAt"` // 0 = fino a uncordon
+}
+
+// Chiavi:
+// node:{nodeId}:cordon   HASH motivo e scadenza (TTL = scadenza)
+// nodes:cordoned         SET nodi in stato cordoned (per la scadenza)
+
+func cordonKey(nodeId string) string {
+	return fmt.Sprintf("node:%s:cordon", nodeId)
+}
+
+// CordonNode mette il nodo in stato cordoned: continua a servire le sessioni esistenti
+// ma non viene più selezionato. ttl 0 = nessuna scadenza
+func (c *Client) CordonNode(ctx context.Context, cordon *NodeCordon, ttl time.Duration, actor string) error {
+	key := cordonKey(cordon.NodeId)
+
+	if _, err := c.TransitionNodeStatus(ctx, cordon.NodeId, NodeStatusCordoned, actor, cordon.Reason); err != nil {
+		return err
+	}
+
+	pipe := c.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, cordon)
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	}
+	pipe.SAdd(ctx, "nodes:cordoned", cordon.NodeId)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to cordon node %s: %w", cordon.NodeId, err)
+	}
+
+	log.Printf("[Redis] Node %s cordoned", cordon.NodeId)
+	return nil
+}
+
+// uncordonNodeLua:
+// Rimozione del cordon e cordoned -> active in un solo passo: un drain o un guasto
+// arrivati dopo la lettura dello stato non vengono annullati
+// In modalità scadenza non fa nulla se il cordon esiste ancora (rinnovato nel frattempo)
+var uncordonNodeLua = `
+-- KEYS[1] -> node:{id}, KEYS[2] -> node:{id}:history, KEYS[3] -> node:{id}:cordon
+-- KEYS[4] -> nodes:cordoned, KEYS[5] -> global:active_nodes
+-- ARGV[1] -> nodeId, ARGV[2] -> actor, ARGV[3] -> reason, ARGV[4] -> timestamp ms
+-- ARGV[5] -> limite storico, ARGV[6] -> '1' solo se il cordon è scaduto
+local current = redis.call('HGET', KEYS[1], 'status') or ''
+if ARGV[6] == '1' then
+    if redis.call('EXISTS', KEYS[3]) == 1 then
+        return {'CORDONED', current}
+    end
+    redis.call('SREM', KEYS[4], ARGV[1])
+end
+if current ~= 'cordoned' then
+    return {'NOT_CORDONED', current}
+end
+
+redis.call('DEL', KEYS[3])
+redis.call('SREM', KEYS[4], ARGV[1])
+redis.call('HSET', KEYS[1], 'status', 'active')
+redis.call('LPUSH', KEYS[2], cjson.encode({
+    from = current, to = 'active', actor = ARGV[2], reason = ARGV[3], at = tonumber(ARGV[4])
+}))
+redis.call('LTRIM', KEYS[2], 0, tonumber(ARGV[5]) - 1)
+redis.call('SADD', KEYS[5], ARGV[1])
+return {'OK', current}
+`
+
+// UncordonNode rimuove il cordon e riporta il nodo in active solo se è ancora cordoned
+// Ritorna lo stato precedente: diverso da cordoned = nessuna modifica
+func (c *Client) UncordonNode(ctx context.Context, nodeId, actor, reason string) (string, error) {
+	_, prev, err := c.uncordonNode(ctx, nodeId, actor, reason, false)
+	return prev, err
+}
+
+// uncordonNode esegue uncordonNodeLua. onlyExpired: solo se la chiave del cordon è sparita per TTL
+func (c *Client) uncordonNode(ctx context.Context, nodeId, actor, reason string, onlyExpired bool) (bool, string, error) {
+	keys := []string{
+		fmt.Sprintf("node:%s", nodeId),
+		nodeHistoryKey(nodeId),
+		cordonKey(nodeId),
+		"nodes:cordoned",
+		"global:active_nodes",
+	}
+	expired := "0"
+	if onlyExpired {
+		expired = "1"
+	}
+
+	res, err := c.rdb.Eval(ctx, uncordonNodeLua, keys,
+		nodeId, actor, reason, time.Now().UnixMilli(), nodeHistoryLimit, expired).Slice()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to uncordon node %s: %w", nodeId, err)
+	}
+
+	prev, _ := res[1].(string)
+	if res[0].(string) != "OK" {
+		return false, prev, nil
+	}
+	log.Printf("[Redis] Node %s: %s -> %s (%s: %s)", nodeId, prev, NodeStatusActive, actor, reason)
+	return true, prev, nil
+}
+
+// GetNodeCordon legge il cordon di un nodo
+func (c *Client) GetNodeCordon(ctx context.Context, nodeId string) (*NodeCordon, error) {
+	cmd := c.rdb.HGetAll(ctx, cordonKey(nodeId))
+	result, err := cmd.Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cordon: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("node %s is not cordoned", nodeId)
+	}
+
+	var cordon NodeCordon
+	if err := cmd.Scan(&cordon); err != nil {
+		return nil, fmt.Errorf("failed to scan cordon: %w", err)
+	}
+	return &cordon, nil
+}
+
+// ExpireCordons rimette in servizio i nodi il cui cordon è scaduto (chiave sparita per TTL)
+func (c *Client) ExpireCordons(ctx context.Context) ([]string, error) {
+	nodeIds, err := c.rdb.SMembers(ctx, "nodes:cordoned").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []string
+	for _, nodeId := range nodeIds {
+		uncordoned, _, err := c.uncordonNode(ctx, nodeId, "autoscaler", "cordon expired", true)
+		if err != nil {
+			log.Printf("[WARN] Failed to expire cordon on %s: %v", nodeId, err)
+			continue
+		}
+		if uncordoned {
+			expired = append(expired, nodeId)
+		}
+	}
+	return expired, nil
+}
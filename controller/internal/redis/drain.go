@@ -0,0 +1,379 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DrainProgress stato di un drain manuale
+type DrainProgress struct {
+	NodeId    string `json:"nodeId" redis:"nodeId"`
+	NodeType  string `json:"nodeType" redis:"nodeType"`
+	Status    string `json:"status" redis:"status"` // running, completed, forced, timed-out
+	Force     bool   `json:"force" redis:"force"`
+	Destroy   bool   `json:"destroy" redis:"destroy"` // Distrugge il nodo a drain concluso
+	StartedAt int64  `json:"startedAt" redis:"startedAt"`
+	Deadline  int64  `json:"deadline" redis:"deadline"`
+	UpdatedAt int64  `json:"updatedAt" redis:"updatedAt"`
+	Total     int    `json:"total" redis:"total"`         // Sessioni sul nodo all'avvio
+	Migrated  int    `json:"migrated" redis:"migrated"`   // Spostate su altri nodi
+	Forced    int    `json:"forced" redis:"forced"`       // Chiuse a forza alla deadline
+	Failed    int    `json:"failed" redis:"failed"`       // Tentativi falliti (vengono ritentati)
+	Remaining int    `json:"remaining" redis:"remaining"` // Sessioni ancora sul nodo
+	Message   string `json:"message,omitempty" redis:"message"`
+	// Lease del controller che esegue il drain: scaduta, un altro controller lo riprende
+	LeaseUntil int64 `json:"leaseUntil" redis:"leaseUntil"`
+}
+
+// DrainUpdate esito di un giro del drain: incrementi dei contatori e stato corrente
+type DrainUpdate struct {
+	Migrated  int
+	Forced    int
+	Failed    int
+	Remaining int
+	Message   string // "" = invariato
+}
+
+// Chiavi:
+// drain:{nodeId}   HASH progresso (TTL dopo la chiusura)
+// drains:running   SET nodi con drain in corso (ripresi dopo un riavvio)
+
+const drainsRunningKey = "drains:running"
+
+func drainKey(nodeId string) string {
+	return fmt.Sprintf("drain:%s", nodeId)
+}
+
+// SaveDrainProgress salva lo stato del drain (ttl 0 = nessuna scadenza)
+func (c *Client) SaveDrainProgress(ctx context.Context, progress *DrainProgress, ttl time.Duration) error {
+	key := drainKey(progress.NodeId)
+	progress.UpdatedAt = time.Now().UnixMilli()
+
+	pipe := c.rdb.TxPipeline()
+	pipe.HSet(ctx, key, progress)
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	} else {
+		pipe.Persist(ctx, key)
+	}
+	if progress.Status == "running" {
+		pipe.SAdd(ctx, drainsRunningKey, progress.NodeId)
+	} else {
+		pipe.SRem(ctx, drainsRunningKey, progress.NodeId)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save drain progress for %s: %w", progress.NodeId, err)
+	}
+	return nil
+}
+
+// updateDrainProgressLua:
+// Aggiorna solo i campi del giro: force, deadline e destroy, scritti in concorrenza
+// da ForceDrain o da un'altra richiesta, restano intatti
+// Un drain già chiuso (o sparito) non viene toccato
+var updateDrainProgressLua = `
+-- KEYS[1] -> drain:{nodeId}, KEYS[2] -> drains:running
+-- ARGV[1] -> migrated, ARGV[2] -> forced, ARGV[3] -> failed (incrementi)
+-- ARGV[4] -> remaining, ARGV[5] -> message ("" = invariato), ARGV[6] -> updatedAt
+-- ARGV[7] -> leaseUntil, ARGV[8] -> stato finale ("" = drain ancora in corso), ARGV[9] -> TTL finale (s)
+-- ARGV[10] -> nodeId
+if redis.call('HGET', KEYS[1], 'status') ~= 'running' then
+    return 0
+end
+
+redis.call('HINCRBY', KEYS[1], 'migrated', ARGV[1])
+redis.call('HINCRBY', KEYS[1], 'forced', ARGV[2])
+redis.call('HINCRBY', KEYS[1], 'failed', ARGV[3])
+redis.call('HSET', KEYS[1], 'remaining', ARGV[4], 'updatedAt', ARGV[6], 'leaseUntil', ARGV[7])
+if ARGV[5] ~= '' then
+    redis.call('HSET', KEYS[1], 'message', ARGV[5])
+end
+
+if ARGV[8] ~= '' then
+    redis.call('HSET', KEYS[1], 'status', ARGV[8])
+    redis.call('EXPIRE', KEYS[1], ARGV[9])
+    redis.call('SREM', KEYS[2], ARGV[10])
+end
+return 1
+`
+
+// UpdateDrainProgress registra un giro del drain e rinnova la lease
+// Ritorna false se il drain non è più in corso
+func (c *Client) UpdateDrainProgress(ctx context.Context, nodeId string, update DrainUpdate, leaseUntil time.Time) (bool, error) {
+	return c.applyDrainUpdate(ctx, nodeId, update, leaseUntil, "", 0)
+}
+
+// FinishDrainProgress chiude il drain con lo stato finale (ttl: leggibilità del risultato)
+// Ritorna false se il drain era già stato chiuso
+func (c *Client) FinishDrainProgress(ctx context.Context, nodeId, status string, update DrainUpdate, ttl time.Duration) (bool, error) {
+	return c.applyDrainUpdate(ctx, nodeId, update, time.Now(), status, ttl)
+}
+
+func (c *Client) applyDrainUpdate(ctx context.Context, nodeId string, update DrainUpdate, leaseUntil time.Time, status string, ttl time.Duration) (bool, error) {
+	keys := []string{drainKey(nodeId), drainsRunningKey}
+	applied, err := c.rdb.Eval(ctx, updateDrainProgressLua, keys,
+		update.Migrated, update.Forced, update.Failed, update.Remaining, update.Message,
+		time.Now().UnixMilli(), leaseUntil.UnixMilli(), status, int64(ttl.Seconds()), nodeId).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to update drain progress for %s: %w", nodeId, err)
+	}
+	return applied == 1, nil
+}
+
+// claimDrainLua prende in carico un drain in corso con la lease scaduta
+var claimDrainLua = `
+-- KEYS[1] -> drain:{nodeId}
+-- ARGV[1] -> now (ms), ARGV[2] -> nuova leaseUntil (ms)
+if redis.call('HGET', KEYS[1], 'status') ~= 'running' then
+    return 0
+end
+if tonumber(redis.call('HGET', KEYS[1], 'leaseUntil') or 0) > tonumber(ARGV[1]) then
+    return 0
+end
+redis.call('HSET', KEYS[1], 'leaseUntil', ARGV[2])
+return 1
+`
+
+// ClaimDrain prende in carico un drain orfano (controller riavviato o morto)
+func (c *Client) ClaimDrain(ctx context.Context, nodeId string, leaseUntil time.Time) (bool, error) {
+	claimed, err := c.rdb.Eval(ctx, claimDrainLua, []string{drainKey(nodeId)},
+		time.Now().UnixMilli(), leaseUntil.UnixMilli()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim drain of %s: %w", nodeId, err)
+	}
+	return claimed == 1, nil
+}
+
+// GetRunningDrains nodi con un drain in corso; i drain spariti vengono rimossi dall'indice
+func (c *Client) GetRunningDrains(ctx context.Context) ([]string, error) {
+	nodeIds, err := c.rdb.SMembers(ctx, drainsRunningKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	running := make([]string, 0, len(nodeIds))
+	for _, nodeId := range nodeIds {
+		if !c.IsDrainRunning(ctx, nodeId) {
+			c.rdb.SRem(ctx, drainsRunningKey, nodeId)
+			continue
+		}
+		running = append(running, nodeId)
+	}
+	return running, nil
+}
+
+// GetDrainProgress legge lo stato del drain di un nodo
+func (c *Client) GetDrainProgress(ctx context.Context, nodeId string) (*DrainProgress, error) {
+	cmd := c.rdb.HGetAll(ctx, drainKey(nodeId))
+	result, err := cmd.Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get drain progress: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no drain for node %s", nodeId)
+	}
+
+	var progress DrainProgress
+	if err := cmd.Scan(&progress); err != nil {
+		return nil, fmt.Errorf("failed to scan drain progress: %w", err)
+	}
+	return &progress, nil
+}
+
+// ForceDrain chiede il completamento forzato di un drain in corso entro deadline
+// Una deadline già più vicina resta quella
+func (c *Client) ForceDrain(ctx context.Context, nodeId string, deadline time.Time) error {
+	return c.rdb.Eval(ctx, `
+-- KEYS[1] -> drain:{nodeId}, ARGV[1] -> deadline (ms)
+if redis.call('HGET', KEYS[1], 'status') ~= 'running' then return 0 end
+redis.call('HSET', KEYS[1], 'force', '1')
+if tonumber(redis.call('HGET', KEYS[1], 'deadline') or 0) > tonumber(ARGV[1]) then
+    redis.call('HSET', KEYS[1], 'deadline', ARGV[1])
+end
+return 1`, []string{drainKey(nodeId)}, deadline.UnixMilli()).Err()
+}
+
+// SetDrainDestroy chiede la distruzione del nodo alla chiusura di un drain in corso
+// Ritorna false se il drain non è più in corso
+func (c *Client) SetDrainDestroy(ctx context.Context, nodeId string) (bool, error) {
+	applied, err := c.rdb.Eval(ctx, `if redis.call('HGET', KEYS[1], 'status') ~= 'running' then return 0 end redis.call('HSET', KEYS[1], 'destroy', '1') return 1`,
+		[]string{drainKey(nodeId)}).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to set destroy on drain of %s: %w", nodeId, err)
+	}
+	return applied == 1, nil
+}
+
+// IsDrainRunning indica se il nodo ha un drain manuale in corso
+func (c *Client) IsDrainRunning(ctx context.Context, nodeId string) bool {
+	status, err := c.rdb.HGet(ctx, drainKey(nodeId), "status").Result()
+	return err == nil && status == "running"
+}
+
+// replaceRelayInChainLua:
+// Sostituisce un relay della catena con un altro, spostando riserva deep ed edge
+// Il nuovo relay deve essere attivo e avere posto per tutto il carico della sessione
+var replaceRelayInChainLua = `
+-- KEYS[1] -> session:{id}:chain, KEYS[2] -> session:{id}:edge_counts, KEYS[3] -> pool:relay:load
+-- ARGV[1] -> relay uscente, ARGV[2] -> relay entrante, ARGV[3] -> sessionId
+local chain = redis.call('LRANGE', KEYS[1], 0, -1)
+local idx = -1
+for i, node_id in ipairs(chain) do
+    if node_id == ARGV[2] then
+        return "IN_CHAIN"
+    end
+    if node_id == ARGV[1] then
+        idx = i - 1
+    end
+end
+-- Il Relay Root (indice 0) non si sposta
+if idx < 1 then
+    return "NOT_FOUND"
+end
+
+local status = redis.call('HGET', "node:" .. ARGV[2], "status")
+if status ~= "active" then
+    return "UNAVAILABLE"
+end
+
+local edges = tonumber(redis.call('HGET', KEYS[2], ARGV[1]) or 0)
+local needed = edges + 1
+local occupied = tonumber(redis.call('ZSCORE', KEYS[3], ARGV[2]) or 0)
+local max_slots = tonumber(redis.call('HGET', "node:" .. ARGV[2] .. ":provisioning", "maxSlots") or 20)
+if occupied + needed > max_slots then
+    return "FULL"
+end
+
+redis.call('LSET', KEYS[1], idx, ARGV[2])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[2], edges)
+redis.call('ZINCRBY', KEYS[3], needed, ARGV[2])
+redis.call('ZINCRBY', KEYS[3], -needed, ARGV[1])
+redis.call('SADD', "node:" .. ARGV[2] .. ":sessions", ARGV[3])
+redis.call('SREM', "node:" .. ARGV[1] .. ":sessions", ARGV[3])
+return "OK"
+`
+
+// ReplaceRelayInChain sposta la posizione di un relay nella catena su un altro relay
+func (c *Client) ReplaceRelayInChain(ctx context.Context, sessionId, oldId, newId string) error {
+	keys := []string{
+		fmt.Sprintf("session:%s:chain", sessionId),
+		fmt.Sprintf("session:%s:edge_counts", sessionId),
+		"pool:relay:load",
+	}
+	res, err := c.rdb.Eval(ctx, replaceRelayInChainLua, keys, oldId, newId, sessionId).Result()
+	if err != nil {
+		return err
+	}
+	if res.(string) != "OK" {
+		return fmt.Errorf("cannot replace %s with %s in chain of %s: %s", oldId, newId, sessionId, res)
+	}
+	return nil
+}
+
+// RepointSessionRelay aggiorna rotte, parent degli egress e path dopo ReplaceRelayInChain
+func (c *Client) RepointSessionRelay(ctx context.Context, sessionId, parentId, oldId, newId string) error {
+	oldRoutes := fmt.Sprintf("routing:%s:%s", sessionId, oldId)
+	newRoutes := fmt.Sprintf("routing:%s:%s", sessionId, newId)
+	parentRoutes := fmt.Sprintf("routing:%s:%s", sessionId, parentId)
+	parentsKey := fmt.Sprintf("session:%s:egress_parents", sessionId)
+
+	egressParents, err := c.rdb.HGetAll(ctx, parentsKey).Result()
+	if err != nil {
+		return err
+	}
+	egresses, err := c.GetSessionEgresses(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+
+	pipe := c.rdb.TxPipeline()
+	if exists, _ := c.rdb.Exists(ctx, oldRoutes).Result(); exists > 0 {
+		pipe.Rename(ctx, oldRoutes, newRoutes)
+	}
+	pipe.SRem(ctx, parentRoutes, oldId)
+	pipe.SAdd(ctx, parentRoutes, newId)
+
+	for egressId, relayId := range egressParents {
+		if relayId == oldId {
+			pipe.HSet(ctx, parentsKey, egressId, newId)
+		}
+	}
+
+	for _, egressId := range egresses {
+		path, err := c.GetSessionPath(ctx, sessionId, egressId)
+		if err != nil {
+			continue
+		}
+		for i, nodeId := range path {
+			if nodeId == oldId {
+				path[i] = newId
+			}
+		}
+		pipe.Set(ctx, fmt.Sprintf("path:%s:%s", sessionId, egressId), strings.Join(path, ","), 0)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to repoint session %s from %s to %s: %w", sessionId, oldId, newId, err)
+	}
+	return nil
+}
+
+// FindRelayForMigration cerca il relay standalone attivo meno carico con almeno needed slot liberi
+func (c *Client) FindRelayForMigration(ctx context.Context, excludeNodes []string, needed int) (string, error) {
+	relays, err := c.rdb.ZRangeWithScores(ctx, "pool:relay:load", 0, -1).Result()
+	if err != nil {
+		return "", err
+	}
+
+	excludeMap := make(map[string]bool)
+	for _, n := range excludeNodes {
+		excludeMap[n] = true
+	}
+
+	for _, r := range relays {
+		nodeId := r.Member.(string)
+		if excludeMap[nodeId] {
+			continue
+		}
+
+		status, _ := c.GetNodeStatus(ctx, nodeId)
+		if status != "active" {
+			continue
+		}
+
+		nodeInfo, err := c.GetNodeProvisioning(ctx, nodeId)
+		if err != nil || nodeInfo.Role != "standalone" {
+			continue
+		}
+
+		if float64(nodeInfo.MaxSlots)-r.Score >= float64(needed) {
+			return nodeId, nil
+		}
+	}
+
+	return "", fmt.Errorf("no standalone relay with %d free slots", needed)
+}
+
+// PublishSessionMigrating avvisa un nodo che la sessione si sta spostando su targetId
+func (c *Client) PublishSessionMigrating(
+	ctx context.Context,
+	nodeId string,
+	sessionId string,
+	targetId string,
+) error {
+	channel := fmt.Sprintf("node:%s:sessions", nodeId)
+
+	event := map[string]any{
+		"type":      "session-migrating",
+		"sessionId": sessionId,
+		"targetId":  targetId,
+	}
+
+	return c.PublishSessionEvent(ctx, channel, event)
+}
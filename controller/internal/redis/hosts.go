@@ -0,0 +1,138 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Chiavi:
+// host:{host}:pods      HASH nodeId -> HostAllocation (JSON)
+// hosts:allocations     HASH nodeId -> host
+
+var (
+	ErrHostNoSlot      = errors.New("host has no free port slot")
+	ErrHostNoCPU       = errors.New("host CPU budget exhausted")
+	ErrHostNoBandwidth = errors.New("host bandwidth budget exhausted")
+)
+
+// HostAllocation slot di porte e risorse assegnati a un pod su un host
+type HostAllocation struct {
+	NodeId        string `json:"nodeId"`
+	Slot          int    `json:"slot"`
+	CPUMilli      int64  `json:"cpuMilli"`
+	BandwidthMbps int    `json:"bandwidthMbps"`
+}
+
+// HostBudget capacità dichiarata di un host
+type HostBudget struct {
+	Slots         int
+	CPUMilli      int64
+	BandwidthMbps int // 0 = non limitata
+}
+
+func hostPodsKey(host string) string {
+	return fmt.Sprintf("host:%s:pods", host)
+}
+
+// allocateHostSlotLua:
+// Sceglie il primo slot libero se CPU e banda residue bastano
+// Un nodo che ha già uno slot sull'host lo ritrova
+var allocateHostSlotLua = `
+-- KEYS[1] -> host:{host}:pods, KEYS[2] -> hosts:allocations
+-- ARGV[1] -> nodeId, ARGV[2] -> host, ARGV[3] -> slot totali
+-- ARGV[4] -> budget CPU (milli), ARGV[5] -> CPU richiesta
+-- ARGV[6] -> budget banda (0 = illimitata), ARGV[7] -> banda richiesta
+local existing = redis.call('HGET', KEYS[1], ARGV[1])
+if existing then
+    return cjson.decode(existing).slot
+end
+
+local used = {}
+local cpu = 0
+local bandwidth = 0
+for _, raw in ipairs(redis.call('HVALS', KEYS[1])) do
+    local entry = cjson.decode(raw)
+    used[entry.slot] = true
+    cpu = cpu + (entry.cpuMilli or 0)
+    bandwidth = bandwidth + (entry.bandwidthMbps or 0)
+end
+
+if cpu + tonumber(ARGV[5]) > tonumber(ARGV[4]) then
+    return -2
+end
+local bw_budget = tonumber(ARGV[6])
+if bw_budget > 0 and bandwidth + tonumber(ARGV[7]) > bw_budget then
+    return -3
+end
+
+for slot = 0, tonumber(ARGV[3]) - 1 do
+    if not used[slot] then
+        redis.call('HSET', KEYS[1], ARGV[1], cjson.encode({
+            nodeId = ARGV[1], slot = slot, cpuMilli = tonumber(ARGV[5]), bandwidthMbps = tonumber(ARGV[7])
+        }))
+        redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+        return slot
+    end
+end
+return -1
+`
+
+// AllocateHostSlot riserva uno slot di porte sull'host per il nodo
+// Ritorna ErrHostNoSlot, ErrHostNoCPU o ErrHostNoBandwidth se l'host è pieno
+func (c *Client) AllocateHostSlot(ctx context.Context, host, nodeId string, budget HostBudget, cpuMilli int64, bandwidthMbps int) (int, error) {
+	keys := []string{hostPodsKey(host), "hosts:allocations"}
+	slot, err := c.rdb.Eval(ctx, allocateHostSlotLua, keys,
+		nodeId, host, budget.Slots, budget.CPUMilli, cpuMilli, budget.BandwidthMbps, bandwidthMbps).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate slot on %s: %w", host, err)
+	}
+
+	switch slot {
+	case -1:
+		return 0, ErrHostNoSlot
+	case -2:
+		return 0, ErrHostNoCPU
+	case -3:
+		return 0, ErrHostNoBandwidth
+	}
+	return slot, nil
+}
+
+// ReleaseHostSlot libera lo slot del nodo (nessun effetto se non ne ha)
+func (c *Client) ReleaseHostSlot(ctx context.Context, nodeId string) error {
+	host, err := c.rdb.HGet(ctx, "hosts:allocations", nodeId).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil
+		}
+		return err
+	}
+
+	pipe := c.rdb.TxPipeline()
+	pipe.HDel(ctx, hostPodsKey(host), nodeId)
+	pipe.HDel(ctx, "hosts:allocations", nodeId)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetHostAllocations ritorna gli slot occupati su un host
+func (c *Client) GetHostAllocations(ctx context.Context, host string) ([]HostAllocation, error) {
+	entries, err := c.rdb.HVals(ctx, hostPodsKey(host)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allocations of %s: %w", host, err)
+	}
+
+	allocations := make([]HostAllocation, 0, len(entries))
+	for _, entry := range entries {
+		var alloc HostAllocation
+		if err := json.Unmarshal([]byte(entry), &alloc); err != nil {
+			continue
+		}
+		allocations = append(allocations, alloc)
+	}
+	return allocations, nil
+}
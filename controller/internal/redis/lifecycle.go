@@ -0,0 +1,200 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// Stati del ciclo di vita di un nodo
+const (
+	NodeStatusProvisioning = "provisioning" // Richiesto al provisioner
+	NodeStatusRegistering  = "registering"  // Processo avviato, si sta registrando
+	NodeStatusReady        = "ready"        // Registrato, non ancora selezionabile
+	NodeStatusActive       = "active"       // Nel pool selezionabile
+	NodeStatusStandby      = "standby"      // Warm standby, promuovibile
+	NodeStatusCordoned     = "cordoned"     // Manutenzione: solo sessioni esistenti
+	NodeStatusDraining     = "draining"     // Sessioni in uscita
+	NodeStatusDestroying   = "destroying"   // Distruzione in corso
+	NodeStatusGone         = "gone"         // Rimosso
+	NodeStatusFailed       = "failed"       // Provisioning fallito o processo morto
+)
+
+// Quanto resta lo storico dopo la rimozione del nodo
+const NodeHistoryTTL = 24 * time.Hour
+
+// Voci di storico tenute per nodo
+const nodeHistoryLimit = 100
+
+var ErrInvalidTransition = errors.New("invalid node status transition")
+
+// nodeTransitions: stato di partenza -> stati raggiungibili
+// "" è il nodo senza stato (hash assente o nodo avviato fuori dal controller)
+var nodeTransitions = map[string][]string{
+	"":                     {NodeStatusProvisioning, NodeStatusRegistering, NodeStatusDestroying},
+	NodeStatusProvisioning: {NodeStatusRegistering, NodeStatusFailed, NodeStatusDestroying},
+	NodeStatusRegistering:  {NodeStatusReady, NodeStatusFailed, NodeStatusDestroying},
+	NodeStatusReady:        {NodeStatusActive, NodeStatusStandby, NodeStatusFailed, NodeStatusDestroying},
+	NodeStatusStandby:      {NodeStatusActive, NodeStatusFailed, NodeStatusDestroying},
+	NodeStatusActive:       {NodeStatusCordoned, NodeStatusDraining, NodeStatusFailed, NodeStatusDestroying},
+	NodeStatusCordoned:     {NodeStatusActive, NodeStatusDraining, NodeStatusFailed, NodeStatusDestroying},
+	NodeStatusDraining:     {NodeStatusActive, NodeStatusFailed, NodeStatusDestroying},
+	NodeStatusFailed:       {NodeStatusRegistering, NodeStatusDestroying}, // registering: Pod ricreato
+	NodeStatusDestroying:   {NodeStatusGone},
+}
+
+// NodeTransition voce dello storico di un nodo
+type NodeTransition struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Actor  string `json:"actor"` // controller, autoscaler, drain, api, node:{id}...
+	Reason string `json:"reason,omitempty"`
+	At     int64  `json:"at"`
+}
+
+// Chiavi:
+// node:{nodeId}:history   LIST transizioni (più recente in testa)
+
+func nodeHistoryKey(nodeId string) string {
+	return fmt.Sprintf("node:%s:history", nodeId)
+}
+
+// CanTransition indica se il modello ammette il passaggio from -> to
+func CanTransition(from, to string) bool {
+	return from == to || slices.Contains(nodeTransitions[from], to)
+}
+
+// transitionNodeLua:
+// Compare-and-set dello stato: scrive solo se lo stato attuale è tra quelli ammessi
+// Stesso stato = nessuna scrittura e nessuna voce di storico
+var transitionNodeLua = `
+-- KEYS[1] -> node:{id}, KEYS[2] -> node:{id}:history, KEYS[3] -> global:active_nodes
+-- ARGV[1] -> nodeId, ARGV[2] -> stato di destinazione, ARGV[3] -> actor, ARGV[4] -> reason
+-- ARGV[5] -> timestamp ms, ARGV[6] -> limite storico, ARGV[7..] -> stati di partenza ammessi
+local current = redis.call('HGET', KEYS[1], 'status') or ''
+if current == ARGV[2] then
+    return {'OK', current}
+end
+
+local allowed = false
+for i = 7, #ARGV do
+    if ARGV[i] == current then
+        allowed = true
+        break
+    end
+end
+if not allowed then
+    return {'INVALID', current}
+end
+
+redis.call('HSET', KEYS[1], 'status', ARGV[2])
+redis.call('LPUSH', KEYS[2], cjson.encode({
+    from = current, to = ARGV[2], actor = ARGV[3], reason = ARGV[4], at = tonumber(ARGV[5])
+}))
+redis.call('LTRIM', KEYS[2], 0, tonumber(ARGV[6]) - 1)
+
+-- Sincronizza lista globale
+if ARGV[2] == 'active' then
+    redis.call('SADD', KEYS[3], ARGV[1])
+elseif ARGV[2] == 'destroying' or ARGV[2] == 'gone' or ARGV[2] == 'failed' then
+    redis.call('SREM', KEYS[3], ARGV[1])
+end
+return {'OK', current}
+`
+
+// TransitionNodeStatus porta il nodo nello stato to se il modello lo ammette
+// Ritorna lo stato precedente. Su transizione non ammessa ritorna ErrInvalidTransition
+func (c *Client) TransitionNodeStatus(ctx context.Context, nodeId, to, actor, reason string) (string, error) {
+	var from []string
+	for state, targets := range nodeTransitions {
+		if slices.Contains(targets, to) {
+			from = append(from, state)
+		}
+	}
+	if len(from) == 0 {
+		return "", fmt.Errorf("%w: unknown status %q", ErrInvalidTransition, to)
+	}
+
+	keys := []string{
+		fmt.Sprintf("node:%s", nodeId),
+		nodeHistoryKey(nodeId),
+		"global:active_nodes",
+	}
+	args := []any{nodeId, to, actor, reason, time.Now().UnixMilli(), nodeHistoryLimit}
+	for _, state := range from {
+		args = append(args, state)
+	}
+
+	res, err := c.rdb.Eval(ctx, transitionNodeLua, keys, args...).Slice()
+	if err != nil {
+		return "", fmt.Errorf("failed to transition node %s to %s: %w", nodeId, to, err)
+	}
+
+	current, _ := res[1].(string)
+	if res[0].(string) != "OK" {
+		return current, fmt.Errorf("%w: %s -> %s on node %s", ErrInvalidTransition, current, to, nodeId)
+	}
+
+	if current != to {
+		log.Printf("[Redis] Node %s: %s -> %s (%s: %s)", nodeId, current, to, actor, reason)
+	}
+	return current, nil
+}
+
+// BeginNodeProvisioning crea lo stato iniziale del nodo prima della chiamata al provisioner
+// target (active o standby) segna il nodo come gestito dal controller: registrandosi si ferma
+// in ready e ce lo porta il controller. Senza target il nodo va in active da solo
+// Il TTL viene rinnovato dal nodo alla registrazione: un provisioning mai concluso scade
+func (c *Client) BeginNodeProvisioning(ctx context.Context, nodeId, target, actor string) error {
+	key := fmt.Sprintf("node:%s", nodeId)
+	if err := c.rdb.HSet(ctx, key, "target", target).Err(); err != nil {
+		return fmt.Errorf("failed to set target for %s: %w", nodeId, err)
+	}
+	c.rdb.Expire(ctx, key, 10*time.Minute)
+
+	_, err := c.TransitionNodeStatus(ctx, nodeId, NodeStatusProvisioning, actor, "provisioning requested")
+	return err
+}
+
+// RecoverNodeLifecycle riporta un nodo failed in registering dopo la ricreazione del suo Pod
+// Senza target il nodo registrandosi torna in active da solo
+func (c *Client) RecoverNodeLifecycle(ctx context.Context, nodeId, actor, reason string) error {
+	if _, err := c.TransitionNodeStatus(ctx, nodeId, NodeStatusRegistering, actor, reason); err != nil {
+		return err
+	}
+	return c.rdb.HDel(ctx, fmt.Sprintf("node:%s", nodeId), "target").Err()
+}
+
+// FinishNodeLifecycle porta il nodo in gone (passando da destroying se serve)
+// Lo storico sopravvive al nodo per NodeHistoryTTL
+func (c *Client) FinishNodeLifecycle(ctx context.Context, nodeId, actor, reason string) {
+	if _, err := c.TransitionNodeStatus(ctx, nodeId, NodeStatusDestroying, actor, reason); err != nil {
+		log.Printf("[WARN] Node %s: %v", nodeId, err)
+	}
+	if _, err := c.TransitionNodeStatus(ctx, nodeId, NodeStatusGone, actor, reason); err != nil {
+		log.Printf("[WARN] Node %s: %v", nodeId, err)
+	}
+	c.rdb.Expire(ctx, nodeHistoryKey(nodeId), NodeHistoryTTL)
+}
+
+// GetNodeHistory ritorna le transizioni del nodo, dalla più recente
+func (c *Client) GetNodeHistory(ctx context.Context, nodeId string) ([]NodeTransition, error) {
+	entries, err := c.rdb.LRange(ctx, nodeHistoryKey(nodeId), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node history: %w", err)
+	}
+
+	history := make([]NodeTransition, 0, len(entries))
+	for _, entry := range entries {
+		var t NodeTransition
+		if err := json.Unmarshal([]byte(entry), &t); err != nil {
+			continue
+		}
+		history = append(history, t)
+	}
+	return history, nil
+}
@@ -6,6 +6,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
 // SetWithTTL salva una chiave con TTL
@@ -129,3 +131,16 @@ func (c *Client) GetNodeTotalViewers(ctx context.Context, nodeId string) (int, e
 	}
 	return strconv.Atoi(val)
 }
+
+// GetMountpointViewers legge i viewer di una sessione su un egress (mountpointId = roomId)
+func (c *Client) GetMountpointViewers(ctx context.Context, egressId string, mountpointId int) (int, error) {
+	key := fmt.Sprintf("metrics:node:%s:mountpoint:%d", egressId, mountpointId)
+	val, err := c.rdb.HGet(ctx, key, "viewers").Result()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.Atoi(val)
+}
@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Stream degli eventi di guasto dei nodi, consumato dalla riparazione delle sessioni
+// Stream e non pub/sub: un evento pubblicato mentre il controller è giù non va perso
+const NodeFailuresStream = "nodes:failures"
+
+// Eventi tenuti nello stream (MAXLEN approssimato)
+const nodeFailuresMaxLen = 10000
+
+// Tipi di evento di guasto
+const (
+	NodeEventFailed    = "node-failed"    // Processo morto: il nodo non tornerà
+	NodeEventRestarted = "node-restarted" // Container riavviato: sessioni del nodo perse
+)
+
+// NodeFailureEvent guasto rilevato dal provisioner
+type NodeFailureEvent struct {
+	Type     string `json:"type"`
+	NodeId   string `json:"nodeId"`
+	NodeType string `json:"nodeType"`
+	Cause    string `json:"cause"`  // failed, oom-killed, evicted, deleted, restarted, unhealthy, unreachable
+	Reason   string `json:"reason"` // Dettaglio leggibile
+	Previous string `json:"previousStatus,omitempty"`
+	At       int64  `json:"at"`
+}
+
+// NodeFailureMessage evento letto dallo stream, da confermare con AckNodeFailure
+type NodeFailureMessage struct {
+	Id    string
+	Event NodeFailureEvent
+}
+
+// PublishNodeFailure aggiunge un evento di guasto a nodes:failures
+func (c *Client) PublishNodeFailure(ctx context.Context, event NodeFailureEvent) error {
+	if event.At == 0 {
+		event.At = time.Now().UnixMilli()
+	}
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal node failure: %w", err)
+	}
+	return c.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: NodeFailuresStream,
+		MaxLen: nodeFailuresMaxLen,
+		Approx: true,
+		Values: map[string]any{"event": eventJSON},
+	}).Err()
+}
+
+// EnsureNodeFailureGroup crea il consumer group (nessun effetto se esiste già)
+// Un gruppo nuovo legge anche gli eventi già nello stream
+func (c *Client) EnsureNodeFailureGroup(ctx context.Context, group string) error {
+	err := c.rdb.XGroupCreateMkStream(ctx, NodeFailuresStream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group %s: %w", group, err)
+	}
+	return nil
+}
+
+// ClaimNodeFailures prende in carico gli eventi non confermati da più di minIdle
+// (consumer morto a metà gestione)
+func (c *Client) ClaimNodeFailures(ctx context.Context, group, consumer string, minIdle time.Duration) ([]NodeFailureMessage, error) {
+	messages, _, err := c.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   NodeFailuresStream,
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    "0-0",
+		Count:    100,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim node failures: %w", err)
+	}
+	return c.decodeNodeFailures(ctx, group, messages), nil
+}
+
+// ReadNodeFailures legge i nuovi eventi per il consumer, attendendo fino a block
+func (c *Client) ReadNodeFailures(ctx context.Context, group, consumer string, block time.Duration) ([]NodeFailureMessage, error) {
+	streams, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{NodeFailuresStream, ">"},
+		Count:    10,
+		Block:    block,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read node failures: %w", err)
+	}
+
+	var messages []NodeFailureMessage
+	for _, stream := range streams {
+		messages = append(messages, c.decodeNodeFailures(ctx, group, stream.Messages)...)
+	}
+	return messages, nil
+}
+
+// AckNodeFailure conferma la gestione di un evento
+func (c *Client) AckNodeFailure(ctx context.Context, group, id string) error {
+	return c.rdb.XAck(ctx, NodeFailuresStream, group, id).Err()
+}
+
+// decodeNodeFailures converte i messaggi; quelli illeggibili vengono confermati e scartati
+func (c *Client) decodeNodeFailures(ctx context.Context, group string, messages []redis.XMessage) []NodeFailureMessage {
+	result := make([]NodeFailureMessage, 0, len(messages))
+	for _, message := range messages {
+		raw, _ := message.Values["event"].(string)
+		var event NodeFailureEvent
+		if err := json.Unmarshal([]byte(raw), &event); err != nil || event.NodeId == "" {
+			c.rdb.XAck(ctx, NodeFailuresStream, group, message.ID)
+			continue
+		}
+		result = append(result, NodeFailureMessage{Id: message.ID, Event: event})
+	}
+	return result
+}
@@ -10,15 +10,15 @@ import (
 
 // NodeData rappresenta quello che BaseNode salva in Redis
 type NodeData struct {
-	NodeId    string `redis:"nodeId"`
-	NodeType  string `redis:"type"`
-	Role      string `redis:"role"`
-	Host      string `redis:"host"`
-	Port      int    `redis:"port"`
-	AudioPort int    `redis:"audioPort"`
-	VideoPort int    `redis:"videoPort"`
-	Status    string `redis:"status"`
-	Created   int64  `redis:"created"`
+	NodeId    string `json:"nodeId" redis:"nodeId"`
+	NodeType  string `json:"type" redis:"type"`
+	Role      string `json:"role" redis:"role"`
+	Host      string `json:"host" redis:"host"`
+	Port      int    `json:"port" redis:"port"`
+	AudioPort int    `json:"audioPort" redis:"audioPort"`
+	VideoPort int    `json:"videoPort" redis:"videoPort"`
+	Status    string `json:"status" redis:"status"`
+	Created   int64  `json:"created" redis:"created"`
 }
 
 // Pool
@@ -89,11 +89,16 @@ func (c *Client) ForceDeleteNode(
 ) error {
 	log.Printf("[Redis] Force deleting node %s", nodeId)
 
+	// Chiude il ciclo di vita: lo storico resta consultabile dopo la rimozione
+	c.FinishNodeLifecycle(ctx, nodeId, "controller", "node removed")
+
 	// Rimuovi dalla lista globale
 	c.rdb.SRem(ctx, "global:active_nodes", nodeId)
+	c.rdb.SRem(ctx, "nodes:cordoned", nodeId)
 
 	// Rimuovi da pool
 	c.RemoveNodeFromPool(ctx, nodeType, nodeId)
+	c.RemoveStandbyNode(ctx, nodeType, nodeId)
 
 	// Rimuovi dal pool di carichi
 	switch nodeType {
@@ -109,6 +114,7 @@ func (c *Client) ForceDeleteNode(
 		fmt.Sprintf("node:%s:children", nodeId),
 		fmt.Sprintf("node:%s:parents", nodeId),
 		fmt.Sprintf("node:%s:sessions", nodeId),
+		fmt.Sprintf("node:%s:cordon", nodeId),
 		// Chiavi metriche note
 		fmt.Sprintf("metrics:node:%s:application", nodeId),
 		fmt.Sprintf("metrics:node:%s:nodejs", nodeId),
@@ -131,36 +137,6 @@ func (c *Client) ForceDeleteNode(
 	return nil
 }
 
-// SetNodeStatus imposta lo stato operativo del nodo (active, draining)
-func (c *Client) SetNodeStatus(ctx context.Context, nodeId string, status string) error {
-	// Aggiorna stato locale del nodo
-	key := fmt.Sprintf("node:%s", nodeId)
-	if err := c.rdb.HSet(ctx, key, "status", status).Err(); err != nil {
-		return fmt.Errorf("failed to update node status hash: %w", err)
-	}
-
-	// Sincronizza lista globale
-	globalKey := "global:active_nodes"
-
-	switch status {
-	case "destroying":
-		// Rimuovi dalla lista globale
-		if err := c.rdb.SRem(ctx, globalKey, nodeId).Err(); err != nil {
-			log.Printf("[WARN] Failed to remove %s from global list: %v", nodeId, err)
-		}
-
-	case "active":
-		// Aggiungi alla lista globale
-		if err := c.rdb.SAdd(ctx, globalKey, nodeId).Err(); err != nil {
-			log.Printf("[WARN] Failed to add %s to global list: %v", nodeId, err)
-		}
-
-	default:
-	}
-
-	return nil
-}
-
 // GetNodeStatus legge lo stato. Default: "active"
 func (c *Client) GetNodeStatus(ctx context.Context, nodeId string) (string, error) {
 	key := fmt.Sprintf("node:%s", nodeId)
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -11,12 +12,19 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// ErrProvisioningNotFound il nodo non ha (più) provisioning: distinto dagli errori di Redis
+var ErrProvisioningNotFound = errors.New("node provisioning not found")
+
 // NodeProvisioningData è quello che il controller salva in Redis
 type NodeProvisioningData struct {
 	NodeId   string `json:"nodeId" redis:"nodeId"`
 	NodeType string `json:"nodeType" redis:"nodeType"`
 	Role     string `json:"role" redis:"role"`
 	MaxSlots int    `json:"maxSlots" redis:"maxSlots"`
+	Backend  string `json:"backend,omitempty" redis:"backend"`
+	// Profilo di risorse e capacità
+	Profile    string `json:"profile,omitempty" redis:"profile"`
+	MaxViewers int    `json:"maxViewers,omitempty" redis:"maxViewers"`
 	// Docker
 	ContainerId      string `json:"containerId" redis:"containerId"`
 	JanusContainerId string `json:"janusContainerId,omitempty" redis:"janusContainerId"`
@@ -30,7 +38,11 @@ type NodeProvisioningData struct {
 	WebRTCPortEnd   int    `json:"webrtcPortEnd,omitempty" redis:"webrtcPortEnd"`
 	StreamPortStart int    `json:"streamPortStart,omitempty" redis:"streamPortStart"`
 	StreamPortEnd   int    `json:"streamPortEnd,omitempty" redis:"streamPortEnd"`
+	RTPAudioPort    int    `json:"rtpAudioPort,omitempty" redis:"rtpAudioPort"`
+	RTPVideoPort    int    `json:"rtpVideoPort,omitempty" redis:"rtpVideoPort"`
 	InternalHost    string `json:"internalHost" redis:"internalHost"`
+	ExternalHost    string `json:"externalHost,omitempty" redis:"externalHost"`
+	JanusHost       string `json:"janusHost,omitempty" redis:"janusHost"`
 	// Metadata
 	CreatedBy string `json:"createdBy" redis:"createdBy"`
 	CreatedAt int64  `json:"createdAt" redis:"createdAt"`
@@ -47,9 +59,14 @@ func (c *Client) SaveNodeProvisioning(ctx context.Context, nodeInfo *domain.Node
 		NodeType:         string(nodeInfo.NodeType),
 		Role:             nodeInfo.Role,
 		MaxSlots:         nodeInfo.MaxSlots,
+		Backend:          nodeInfo.Backend,
+		Profile:          nodeInfo.Profile,
+		MaxViewers:       nodeInfo.MaxViewers,
 		ContainerId:      nodeInfo.ContainerId,
 		JanusContainerId: nodeInfo.JanusContainerId,
 		InternalHost:     nodeInfo.InternalHost,
+		ExternalHost:     nodeInfo.ExternalHost,
+		JanusHost:        nodeInfo.JanusHost,
 		InternalAPIPort:  nodeInfo.InternalAPIPort,
 		ExternalAPIPort:  nodeInfo.ExternalAPIPort,
 		JanusHTTPPort:    nodeInfo.JanusHTTPPort,
@@ -58,6 +75,8 @@ func (c *Client) SaveNodeProvisioning(ctx context.Context, nodeInfo *domain.Node
 		WebRTCPortEnd:    nodeInfo.WebRTCPortEnd,
 		StreamPortStart:  nodeInfo.StreamPortStart,
 		StreamPortEnd:    nodeInfo.StreamPortEnd,
+		RTPAudioPort:     nodeInfo.InternalRTPAudio,
+		RTPVideoPort:     nodeInfo.InternalRTPVideo,
 		CreatedBy:        "controller",
 		CreatedAt:        time.Now().Unix(),
 	}
@@ -83,6 +102,49 @@ func (c *Client) SaveNodeProvisioning(ctx context.Context, nodeInfo *domain.Node
 	return nil
 }
 
+// Durata massima della prenotazione di un NodeId durante una registrazione esterna
+const NodeRegistrationTTL = 1 * time.Minute
+
+var reserveNodeIdsLua = `
+-- ARGV[1] -> TTL prenotazione (ms), ARGV[2..] -> nodeId
+-- Ritorna il primo nodeId già provisionato o in registrazione, "" se prenotati tutti
+for i = 2, #ARGV do
+    if redis.call('EXISTS', 'node:' .. ARGV[i] .. ':provisioning') == 1
+        or redis.call('EXISTS', 'node:' .. ARGV[i] .. ':registering') == 1 then
+        return ARGV[i]
+    end
+end
+for i = 2, #ARGV do
+    redis.call('SET', 'node:' .. ARGV[i] .. ':registering', '1', 'PX', ARGV[1])
+end
+return ''
+`
+
+// ReserveNodeIds prenota atomicamente i NodeId di una registrazione
+// Ritorna il primo NodeId già registrato (o in registrazione), "" se la prenotazione è riuscita
+func (c *Client) ReserveNodeIds(ctx context.Context, nodeIds []string, ttl time.Duration) (string, error) {
+	args := make([]any, 0, len(nodeIds)+1)
+	args = append(args, ttl.Milliseconds())
+	for _, nodeId := range nodeIds {
+		args = append(args, nodeId)
+	}
+
+	conflict, err := c.rdb.Eval(ctx, reserveNodeIdsLua, nil, args...).Text()
+	if err != nil {
+		return "", fmt.Errorf("failed to reserve node ids: %w", err)
+	}
+	return conflict, nil
+}
+
+// ReleaseNodeIds rilascia la prenotazione: da qui in poi vale il provisioning salvato
+func (c *Client) ReleaseNodeIds(ctx context.Context, nodeIds []string) {
+	keys := make([]string, len(nodeIds))
+	for i, nodeId := range nodeIds {
+		keys[i] = fmt.Sprintf("node:%s:registering", nodeId)
+	}
+	c.rdb.Del(ctx, keys...)
+}
+
 // GetNodeProvisioning legge info provisioning da Redis
 func (c *Client) GetNodeProvisioning(ctx context.Context, nodeId string) (*domain.NodeInfo, error) {
 	key := fmt.Sprintf("node:%s:provisioning", nodeId)
@@ -96,7 +158,7 @@ func (c *Client) GetNodeProvisioning(ctx context.Context, nodeId string) (*domai
 
 	// Se la mappa è vuota, la chiave non esiste
 	if len(result) == 0 {
-		return nil, fmt.Errorf("node provisioning not found: %s", nodeId)
+		return nil, fmt.Errorf("%w: %s", ErrProvisioningNotFound, nodeId)
 	}
 
 	var data NodeProvisioningData
@@ -105,40 +167,7 @@ func (c *Client) GetNodeProvisioning(ctx context.Context, nodeId string) (*domai
 		return nil, fmt.Errorf("failed to scan data: %w", err)
 	}
 
-	// Converti a NodeInfo
-	nodeInfo := &domain.NodeInfo{
-		NodeId:           data.NodeId,
-		NodeType:         domain.NodeType(data.NodeType),
-		Role:             data.Role,
-		MaxSlots:         data.MaxSlots,
-		ContainerId:      data.ContainerId,
-		CreatedAt:        data.CreatedAt,
-		InternalHost:     data.InternalHost,
-		JanusContainerId: data.JanusContainerId,
-		ExternalAPIPort:  data.ExternalAPIPort,
-		JanusHTTPPort:    data.JanusHTTPPort,
-		JanusWSPort:      data.JanusWSPort,
-		WebRTCPortStart:  data.WebRTCPortStart,
-		WebRTCPortEnd:    data.WebRTCPortEnd,
-		StreamPortStart:  data.StreamPortStart,
-		StreamPortEnd:    data.StreamPortEnd,
-		ExternalHost:     "localhost",
-	}
-
-	// Porte API interne
-	nodeInfo.InternalAPIPort = data.InternalAPIPort
-	nodeInfo.InternalRTPAudio = 5002
-	nodeInfo.InternalRTPVideo = 5004
-
-	// JanusHost dal nodeId
-	switch nodeInfo.NodeType {
-	case domain.NodeTypeInjection:
-		nodeInfo.JanusHost = nodeInfo.InternalHost + "-janus-vr"
-	case domain.NodeTypeEgress:
-		nodeInfo.JanusHost = nodeInfo.InternalHost + "-janus-streaming"
-	}
-
-	return nodeInfo, nil
+	return data.toNodeInfo(), nil
 }
 
 // GetActiveNodes ritorna tutti i nodi attivi
@@ -215,41 +244,60 @@ func (c *Client) GetAllProvisionedNodes(ctx context.Context) ([]*domain.NodeInfo
 			continue
 		}
 
-		// Mapping
-		nodeInfo := &domain.NodeInfo{
-			NodeId:           data.NodeId,
-			NodeType:         domain.NodeType(data.NodeType),
-			Role:             data.Role,
-			MaxSlots:         data.MaxSlots,
-			ContainerId:      data.ContainerId,
-			CreatedAt:        data.CreatedAt,
-			InternalHost:     data.InternalHost,
-			JanusContainerId: data.JanusContainerId,
-			ExternalAPIPort:  data.ExternalAPIPort,
-			JanusHTTPPort:    data.JanusHTTPPort,
-			JanusWSPort:      data.JanusWSPort,
-			WebRTCPortStart:  data.WebRTCPortStart,
-			WebRTCPortEnd:    data.WebRTCPortEnd,
-			StreamPortStart:  data.StreamPortStart,
-			StreamPortEnd:    data.StreamPortEnd,
-			ExternalHost:     "localhost",
-		}
+		nodes = append(nodes, data.toNodeInfo())
+	}
+
+	return nodes, nil
+}
+
+// toNodeInfo converte i dati salvati nel NodeInfo usato dal controller
+func (data *NodeProvisioningData) toNodeInfo() *domain.NodeInfo {
+	nodeInfo := &domain.NodeInfo{
+		NodeId:           data.NodeId,
+		NodeType:         domain.NodeType(data.NodeType),
+		Role:             data.Role,
+		MaxSlots:         data.MaxSlots,
+		Backend:          data.Backend,
+		Profile:          data.Profile,
+		MaxViewers:       data.MaxViewers,
+		ContainerId:      data.ContainerId,
+		CreatedAt:        data.CreatedAt,
+		InternalHost:     data.InternalHost,
+		JanusContainerId: data.JanusContainerId,
+		ExternalAPIPort:  data.ExternalAPIPort,
+		JanusHTTPPort:    data.JanusHTTPPort,
+		JanusWSPort:      data.JanusWSPort,
+		WebRTCPortStart:  data.WebRTCPortStart,
+		WebRTCPortEnd:    data.WebRTCPortEnd,
+		StreamPortStart:  data.StreamPortStart,
+		StreamPortEnd:    data.StreamPortEnd,
+		ExternalHost:     data.ExternalHost,
+		JanusHost:        data.JanusHost,
+	}
+	if nodeInfo.ExternalHost == "" {
+		nodeInfo.ExternalHost = "localhost"
+	}
 
-		// Porte API interne
-		nodeInfo.InternalAPIPort = data.InternalAPIPort
+	// Porte API interne
+	nodeInfo.InternalAPIPort = data.InternalAPIPort
+	// Porte RTP: salvate dai provisioner che le assegnano per nodo, altrimenti quelle standard
+	nodeInfo.InternalRTPAudio = data.RTPAudioPort
+	if nodeInfo.InternalRTPAudio == 0 {
 		nodeInfo.InternalRTPAudio = 5002
+	}
+	nodeInfo.InternalRTPVideo = data.RTPVideoPort
+	if nodeInfo.InternalRTPVideo == 0 {
 		nodeInfo.InternalRTPVideo = 5004
+	}
 
-		// Janus Host
-		switch nodeInfo.NodeType {
-		case domain.NodeTypeInjection:
-			nodeInfo.JanusHost = nodeInfo.InternalHost + "-janus-vr"
-		case domain.NodeTypeEgress:
-			nodeInfo.JanusHost = nodeInfo.InternalHost + "-janus-streaming"
-		}
-
-		nodes = append(nodes, nodeInfo)
+	// JanusHost dal nodeId (se il provisioner non l'ha salvato)
+	switch {
+	case nodeInfo.JanusHost != "":
+	case nodeInfo.IsInjection():
+		nodeInfo.JanusHost = nodeInfo.InternalHost + "-janus-vr"
+	case nodeInfo.IsEgress():
+		nodeInfo.JanusHost = nodeInfo.InternalHost + "-janus-streaming"
 	}
 
-	return nodes, nil
+	return nodeInfo
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -118,6 +119,27 @@ func (c *Client) FindEgressServingSession(
 	return c.GetSessionEgresses(ctx, sessionId)
 }
 
+// GetEgressSessions elenca le sessioni servite da un egress
+// Gli egress non hanno l'indice node:{id}:sessions: scansione delle sessioni globali
+func (c *Client) GetEgressSessions(ctx context.Context, egressId string) ([]string, error) {
+	sessionIds, err := c.GetGlobalSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []string
+	for _, sessionId := range sessionIds {
+		egresses, err := c.GetSessionEgresses(ctx, sessionId)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(egresses, egressId) {
+			sessions = append(sessions, sessionId)
+		}
+	}
+	return sessions, nil
+}
+
 // SaveSessionPath salva path costruito per coppia (session, egress)
 func (c *Client) SaveSessionPath(
 	ctx context.Context,
@@ -412,6 +434,12 @@ func (c *Client) FindBestRelayForDeepening(ctx context.Context, excludeNodes []s
 			continue
 		}
 
+		// Nodi in draining, cordoned o standby non ricevono nuove sessioni
+		status, _ := c.GetNodeStatus(ctx, nodeId)
+		if status != "active" {
+			continue
+		}
+
 		nodeInfo, err := c.GetNodeProvisioning(ctx, nodeId)
 		if err != nil || nodeInfo.Role != "standalone" {
 			continue
@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Chiavi:
+// pool:{nodeType}:standby   SET nodi pronti ma fuori dal pool selezionabile
+
+func standbyPoolKey(nodeType string) string {
+	return fmt.Sprintf("pool:%s:standby", nodeType)
+}
+
+// MarkNodeStandby fissa standby come stato di arrivo della registrazione del nodo
+// e lo tiene fuori dal pool selezionabile (lo stato lo porta il nodo registrandosi)
+func (c *Client) MarkNodeStandby(ctx context.Context, nodeType string, nodeId string) error {
+	pipe := c.rdb.TxPipeline()
+	pipe.HSet(ctx, fmt.Sprintf("node:%s", nodeId), "target", NodeStatusStandby)
+	pipe.SRem(ctx, fmt.Sprintf("pool:%s", nodeType), nodeId)
+	switch nodeType {
+	case "relay":
+		pipe.ZRem(ctx, "pool:relay:load", nodeId)
+	case "injection":
+		pipe.ZRem(ctx, "pool:injection:load", nodeId)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to mark node %s as standby: %w", nodeId, err)
+	}
+	return nil
+}
+
+// AddStandbyNode rende il nodo promuovibile da ScaleUp
+// (il relay-root di un injection in standby non ci entra: segue il padre)
+func (c *Client) AddStandbyNode(ctx context.Context, nodeType string, nodeId string) error {
+	if err := c.rdb.SAdd(ctx, standbyPoolKey(nodeType), nodeId).Err(); err != nil {
+		return fmt.Errorf("failed to add node to standby pool: %w", err)
+	}
+
+	log.Printf("[Redis] Added %s to standby pool %s", nodeId, standbyPoolKey(nodeType))
+	return nil
+}
+
+// PopStandbyNode estrae atomicamente un nodo dallo standby ("" se vuoto)
+func (c *Client) PopStandbyNode(ctx context.Context, nodeType string) (string, error) {
+	nodeId, err := c.rdb.SPop(ctx, standbyPoolKey(nodeType)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return nodeId, nil
+}
+
+// GetStandbyNodes ritorna i nodi in standby di un tier
+func (c *Client) GetStandbyNodes(ctx context.Context, nodeType string) ([]string, error) {
+	return c.rdb.SMembers(ctx, standbyPoolKey(nodeType)).Result()
+}
+
+// RemoveStandbyNode toglie un nodo dallo standby (es. nodo distrutto)
+func (c *Client) RemoveStandbyNode(ctx context.Context, nodeType string, nodeId string) error {
+	return c.rdb.SRem(ctx, standbyPoolKey(nodeType), nodeId).Err()
+}
@@ -0,0 +1,128 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"controller/internal/domain"
+)
+
+// TopologySnapshot fotografia di nodi e sessioni letta con un solo script Lua
+type TopologySnapshot struct {
+	TakenAt  time.Time
+	Nodes    map[string]*SnapshotNode
+	Sessions map[string]*SnapshotSession
+}
+
+type SnapshotNode struct {
+	Info     *domain.NodeInfo
+	Status   string
+	Children []string
+	InPool   bool    // pool:{type}
+	Standby  bool    // pool:{type}:standby
+	Load     float64 // pool:{type}:load (relay e injection)
+	HasLoad  bool
+}
+
+type SnapshotSession struct {
+	SessionId   string
+	InjectionId string
+	Chain       []string
+	Egresses    []string
+	Routes      map[string][]string // relay -> target (routing:{session}:{relay})
+}
+
+// topologySnapshotLua:
+// Nodi come la fotografia del cluster (senza metriche), più sessioni, catene, egress
+// e rotte dei relay di ogni catena, tutto nella stessa lettura atomica
+var topologySnapshotLua = snapshotNodesLua + `
+local sessions = {}
+for _, session_id in ipairs(redis.call('SMEMBERS', 'sessions:global')) do
+    local session = {
+        injectionId = redis.call('HGET', 'session:' .. session_id, 'injectionNodeId') or '',
+        routes = {}
+    }
+    local chain = redis.call('LRANGE', 'session:' .. session_id .. ':chain', 0, -1)
+    if #chain > 0 then
+        session.chain = chain
+    end
+    local egresses = redis.call('SMEMBERS', 'session:' .. session_id .. ':egresses')
+    if #egresses > 0 then
+        session.egresses = egresses
+    end
+    for _, relay_id in ipairs(chain) do
+        local targets = redis.call('SMEMBERS', 'routing:' .. session_id .. ':' .. relay_id)
+        if #targets > 0 then
+            session.routes[relay_id] = targets
+        end
+    end
+    sessions[session_id] = session
+end
+return cjson.encode({nodes = read_nodes({}), sessions = sessions})
+`
+
+type rawTopologySnapshot struct {
+	Nodes    map[string]rawSnapshotNode `json:"nodes"`
+	Sessions map[string]struct {
+		InjectionId string              `json:"injectionId"`
+		Chain       []string            `json:"chain"`
+		Egresses    []string            `json:"egresses"`
+		Routes      map[string][]string `json:"routes"`
+	} `json:"sessions"`
+}
+
+// GetTopologySnapshot legge topologia, carichi, catene e rotte in un'unica chiamata Lua
+func (c *Client) GetTopologySnapshot(ctx context.Context) (*TopologySnapshot, error) {
+	takenAt := time.Now()
+	res, err := c.rdb.Eval(ctx, topologySnapshotLua, nil).Text()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topology snapshot: %w", err)
+	}
+
+	var raw rawTopologySnapshot
+	if err := json.Unmarshal([]byte(res), &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode topology snapshot: %w", err)
+	}
+
+	snapshot := &TopologySnapshot{
+		TakenAt:  takenAt,
+		Nodes:    make(map[string]*SnapshotNode, len(raw.Nodes)),
+		Sessions: make(map[string]*SnapshotSession, len(raw.Sessions)),
+	}
+	for nodeId, rawNode := range raw.Nodes {
+		node := rawNode.toClusterNode()
+		if node == nil {
+			continue
+		}
+		status := node.Status
+		if status == "" {
+			status = NodeStatusActive // come GetNodeStatus
+		}
+		snapshot.Nodes[nodeId] = &SnapshotNode{
+			Info:     node.Info,
+			Status:   status,
+			Children: node.Children,
+			InPool:   node.InPool,
+			Standby:  node.Standby,
+			Load:     node.Load,
+			HasLoad:  node.HasLoad,
+		}
+	}
+	for sessionId, rawSession := range raw.Sessions {
+		routes := rawSession.Routes
+		if routes == nil {
+			routes = make(map[string][]string)
+		}
+		snapshot.Sessions[sessionId] = &SnapshotSession{
+			SessionId:   sessionId,
+			InjectionId: rawSession.InjectionId,
+			Chain:       rawSession.Chain,
+			Egresses:    rawSession.Egresses,
+			Routes:      routes,
+		}
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,270 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"controller/internal/autoscaler"
+	"controller/internal/redis"
+)
+
+const (
+	AdmissionPollInterval = 1 * time.Second
+	AdmissionMaxWait      = 60 * time.Second // Long-poll massimo per singola richiesta
+	AdmissionDeadline     = 3 * time.Minute  // Dopo la deadline il ticket scade
+	AdmissionTicketGrace  = 1 * time.Minute  // Il ticket resta leggibile dopo la chiusura
+	AdmissionStaleAfter   = 30 * time.Second // Ticket senza poll del client: viewer andato via
+	AdmissionClaimTimeout = 30 * time.Second // Presa in carico di un worker morto a metà
+	AdmissionWorkerTick   = 1 * time.Second
+)
+
+const (
+	TicketWaiting   = "waiting"
+	TicketAdmitting = "admitting" // Preso in carico dal worker, provisioning in corso
+	TicketAdmitted  = "admitted"
+	TicketExpired   = "expired"
+)
+
+// ErrTicketNotFound viene ritornato per ticket inesistenti o già rimossi
+var ErrTicketNotFound = errors.New("admission ticket not found")
+
+// AdmitViewer prova a provisionare un viewer. Se la mesh è piena, o altri viewer
+// sono già in attesa, il viewer entra in sala d'attesa e la richiesta resta in long-poll fino a wait
+func (sm *SessionManager) AdmitViewer(
+	ctx context.Context,
+	sessionId string,
+	wait time.Duration,
+) (*ViewerTicket, error) {
+	// Coda non vuota: si passa dietro agli altri (FIFO)
+	tier := ""
+	if head, err := sm.redis.GetAdmissionHead(ctx, sessionId); err == nil && head != nil {
+		tier = head.Tier
+	} else {
+		viewer, err := sm.ProvisionViewer(ctx, sessionId)
+		if err == nil {
+			return &ViewerTicket{SessionId: sessionId, Status: TicketAdmitted, Viewer: viewer}, nil
+		}
+
+		var capacityErr *CapacityError
+		if !errors.As(err, &capacityErr) {
+			return nil, err
+		}
+		tier = capacityErr.Tier
+	}
+
+	ticketId, err := newTicketId()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ticket := &redis.AdmissionTicket{
+		TicketId:   ticketId,
+		SessionId:  sessionId,
+		Tier:       tier,
+		Status:     TicketWaiting,
+		CreatedAt:  now.UnixMilli(),
+		Deadline:   now.Add(AdmissionDeadline).UnixMilli(),
+		LastPollAt: now.UnixMilli(),
+	}
+	if err := sm.redis.EnqueueViewerTicket(ctx, ticket, AdmissionTicketGrace); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Admission] Session %s: viewer queued with ticket %s (%s full)", sessionId, ticketId, tier)
+
+	return sm.WaitViewerTicket(ctx, sessionId, ticketId, wait)
+}
+
+// WaitViewerTicket controlla un ticket esistente, in long-poll fino a wait
+// L'ammissione la fa il worker: qui si legge solo lo stato e si tiene vivo il ticket
+func (sm *SessionManager) WaitViewerTicket(
+	ctx context.Context,
+	sessionId string,
+	ticketId string,
+	wait time.Duration,
+) (*ViewerTicket, error) {
+	if wait > AdmissionMaxWait {
+		wait = AdmissionMaxWait
+	}
+	waitUntil := time.Now().Add(wait)
+
+	for {
+		view, err := sm.readTicket(ctx, sessionId, ticketId)
+		if err != nil || view.Status != TicketWaiting || !time.Now().Before(waitUntil) {
+			return view, err
+		}
+
+		select {
+		case <-time.After(AdmissionPollInterval):
+		case <-ctx.Done():
+			// Client disconnesso: il ticket resta in coda finché non diventa stale
+			return view, nil
+		}
+	}
+}
+
+// readTicket stato del ticket e posizione in coda; registra il poll del client
+// Un ticket ammesso o scaduto tra la lettura e la posizione esce dalla coda: si rilegge l'esito
+func (sm *SessionManager) readTicket(ctx context.Context, sessionId, ticketId string) (*ViewerTicket, error) {
+	view, retry, err := sm.readTicketOnce(ctx, sessionId, ticketId)
+	if !retry {
+		return view, err
+	}
+
+	view, retry, err = sm.readTicketOnce(ctx, sessionId, ticketId)
+	if retry {
+		return nil, fmt.Errorf("failed to read queue position of ticket %s: %w", ticketId, err)
+	}
+	return view, err
+}
+
+// readTicketOnce una lettura del ticket. retry: ticket in attesa ma posizione in coda non letta
+func (sm *SessionManager) readTicketOnce(ctx context.Context, sessionId, ticketId string) (*ViewerTicket, bool, error) {
+	ticket, err := sm.redis.GetViewerTicket(ctx, ticketId)
+	if errors.Is(err, redis.ErrViewerTicketNotFound) || (err == nil && ticket.SessionId != sessionId) {
+		return nil, false, ErrTicketNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch ticket.Status {
+	case TicketAdmitted:
+		var viewer ViewSessionResponse
+		if err := json.Unmarshal([]byte(ticket.Result), &viewer); err != nil {
+			return nil, false, fmt.Errorf("failed to decode admission result: %w", err)
+		}
+		return sm.ticketView(ticket, 0, 0, &viewer), false, nil
+	case TicketExpired:
+		return sm.ticketView(ticket, 0, 0, nil), false, nil
+	}
+
+	sm.redis.TouchViewerTicket(ctx, ticketId, time.Now())
+
+	// Per il client un ticket in provisioning è ancora in attesa
+	ticket.Status = TicketWaiting
+
+	position, length, err := sm.redis.GetViewerTicketPosition(ctx, sessionId, ticketId)
+	if err != nil {
+		return nil, true, err
+	}
+	return sm.ticketView(ticket, position, length, nil), false, nil
+}
+
+// StartAdmissionWorker avvia il worker che ammette i viewer in coda, in ordine
+func (sm *SessionManager) StartAdmissionWorker(ctx context.Context) {
+	log.Printf("[Admission] Worker starting (interval=%v, stale after %v)", AdmissionWorkerTick, AdmissionStaleAfter)
+
+	go func() {
+		ticker := time.NewTicker(AdmissionWorkerTick)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				sessions, err := sm.redis.GetAdmissionSessions(ctx)
+				if err != nil {
+					log.Printf("[WARN] Admission worker: failed to list sessions: %v", err)
+					continue
+				}
+				for _, sessionId := range sessions {
+					sm.admitQueuedViewers(ctx, sessionId)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// admitQueuedViewers ammette i viewer della sessione dalla testa della coda,
+// fermandosi al primo che non trova capacità (chi segue non lo scavalca)
+func (sm *SessionManager) admitQueuedViewers(ctx context.Context, sessionId string) {
+	for {
+		now := time.Now()
+		ticketId, expired, err := sm.redis.ClaimAdmissionHead(ctx, sessionId,
+			now, now.Add(-AdmissionStaleAfter), now.Add(-AdmissionClaimTimeout))
+		if err != nil {
+			log.Printf("[WARN] Admission worker: %v", err)
+			return
+		}
+		for _, id := range expired {
+			log.Printf("[Admission] Ticket %s expired for session %s", id, sessionId)
+		}
+		if ticketId == "" {
+			return
+		}
+
+		ticket, err := sm.redis.GetViewerTicket(ctx, ticketId)
+		if err != nil {
+			continue
+		}
+
+		viewer, err := sm.ProvisionViewer(ctx, sessionId)
+		if err != nil {
+			sm.redis.ReleaseAdmissionClaim(ctx, ticketId)
+			if !errors.Is(err, ErrScalingNeeded) {
+				log.Printf("[WARN] Admission of ticket %s failed: %v", ticketId, err)
+			}
+			return
+		}
+
+		result, _ := json.Marshal(viewer)
+		if err := sm.redis.CompleteViewerTicket(ctx, ticket, TicketAdmitted, string(result)); err != nil {
+			log.Printf("[WARN] Failed to close ticket %s: %v", ticketId, err)
+			return
+		}
+		log.Printf("[Admission] Ticket %s admitted on egress %s", ticketId, viewer.EgressNodeId)
+	}
+}
+
+// ticketView costruisce la risposta con posizione e attesa stimata
+func (sm *SessionManager) ticketView(ticket *redis.AdmissionTicket, position, length int, viewer *ViewSessionResponse) *ViewerTicket {
+	view := &ViewerTicket{
+		TicketId:    ticket.TicketId,
+		SessionId:   ticket.SessionId,
+		Status:      ticket.Status,
+		Position:    position,
+		QueueLength: length,
+		Deadline:    time.UnixMilli(ticket.Deadline),
+		PollURL:     fmt.Sprintf("/api/sessions/%s/view/tickets/%s", ticket.SessionId, ticket.TicketId),
+		Viewer:      viewer,
+	}
+
+	if ticket.Status == TicketWaiting {
+		view.EstimatedWaitSec = estimateWait(ticket, position)
+	}
+	return view
+}
+
+// estimateWait: il nuovo nodo arriva entro il lead time di provisioning
+// calcolato dall'ingresso in coda, poi i viewer vengono ammessi uno per giro del worker
+func estimateWait(ticket *redis.AdmissionTicket, position int) int {
+	queuedFor := time.Since(time.UnixMilli(ticket.CreatedAt))
+	remaining := autoscaler.ProvisioningLeadTime - queuedFor
+	if remaining < AdmissionPollInterval {
+		remaining = AdmissionWorkerTick
+	}
+
+	estimate := remaining + time.Duration(position)*AdmissionWorkerTick
+	untilDeadline := time.Until(time.UnixMilli(ticket.Deadline))
+	if estimate > untilDeadline {
+		estimate = untilDeadline
+	}
+	return int(estimate.Seconds())
+}
+
+func newTicketId() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate ticket id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
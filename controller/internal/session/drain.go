@@ -0,0 +1,488 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"controller/internal/redis"
+)
+
+const (
+	DrainPollInterval    = 5 * time.Second
+	DrainDefaultDeadline = 10 * time.Minute
+	DrainMaxDeadline     = 2 * time.Hour
+	DrainMigrationGrace  = 10 * time.Second // Tempo dato ai viewer per ricollegarsi prima di chiudere il path
+	DrainProgressTTL     = 1 * time.Hour    // Il progresso resta leggibile dopo la chiusura
+	DrainLeaseTTL        = 30 * time.Second // Senza rinnovo il drain viene ripreso da un altro controller
+)
+
+const (
+	DrainRunning   = "running"
+	DrainCompleted = "completed"
+	DrainForced    = "forced"
+	DrainTimedOut  = "timed-out"
+)
+
+var (
+	ErrNodeNotFound   = errors.New("node not found")
+	ErrDrainRelayRoot = errors.New("relay root cannot be drained alone, drain its injection node")
+	ErrDrainNotFound  = errors.New("no drain for node")
+)
+
+// DrainOptions parametri di un drain
+type DrainOptions struct {
+	Deadline time.Duration // 0 = DrainDefaultDeadline
+	Force    bool          // Alla deadline chiude le sessioni rimaste
+	Destroy  bool          // A drain concluso distrugge il nodo
+}
+
+// NodeDestroyer distrugge un nodo a fine drain (implementato da TreeManager)
+type NodeDestroyer interface {
+	DestroyNode(ctx context.Context, nodeId, nodeType string) error
+}
+
+// SetNodeDestroyer collega il drain al TreeManager
+func (sm *SessionManager) SetNodeDestroyer(destroyer NodeDestroyer) {
+	sm.destroyer = destroyer
+}
+
+// StartDrain avvia lo svuotamento attivo di un nodo
+// Il nodo passa in draining (non più selezionabile) e le sessioni vengono spostate:
+// relay -> la posizione nella catena passa a un altro relay
+// egress -> viene preparato un altro egress e i viewer vengono invitati a ricollegarsi
+// injection -> si attende la fine delle sessioni (il broadcaster non si sposta)
+// Alla deadline, con force le sessioni rimaste vengono chiuse, altrimenti il drain scade
+// Una volta vuoto il nodo viene distrutto (con Destroy subito, altrimenti dall'autoscaler
+// come ogni nodo in draining)
+func (sm *SessionManager) StartDrain(
+	ctx context.Context,
+	nodeId string,
+	opts DrainOptions,
+) (*redis.DrainProgress, error) {
+	nodeInfo, err := sm.redis.GetNodeProvisioning(ctx, nodeId)
+	if err != nil || nodeInfo == nil {
+		return nil, ErrNodeNotFound
+	}
+	if nodeInfo.Role == "root" {
+		return nil, ErrDrainRelayRoot
+	}
+
+	// Drain già in corso: destroy si aggiunge alla chiusura, force la anticipa
+	if existing, err := sm.redis.GetDrainProgress(ctx, nodeId); err == nil && existing.Status == DrainRunning {
+		running := true
+		if opts.Destroy && !existing.Destroy {
+			if running, err = sm.redis.SetDrainDestroy(ctx, nodeId); err != nil {
+				return nil, err
+			}
+			if running {
+				log.Printf("[Drain] Node %s: destroy on completion requested", nodeId)
+			}
+		}
+		if running {
+			if opts.Force && !existing.Force {
+				// Senza deadline la chiusura forzata è immediata
+				if err := sm.redis.ForceDrain(ctx, nodeId, time.Now().Add(opts.Deadline)); err != nil {
+					return nil, err
+				}
+				log.Printf("[Drain] Node %s: forced completion requested", nodeId)
+			}
+			return sm.redis.GetDrainProgress(ctx, nodeId)
+		}
+		// Chiuso nel frattempo senza destroy: si riparte con un drain nuovo
+	}
+
+	deadline := opts.Deadline
+	if deadline <= 0 {
+		deadline = DrainDefaultDeadline
+	}
+	if deadline > DrainMaxDeadline {
+		deadline = DrainMaxDeadline
+	}
+
+	nodeType := string(nodeInfo.NodeType)
+	reason := "manual drain"
+	if opts.Destroy {
+		reason = "drain before destroy"
+	}
+	if _, err := sm.redis.TransitionNodeStatus(ctx, nodeId, redis.NodeStatusDraining, "drain", reason); err != nil {
+		return nil, fmt.Errorf("failed to mark %s as draining: %w", nodeId, err)
+	}
+
+	sessions := sm.drainSessions(ctx, nodeType, nodeId)
+	now := time.Now()
+	progress := &redis.DrainProgress{
+		NodeId:    nodeId,
+		NodeType:  nodeType,
+		Status:    DrainRunning,
+		Force:     opts.Force,
+		Destroy:   opts.Destroy,
+		StartedAt: now.UnixMilli(),
+		Deadline:  now.Add(deadline).UnixMilli(),
+		Total:     len(sessions),
+		Remaining: len(sessions),
+		// Rinnovata da runDrain a ogni giro
+		LeaseUntil: now.Add(DrainLeaseTTL).UnixMilli(),
+	}
+	if err := sm.redis.SaveDrainProgress(ctx, progress, 0); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Drain] Node %s (%s): draining %d sessions, deadline %v, force %v, destroy %v",
+		nodeId, nodeType, len(sessions), deadline, opts.Force, opts.Destroy)
+
+	go sm.runDrain(context.Background(), nodeId, nodeType)
+	return progress, nil
+}
+
+// EvacuateNode svuota un nodo che l'infrastruttura sta per togliere (es. kubectl drain)
+// Il nodo viene cordonato e drenato con force e destroy: a fine migrazione viene distrutto
+// Un drain manuale già in corso viene inasprito (force entro deadline, destroy)
+// I nodi senza sessioni (ready, standby) sono distrutti subito
+func (sm *SessionManager) EvacuateNode(ctx context.Context, nodeId, reason string, deadline time.Duration) error {
+	nodeInfo, err := sm.redis.GetNodeProvisioning(ctx, nodeId)
+	if err != nil || nodeInfo == nil {
+		return ErrNodeNotFound
+	}
+
+	status, _ := sm.redis.GetNodeStatus(ctx, nodeId)
+	switch status {
+	case redis.NodeStatusReady, redis.NodeStatusStandby:
+		if sm.destroyer == nil {
+			return nil
+		}
+		log.Printf("[Drain] Node %s (%s) evacuated without sessions: %s", nodeId, status, reason)
+		return sm.destroyer.DestroyNode(ctx, nodeId, string(nodeInfo.NodeType))
+	case redis.NodeStatusActive:
+		cordon := &redis.NodeCordon{
+			NodeId:    nodeId,
+			Reason:    reason,
+			CreatedAt: time.Now().UnixMilli(),
+		}
+		if err := sm.redis.CordonNode(ctx, cordon, 0, "k8s"); err != nil {
+			return err
+		}
+	case redis.NodeStatusCordoned, redis.NodeStatusDraining:
+		// Un drain già in corso viene portato a force e destroy da StartDrain
+	default:
+		return nil // In provisioning, fallito o già in distruzione
+	}
+
+	// Deadline esplicita: su un drain già in corso force senza deadline chiuderebbe subito
+	if deadline <= 0 {
+		deadline = DrainDefaultDeadline
+	}
+
+	log.Printf("[Drain] Node %s: evacuation requested (%s)", nodeId, reason)
+	_, err = sm.StartDrain(ctx, nodeId, DrainOptions{
+		Deadline: deadline,
+		Force:    true,
+		Destroy:  true,
+	})
+	return err
+}
+
+// GetDrain ritorna il progresso del drain di un nodo
+func (sm *SessionManager) GetDrain(ctx context.Context, nodeId string) (*redis.DrainProgress, error) {
+	progress, err := sm.redis.GetDrainProgress(ctx, nodeId)
+	if err != nil {
+		return nil, ErrDrainNotFound
+	}
+	return progress, nil
+}
+
+// StartDrainRecovery riprende i drain rimasti senza controller (riavvio o crash)
+// La lease viene rinnovata a ogni giro di runDrain: scaduta, il drain è orfano
+func (sm *SessionManager) StartDrainRecovery(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(DrainLeaseTTL / 2)
+		defer ticker.Stop()
+
+		for {
+			sm.resumeDrains(ctx)
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (sm *SessionManager) resumeDrains(ctx context.Context) {
+	nodeIds, err := sm.redis.GetRunningDrains(ctx)
+	if err != nil {
+		log.Printf("[WARN] Failed to list running drains: %v", err)
+		return
+	}
+
+	for _, nodeId := range nodeIds {
+		claimed, err := sm.redis.ClaimDrain(ctx, nodeId, time.Now().Add(DrainLeaseTTL))
+		if err != nil || !claimed {
+			continue
+		}
+		progress, err := sm.redis.GetDrainProgress(ctx, nodeId)
+		if err != nil {
+			continue
+		}
+
+		log.Printf("[Drain] Node %s (%s): resuming orphaned drain (%d/%d migrated)",
+			nodeId, progress.NodeType, progress.Migrated, progress.Total)
+		go sm.runDrain(context.Background(), nodeId, progress.NodeType)
+	}
+}
+
+// runDrain esegue il drain fino a nodo vuoto o deadline
+// I contatori vengono sommati in Redis: force e deadline restano quelli scritti da ForceDrain
+func (sm *SessionManager) runDrain(ctx context.Context, nodeId, nodeType string) {
+	// Egress: sessione -> istante in cui i viewer sono stati avvisati
+	signalled := make(map[string]time.Time)
+
+	ticker := time.NewTicker(DrainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		progress, err := sm.redis.GetDrainProgress(ctx, nodeId)
+		if err != nil || progress.Status != DrainRunning {
+			return
+		}
+
+		sessions := sm.drainSessions(ctx, nodeType, nodeId)
+		update := redis.DrainUpdate{Remaining: len(sessions)}
+
+		if len(sessions) == 0 {
+			sm.finishDrain(ctx, progress, update, DrainCompleted, "node is empty")
+			return
+		}
+
+		if time.Now().UnixMilli() >= progress.Deadline {
+			if !progress.Force {
+				sm.finishDrain(ctx, progress, update, DrainTimedOut,
+					fmt.Sprintf("deadline reached with %d sessions left", len(sessions)))
+				return
+			}
+			for _, sessionId := range sessions {
+				if err := sm.forceDrainSession(ctx, nodeType, nodeId, sessionId); err != nil {
+					log.Printf("[WARN] Drain %s: failed to force session %s: %v", nodeId, sessionId, err)
+					continue
+				}
+				update.Forced++
+			}
+			update.Remaining = len(sm.drainSessions(ctx, nodeType, nodeId))
+			sm.finishDrain(ctx, progress, update, DrainForced,
+				fmt.Sprintf("%d sessions closed at deadline", update.Forced))
+			return
+		}
+
+		for _, sessionId := range sessions {
+			migrated, err := sm.migrateSession(ctx, nodeType, nodeId, sessionId, signalled)
+			if err != nil {
+				log.Printf("[WARN] Drain %s: session %s not migrated: %v", nodeId, sessionId, err)
+				update.Failed++
+				update.Message = err.Error()
+				continue
+			}
+			if migrated {
+				update.Migrated++
+				update.Remaining--
+			}
+		}
+
+		// Rinnova anche la lease; false = drain chiuso altrove
+		running, err := sm.redis.UpdateDrainProgress(ctx, nodeId, update, time.Now().Add(DrainLeaseTTL))
+		if err != nil {
+			log.Printf("[WARN] %v", err)
+		} else if !running {
+			return
+		}
+
+		<-ticker.C
+	}
+}
+
+func (sm *SessionManager) finishDrain(ctx context.Context, progress *redis.DrainProgress, update redis.DrainUpdate, status, message string) {
+	update.Message = message
+	finished, err := sm.redis.FinishDrainProgress(ctx, progress.NodeId, status, update, DrainProgressTTL)
+	if err != nil {
+		log.Printf("[WARN] Failed to save drain result for %s: %v", progress.NodeId, err)
+		return
+	}
+	if !finished {
+		return // Chiuso da un altro controller
+	}
+	log.Printf("[Drain] Node %s: %s (%s)", progress.NodeId, status, message)
+
+	// Destroy riletto: può essere stato chiesto mentre il drain era in corso
+	if latest, err := sm.redis.GetDrainProgress(ctx, progress.NodeId); err == nil {
+		progress = latest
+	}
+	if progress.Destroy && status != DrainTimedOut && sm.destroyer != nil {
+		if err := sm.destroyer.DestroyNode(ctx, progress.NodeId, progress.NodeType); err != nil {
+			log.Printf("[WARN] Failed to destroy drained node %s: %v", progress.NodeId, err)
+		}
+	}
+}
+
+// drainSessions elenca le sessioni che dipendono ancora dal nodo (errore = nessuna sessione)
+func (sm *SessionManager) drainSessions(ctx context.Context, nodeType, nodeId string) []string {
+	sessions, _ := sm.nodeSessions(ctx, nodeType, nodeId)
+	return sessions
+}
+
+// nodeSessions come drainSessions, ma una lettura fallita non diventa "nessuna sessione"
+func (sm *SessionManager) nodeSessions(ctx context.Context, nodeType, nodeId string) ([]string, error) {
+	if nodeType != "egress" {
+		return sm.redis.GetNodeSessions(ctx, nodeId)
+	}
+	return sm.redis.GetEgressSessions(ctx, nodeId)
+}
+
+// migrateSession sposta una sessione dal nodo. Ritorna true quando il nodo non la serve più
+func (sm *SessionManager) migrateSession(
+	ctx context.Context,
+	nodeType, nodeId, sessionId string,
+	signalled map[string]time.Time,
+) (bool, error) {
+	switch nodeType {
+	case "relay":
+		return true, sm.migrateRelaySession(ctx, sessionId, nodeId)
+
+	case "egress":
+		at, ok := signalled[sessionId]
+		if !ok {
+			if err := sm.prepareEgressMigration(ctx, sessionId, nodeId); err != nil {
+				return false, err
+			}
+			signalled[sessionId] = time.Now()
+			return false, nil
+		}
+		if time.Since(at) < DrainMigrationGrace {
+			return false, nil
+		}
+		delete(signalled, sessionId)
+		return true, sm.DestroySessionPath(ctx, sessionId, nodeId)
+
+	case "injection":
+		// Il broadcaster non può essere spostato: avvisiamo una volta e attendiamo
+		if _, ok := signalled[sessionId]; !ok {
+			sm.redis.PublishSessionMigrating(ctx, nodeId, sessionId, "")
+			signalled[sessionId] = time.Now()
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown node type %s", nodeType)
+}
+
+// migrateRelaySession sostituisce il relay nella catena della sessione (make-before-break):
+// il nuovo relay riceve sessione e rotte, poi il genitore passa dal vecchio al nuovo
+func (sm *SessionManager) migrateRelaySession(ctx context.Context, sessionId, relayId string) error {
+	chain, err := sm.redis.GetSessionChain(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+	idx := slices.Index(chain, relayId)
+	if idx < 1 {
+		// Non più in catena: resta solo l'indice del nodo da pulire
+		sm.redis.RemoveSessionFromNode(ctx, relayId, sessionId)
+		return nil
+	}
+	parentId := chain[idx-1]
+
+	targets, _ := sm.redis.GetRoutes(ctx, sessionId, relayId)
+	if len(targets) == 0 {
+		// Ramo morto senza figli: lo potiamo
+		sm.redis.PublishRouteRemoved(ctx, parentId, sessionId, relayId)
+		sm.redis.RemoveRoute(ctx, sessionId, parentId, relayId)
+		sm.redis.PublishNodeSessionDestroyed(ctx, relayId, sessionId)
+		sm.redis.ReleaseDeepReserve(ctx, sessionId, relayId)
+		return sm.redis.RemoveFromSessionChain(ctx, sessionId, relayId)
+	}
+
+	edges, _ := sm.redis.GetEdgeCount(ctx, sessionId, relayId)
+	newRelayId, err := sm.redis.FindRelayForMigration(ctx, chain, edges+1)
+	if err != nil {
+		sm.selector.reportShortage("relay", sessionId, fmt.Sprintf("no relay to migrate %s", relayId))
+		return fmt.Errorf("%v: %w", err, &CapacityError{Tier: "relay"})
+	}
+
+	if err := sm.redis.ReplaceRelayInChain(ctx, sessionId, relayId, newRelayId); err != nil {
+		return err
+	}
+
+	routes := make([]redis.Route, 0, len(targets))
+	for _, targetId := range targets {
+		info, err := sm.redis.GetNodeProvisioning(ctx, targetId)
+		if err != nil {
+			continue
+		}
+		routes = append(routes, redis.Route{
+			TargetId: targetId, Host: info.InternalHost,
+			AudioPort: info.InternalRTPAudio, VideoPort: info.InternalRTPVideo,
+		})
+	}
+
+	sessionData, _ := sm.redis.GetSession(ctx, sessionId)
+	audioSsrc := parseInt(sessionData["audioSsrc"])
+	videoSsrc := parseInt(sessionData["videoSsrc"])
+
+	// Make: il nuovo relay inoltra già verso i figli
+	sm.redis.PublishNodeSessionCreated(ctx, newRelayId, sessionId, audioSsrc, videoSsrc, routes)
+	if err := sm.redis.RepointSessionRelay(ctx, sessionId, parentId, relayId, newRelayId); err != nil {
+		return err
+	}
+	sm.redis.PublishRouteAdded(ctx, parentId, sessionId, newRelayId)
+
+	// Break: il genitore smette di inviare al vecchio relay
+	sm.redis.PublishRouteRemoved(ctx, parentId, sessionId, relayId)
+	sm.redis.PublishNodeSessionDestroyed(ctx, relayId, sessionId)
+
+	log.Printf("[Drain] Session %s: relay %s replaced by %s (%d edges)", sessionId, relayId, newRelayId, edges)
+	return nil
+}
+
+// prepareEgressMigration apre un path su un altro egress e avvisa i viewer
+// Il nodo in draining non è selezionabile, quindi ProvisionViewer ne sceglie un altro
+func (sm *SessionManager) prepareEgressMigration(ctx context.Context, sessionId, egressId string) error {
+	viewer, err := sm.ProvisionViewer(ctx, sessionId)
+	if err != nil {
+		return fmt.Errorf("no alternative egress: %w", err)
+	}
+
+	if err := sm.redis.PublishSessionMigrating(ctx, egressId, sessionId, viewer.EgressNodeId); err != nil {
+		return err
+	}
+
+	log.Printf("[Drain] Session %s: viewers on %s redirected to %s", sessionId, egressId, viewer.EgressNodeId)
+	return nil
+}
+
+// forceDrainSession chiude quello che resta della sessione sul nodo alla deadline
+func (sm *SessionManager) forceDrainSession(ctx context.Context, nodeType, nodeId, sessionId string) error {
+	switch nodeType {
+	case "injection":
+		return sm.DestroySessionComplete(ctx, sessionId)
+
+	case "egress":
+		return sm.DestroySessionPath(ctx, sessionId, nodeId)
+
+	case "relay":
+		// Chiudiamo i path che passano dal relay: il backtracking pota i relay rimasti senza figli
+		egresses, _ := sm.redis.GetSessionEgresses(ctx, sessionId)
+		for _, egressId := range egresses {
+			path, err := sm.redis.GetSessionPath(ctx, sessionId, egressId)
+			if err != nil || !slices.Contains(path, nodeId) {
+				continue
+			}
+			if err := sm.DestroySessionPath(ctx, sessionId, egressId); err != nil {
+				return err
+			}
+		}
+		// Relay rimasto in catena senza path (ramo morto)
+		return sm.migrateRelaySession(ctx, sessionId, nodeId)
+	}
+	return fmt.Errorf("unknown node type %s", nodeType)
+}
@@ -0,0 +1,117 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"controller/internal/redis"
+)
+
+const (
+	NodeFailureGroup     = "controller"
+	NodeFailureBlock     = 5 * time.Second
+	NodeFailureClaimIdle = 1 * time.Minute // Eventi di un consumer morto a metà gestione
+)
+
+// StartFailureRecovery consuma nodes:failures: ripara le sessioni dei nodi guasti,
+// distrugge i nodi falliti e chiede subito capacità sostitutiva all'autoscaler
+// Un evento viene confermato solo dopo la gestione: se il controller muore viene ripreso
+func (sm *SessionManager) StartFailureRecovery(ctx context.Context) error {
+	if err := sm.redis.EnsureNodeFailureGroup(ctx, NodeFailureGroup); err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	consumer := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	log.Printf("[Recovery] Consuming %s as %s", redis.NodeFailuresStream, consumer)
+
+	go func() {
+		lastClaim := time.Time{}
+		for ctx.Err() == nil {
+			var messages []redis.NodeFailureMessage
+			var err error
+			if time.Since(lastClaim) >= NodeFailureClaimIdle {
+				messages, err = sm.redis.ClaimNodeFailures(ctx, NodeFailureGroup, consumer, NodeFailureClaimIdle)
+				lastClaim = time.Now()
+			}
+			if err == nil && len(messages) == 0 {
+				messages, err = sm.redis.ReadNodeFailures(ctx, NodeFailureGroup, consumer, NodeFailureBlock)
+			}
+			if err != nil {
+				log.Printf("[WARN] %v", err)
+				select {
+				case <-time.After(NodeFailureBlock):
+				case <-ctx.Done():
+				}
+				continue
+			}
+
+			for _, message := range messages {
+				sm.handleNodeFailure(ctx, message.Event)
+				if err := sm.redis.AckNodeFailure(ctx, NodeFailureGroup, message.Id); err != nil {
+					log.Printf("[WARN] Failed to ack node failure %s: %v", message.Id, err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// handleNodeFailure ripara le sessioni del nodo; un nodo fallito viene poi distrutto
+// Un nodo riavviato resta in servizio ma ha perso le sessioni in memoria
+// Idempotente: lo stesso evento può arrivare più volte
+func (sm *SessionManager) handleNodeFailure(ctx context.Context, event redis.NodeFailureEvent) {
+	nodeInfo, err := sm.redis.GetNodeProvisioning(ctx, event.NodeId)
+	if err != nil || nodeInfo == nil {
+		return // Già rimosso
+	}
+	nodeType := string(nodeInfo.NodeType)
+
+	log.Printf("[Recovery] Node %s (%s) %s: %s (%s)", event.NodeId, nodeType, event.Type, event.Cause, event.Reason)
+	sm.repairNodeSessions(ctx, nodeType, nodeInfo.Role, event.NodeId)
+
+	if event.Type != redis.NodeEventFailed {
+		return
+	}
+
+	// Il Relay Root segue il suo injection; le macchine esterne restano failed
+	// finché non tornano sane o vengono deregistrate
+	if nodeInfo.Role == "root" || nodeInfo.IsExternal() || sm.destroyer == nil {
+		return
+	}
+	status, _ := sm.redis.GetNodeStatus(ctx, event.NodeId)
+	if status != redis.NodeStatusFailed {
+		return // Tornato in servizio (Pod ricreato) o già in distruzione
+	}
+	if err := sm.destroyer.DestroyNode(ctx, event.NodeId, nodeType); err != nil {
+		log.Printf("[WARN] Failed to destroy failed node %s: %v", event.NodeId, err)
+	}
+	sm.selector.reportShortage(nodeType, "", fmt.Sprintf("node %s failed: %s", event.NodeId, event.Cause))
+}
+
+// repairNodeSessions libera le sessioni dal nodo guasto:
+// injection e Relay Root -> la sessione è persa e viene chiusa
+// relay -> la posizione in catena passa a un altro relay, altrimenti i path vengono chiusi
+// egress -> i path vengono chiusi, i viewer si ricollegano su un altro egress
+func (sm *SessionManager) repairNodeSessions(ctx context.Context, nodeType, role, nodeId string) {
+	for _, sessionId := range sm.drainSessions(ctx, nodeType, nodeId) {
+		var err error
+		switch {
+		case nodeType == "injection" || role == "root":
+			err = sm.DestroySessionComplete(ctx, sessionId)
+		case nodeType == "relay":
+			if err = sm.migrateRelaySession(ctx, sessionId, nodeId); err != nil {
+				log.Printf("[WARN] Session %s: relay %s not replaced (%v), closing its paths", sessionId, nodeId, err)
+				err = sm.forceDrainSession(ctx, nodeType, nodeId, sessionId)
+			}
+		case nodeType == "egress":
+			err = sm.DestroySessionPath(ctx, sessionId, nodeId)
+		}
+		if err != nil {
+			log.Printf("[WARN] Failed to repair session %s on %s: %v", sessionId, nodeId, err)
+		}
+	}
+}
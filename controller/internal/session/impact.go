@@ -0,0 +1,112 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"controller/internal/redis"
+)
+
+// GetNodeImpact calcola sessioni, posizioni in catena, egress e viewer che dipendono dal nodo
+// ErrNodeNotFound solo se il nodo non esiste: un errore di Redis non è "nessun impatto"
+func (sm *SessionManager) GetNodeImpact(ctx context.Context, nodeId string) (*NodeImpact, error) {
+	nodeInfo, err := sm.redis.GetNodeProvisioning(ctx, nodeId)
+	if errors.Is(err, redis.ErrProvisioningNotFound) {
+		return nil, ErrNodeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node %s: %w", nodeId, err)
+	}
+
+	status, _ := sm.redis.GetNodeStatus(ctx, nodeId)
+	nodeType := string(nodeInfo.NodeType)
+
+	impact := &NodeImpact{
+		NodeId:   nodeId,
+		NodeType: nodeType,
+		Role:     nodeInfo.Role,
+		Status:   status,
+		Sessions: []SessionImpact{},
+	}
+
+	// L'injection viene distrutto insieme al suo Relay Root
+	if nodeType == "injection" {
+		impact.DependentNodes, _ = sm.redis.GetNodeChildren(ctx, nodeId)
+	}
+
+	sessions, err := sm.nodeSessions(ctx, nodeType, nodeId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions of %s: %w", nodeId, err)
+	}
+
+	egressSeen := make(map[string]bool)
+	for _, sessionId := range sessions {
+		session := sm.sessionImpact(ctx, nodeType, nodeInfo.Role, nodeId, sessionId)
+
+		impact.Sessions = append(impact.Sessions, session)
+		impact.TotalViewers += session.Viewers
+		for _, egress := range session.Egresses {
+			egressSeen[egress.EgressId] = true
+		}
+	}
+
+	impact.TotalSessions = len(impact.Sessions)
+	impact.TotalEgresses = len(egressSeen)
+	impact.LiveImpact = impact.TotalSessions > 0
+	return impact, nil
+}
+
+// sessionImpact calcola l'impatto del nodo su una singola sessione
+func (sm *SessionManager) sessionImpact(ctx context.Context, nodeType, role, nodeId, sessionId string) SessionImpact {
+	chain, _ := sm.redis.GetSessionChain(ctx, sessionId)
+	sessionData, _ := sm.redis.GetSession(ctx, sessionId)
+	roomId := parseInt(sessionData["roomId"])
+
+	impact := SessionImpact{
+		SessionId:   sessionId,
+		ChainIndex:  slices.Index(chain, nodeId),
+		ChainLength: len(chain),
+		Egresses:    []EgressImpact{},
+	}
+
+	switch {
+	case nodeType == "injection":
+		impact.Position = "injection"
+	case nodeType == "egress":
+		impact.Position = "egress"
+	case role == "root":
+		impact.Position = "relay-root"
+	default:
+		impact.Position = "chain"
+	}
+
+	egresses, _ := sm.redis.GetSessionEgresses(ctx, sessionId)
+	for _, egressId := range egresses {
+		// Injection e Relay Root servono tutta la sessione, un relay solo i path che lo attraversano
+		switch impact.Position {
+		case "egress":
+			if egressId != nodeId {
+				continue
+			}
+		case "chain":
+			path, err := sm.redis.GetSessionPath(ctx, sessionId, egressId)
+			if err != nil || !slices.Contains(path, nodeId) {
+				continue
+			}
+		}
+
+		parentId, _ := sm.redis.GetEgressParent(ctx, sessionId, egressId)
+		viewers, _ := sm.redis.GetMountpointViewers(ctx, egressId, roomId)
+
+		impact.Egresses = append(impact.Egresses, EgressImpact{
+			EgressId:      egressId,
+			ParentRelayId: parentId,
+			Viewers:       viewers,
+		})
+		impact.Viewers += viewers
+	}
+
+	return impact
+}
@@ -17,6 +17,7 @@ type SessionManager struct {
 	redis      *redis.Client
 	selector   *NodeSelector
 	httpClient *http.Client
+	destroyer  NodeDestroyer
 }
 
 func NewSessionManager(redisClient *redis.Client) *SessionManager {
@@ -29,6 +30,11 @@ func NewSessionManager(redisClient *redis.Client) *SessionManager {
 	}
 }
 
+// SetShortageNotifier inoltra i segnali di carenza del selector all'autoscaler
+func (sm *SessionManager) SetShortageNotifier(notifier ShortageNotifier) {
+	sm.selector.SetShortageNotifier(notifier)
+}
+
 // CreateSession crea sessione dormiente (SOLO injection)
 // Chiamato quando broadcaster vuole iniziare streaming
 // -> Seleziona injection (round-robin per il momento)
@@ -50,8 +56,14 @@ func (sm *SessionManager) CreateSession(
 		return nil, fmt.Errorf("session error or already exists")
 	}
 
+	// Una sola fotografia per richiesta
+	snapshot, err := sm.redis.GetClusterSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Seleziona Injection
-	injectionId, err := sm.selector.SelectInjection(ctx, sessionId)
+	injectionId, err := sm.selector.SelectInjection(ctx, snapshot, sessionId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to select injection: %w", err)
 	}
@@ -153,6 +165,12 @@ func (sm *SessionManager) ProvisionViewer(
 ) (*ViewSessionResponse, error) {
 	log.Printf("[SessionManager] Provisioning viewer for session %s", sessionId)
 
+	// Una sola fotografia per richiesta: riuso, selezione egress e relay la condividono
+	snapshot, err := sm.redis.GetClusterSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Riuso egress node
 	existingEgress, err := sm.redis.FindEgressServingSession(ctx, sessionId)
 	if err == nil && len(existingEgress) > 0 {
@@ -160,10 +178,10 @@ func (sm *SessionManager) ProvisionViewer(
 
 		// Riusa egress se disponibile
 		for _, egressId := range existingEgress {
-			if sm.selector.CanAcceptViewer(ctx, egressId) {
+			if sm.selector.CanAcceptViewer(snapshot, egressId) {
 				log.Printf("[SessionManager] Reusing egress %s (multicast)", egressId)
 
-				egressNode, _ := sm.redis.GetNodeProvisioning(ctx, egressId)
+				egressNode := snapshot.Node(egressId).Info
 				path, _ := sm.redis.GetSessionPath(ctx, sessionId, egressId)
 
 				return &ViewSessionResponse{
@@ -184,7 +202,7 @@ func (sm *SessionManager) ProvisionViewer(
 	}
 
 	// Seleziona nuovo egress
-	egressId, err := sm.selector.SelectBestEgressForSession(ctx, sessionId)
+	egressId, err := sm.selector.SelectBestEgressForSession(ctx, snapshot, sessionId)
 	if err != nil {
 		return nil, fmt.Errorf("no egress available - scaling needed: %w", err)
 	}
@@ -192,7 +210,7 @@ func (sm *SessionManager) ProvisionViewer(
 	log.Printf("[SessionManager] Selected new egress: %s", egressId)
 
 	// Selezione Relay a cui collegare egress (Hole-filling o Deepening)
-	relayId, isNewRelayAdded, err := sm.selector.SelectRelayForViewer(ctx, sessionId)
+	relayId, isNewRelayAdded, err := sm.selector.SelectRelayForViewer(ctx, snapshot, sessionId)
 	if err != nil {
 		return nil, err
 	}
@@ -325,6 +343,9 @@ func (sm *SessionManager) DestroySessionComplete(
 	sm.redis.PublishNodeSessionDestroyed(ctx, relayRootId, sessionId)
 	sm.redis.RemoveSessionFromNode(ctx, relayRootId, sessionId)
 
+	// I viewer in attesa non potranno più essere ammessi
+	sm.redis.DeleteSessionAdmissionQueue(ctx, sessionId)
+
 	// Cleanup metadata principale
 	sm.redis.DeleteSession(ctx, sessionId)
 	sm.redis.RemoveSessionFromGlobalIndex(ctx, sessionId)
@@ -5,8 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"strconv"
 	"sync"
+	"time"
 
 	"controller/internal/autoscaler"
 	"controller/internal/redis"
@@ -16,12 +16,32 @@ import (
 var ErrNoInjectionAvailable = errors.New("no injection nodes available")
 var ErrScalingNeeded = errors.New("all injection nodes saturated, scaling needed")
 
+// CapacityError indica su quale tier manca capacità
+// errors.Is(err, ErrScalingNeeded) resta valido
+type CapacityError struct {
+	Tier string
+}
+
+func (e *CapacityError) Error() string {
+	return fmt.Sprintf("all %s nodes saturated, scaling needed", e.Tier)
+}
+
+func (e *CapacityError) Is(target error) bool {
+	return target == ErrScalingNeeded
+}
+
+// ShortageNotifier riceve i segnali di carenza di capacità (implementato da AutoscalerJob)
+type ShortageNotifier interface {
+	NotifyShortage(shortage autoscaler.CapacityShortage)
+}
+
 // NodeSelector gestisce la selezione automatica di nodi con round-robin
 type NodeSelector struct {
 	redis             *redis.Client
 	loadCalcInjection *autoscaler.InjectionLoadCalculator
 	loadCalcRelay     *autoscaler.RelayLoadCalculator
 	loadCalcEgress    *autoscaler.EgressLoadCalculator
+	shortageNotifier  ShortageNotifier
 
 	mu sync.Mutex
 }
@@ -30,13 +50,32 @@ type NodeSelector struct {
 func NewNodeSelector(redisClient *redis.Client) *NodeSelector {
 	return &NodeSelector{
 		redis:             redisClient,
-		loadCalcInjection: autoscaler.NewInjectionLoadCalculator(redisClient),
-		loadCalcRelay:     autoscaler.NewRelayLoadCalculator(redisClient),
-		loadCalcEgress:    autoscaler.NewEgressLoadCalculator(redisClient),
+		loadCalcInjection: autoscaler.NewInjectionLoadCalculator(),
+		loadCalcRelay:     autoscaler.NewRelayLoadCalculator(),
+		loadCalcEgress:    autoscaler.NewEgressLoadCalculator(),
+	}
+}
+
+// SetShortageNotifier collega il selector all'autoscaler
+func (ns *NodeSelector) SetShortageNotifier(notifier ShortageNotifier) {
+	ns.shortageNotifier = notifier
+}
+
+// reportShortage notifica la carenza di capacità su un tier
+func (ns *NodeSelector) reportShortage(tier, sessionId, reason string) {
+	if ns.shortageNotifier == nil {
+		return
 	}
+	ns.shortageNotifier.NotifyShortage(autoscaler.CapacityShortage{
+		Tier:      tier,
+		SessionId: sessionId,
+		Reason:    reason,
+		At:        time.Now(),
+	})
 }
 
-func (ns *NodeSelector) SelectInjection(ctx context.Context, sessionId string) (string, error) {
+// SelectInjection assegna la sessione a un injection con capacità, verificato sulla fotografia della richiesta
+func (ns *NodeSelector) SelectInjection(ctx context.Context, snapshot *redis.ClusterSnapshot, sessionId string) (string, error) {
 
 	// Chiediamo un injection con capacità residua
 	nodeId, err := ns.redis.AcquireInjectionSlot(ctx, sessionId)
@@ -46,19 +85,22 @@ func (ns *NodeSelector) SelectInjection(ctx context.Context, sessionId string) (
 
 	if nodeId == "FULL" {
 		log.Printf("[NodeSelector] All injection nodes are at maximum capacity")
-		return "", ErrScalingNeeded
+		ns.reportShortage("injection", sessionId, "all injection slots taken")
+		return "", &CapacityError{Tier: "injection"}
 	}
 
-	status, _ := ns.redis.GetNodeStatus(ctx, nodeId)
-	if status != "active" {
+	node := snapshot.Node(nodeId)
+	if node == nil || !node.IsActive() {
 		ns.redis.ReleaseInjectionSlot(ctx, nodeId, sessionId)
-		return "", ErrScalingNeeded
+		ns.reportShortage("injection", sessionId, fmt.Sprintf("selected injection %s is not active", nodeId))
+		return "", &CapacityError{Tier: "injection"}
 	}
 
 	// Se il nodo scelto è saturo lo scartiamo
-	if !ns.loadCalcInjection.IsNodeHealthy(ctx, nodeId) {
+	if !ns.loadCalcInjection.IsNodeHealthy(snapshot, nodeId) {
 		ns.redis.ReleaseInjectionSlot(ctx, nodeId, sessionId)
-		return "", ErrScalingNeeded
+		ns.reportShortage("injection", sessionId, fmt.Sprintf("injection %s hardware saturated", nodeId))
+		return "", &CapacityError{Tier: "injection"}
 	}
 
 	log.Printf("[NodeSelector] Session %s assigned to injection %s", sessionId, nodeId)
@@ -66,54 +108,57 @@ func (ns *NodeSelector) SelectInjection(ctx context.Context, sessionId string) (
 }
 
 // SelectBestEgressForSession seleziona egress per viewer Fill-First
-func (ns *NodeSelector) SelectBestEgressForSession(ctx context.Context, sessionId string) (string, error) {
+func (ns *NodeSelector) SelectBestEgressForSession(ctx context.Context, snapshot *redis.ClusterSnapshot, sessionId string) (string, error) {
 	ns.mu.Lock()
 	defer ns.mu.Unlock()
 
 	// Cerca tra gli Egress che hanno già la sessione
 	existing, _ := ns.redis.FindEgressServingSession(ctx, sessionId)
-	bestExisting := ns.findMostLoadedAvailable(ctx, existing)
+	bestExisting := ns.findMostLoadedAvailable(snapshot, existing)
 	if bestExisting != "" {
 		log.Printf("[NodeSelector] Reusing egress %s (Fill-First)", bestExisting)
 		return bestExisting, nil
 	}
 
 	// Se nessuno esistente ha spazio, cerca in tutto il pool
-	pool, err := ns.redis.GetNodePool(ctx, "egress")
-	if err != nil || len(pool) == 0 {
-		return "", ErrScalingNeeded
+	var pool []string
+	for _, node := range snapshot.Pool("egress") {
+		pool = append(pool, node.Info.NodeId)
+	}
+	if len(pool) == 0 {
+		ns.reportShortage("egress", sessionId, "egress pool empty")
+		return "", &CapacityError{Tier: "egress"}
 	}
 
-	bestNew := ns.findMostLoadedAvailable(ctx, pool)
+	bestNew := ns.findMostLoadedAvailable(snapshot, pool)
 	if bestNew != "" {
 		log.Printf("[NodeSelector] Selected new egress %s from pool (Fill-First)", bestNew)
 		return bestNew, nil
 	}
 
-	return "", ErrScalingNeeded
+	ns.reportShortage("egress", sessionId, "all egress nodes saturated")
+	return "", &CapacityError{Tier: "egress"}
 }
 
 // findMostLoadedAvailable seleziona il nodo più carico (ma non saturo)
-func (ns *NodeSelector) findMostLoadedAvailable(ctx context.Context, nodeIds []string) string {
+func (ns *NodeSelector) findMostLoadedAvailable(snapshot *redis.ClusterSnapshot, nodeIds []string) string {
 	bestCandidate := ""
 	maxViewers := -1
 
 	for _, id := range nodeIds {
 
-		status, _ := ns.redis.GetNodeStatus(ctx, id)
-		if status != "active" {
+		node := snapshot.Node(id)
+		if node == nil || !node.IsActive() {
 			continue
 		}
 
 		// Se il nodo è saturo lo saltiamo
-		if ns.loadCalcEgress.IsNodeSaturated(ctx, id) {
+		if ns.loadCalcEgress.IsNodeSaturated(node) {
 			continue
 		}
 
-		// Leggiamo il numero attuale di viewer
-		key := fmt.Sprintf("metrics:node:%s:janusStreaming", id)
-		val, _ := ns.redis.HGet(ctx, key, "janusTotalViewers")
-		viewers, _ := strconv.Atoi(val)
+		// Numero attuale di viewer
+		viewers := autoscaler.EgressViewers(node)
 
 		// Se questo nodo è più carico di quello trovato finora, diventa il nuovo candidato
 		if viewers > maxViewers {
@@ -125,26 +170,33 @@ func (ns *NodeSelector) findMostLoadedAvailable(ctx context.Context, nodeIds []s
 }
 
 // CanAcceptViewer usato per decidere se riusare un Egress esistente
-func (ns *NodeSelector) CanAcceptViewer(ctx context.Context, nodeId string) bool {
-	status, _ := ns.redis.GetNodeStatus(ctx, nodeId)
-	if status != "active" {
+func (ns *NodeSelector) CanAcceptViewer(snapshot *redis.ClusterSnapshot, nodeId string) bool {
+	node := snapshot.Node(nodeId)
+	if node == nil || !node.IsActive() {
 		return false
 	}
-	return !ns.loadCalcEgress.IsNodeSaturated(ctx, nodeId)
+	return !ns.loadCalcEgress.IsNodeSaturated(node)
+}
+
+// relayAvailable controlla stato e carico hardware di un relay sulla fotografia
+func (ns *NodeSelector) relayAvailable(snapshot *redis.ClusterSnapshot, relayId string) (bool, float64) {
+	node := snapshot.Node(relayId)
+	if node == nil {
+		return false, 0
+	}
+	hwLoad := ns.loadCalcRelay.CalculateRelayLoad(node)
+	return node.IsActive() && hwLoad < 100.0, hwLoad
 }
 
 // SelectRelayForViewer implementa Hole-Filling e Deepening per la mesh
-func (ns *NodeSelector) SelectRelayForViewer(ctx context.Context, sessionId string) (string, bool, error) {
+func (ns *NodeSelector) SelectRelayForViewer(ctx context.Context, snapshot *redis.ClusterSnapshot, sessionId string) (string, bool, error) {
 
 	// Hole fitting
 	// Lo script scorre la catena
 	relayId, err := ns.redis.AcquireEdgeSlot(ctx, sessionId)
 	if err == nil && relayId != "FULL" {
 
-		status, _ := ns.redis.GetNodeStatus(ctx, relayId)
-		hwLoad, _ := ns.loadCalcRelay.CalculateRelayLoad(ctx, relayId)
-
-		if status == "active" && hwLoad < 100.0 {
+		if ok, _ := ns.relayAvailable(snapshot, relayId); ok {
 			log.Printf("[NodeSelector] Hole-Filling: Slot acquired on %s", relayId)
 			return relayId, false, nil
 		}
@@ -163,13 +215,16 @@ func (ns *NodeSelector) SelectRelayForViewer(ctx context.Context, sessionId stri
 	// Esclude i nodi già presenti nella catena per evitare cicli
 	newRelayId, err := ns.redis.FindBestRelayForDeepening(ctx, currentChain)
 	if err != nil {
-		return "", false, fmt.Errorf("deepening failed: %w", err)
+		ns.reportShortage("relay", sessionId, "no standalone relay available for deepening")
+		return "", false, fmt.Errorf("deepening failed: %v: %w", err, &CapacityError{Tier: "relay"})
 	}
-	status, _ := ns.redis.GetNodeStatus(ctx, newRelayId)
-	hwLoad, _ := ns.loadCalcRelay.CalculateRelayLoad(ctx, newRelayId)
-
-	if status != "active" || hwLoad >= 100.0 {
-		return "", false, ErrScalingNeeded
+	if ok, hwLoad := ns.relayAvailable(snapshot, newRelayId); !ok {
+		status := ""
+		if node := snapshot.Node(newRelayId); node != nil {
+			status = node.Status
+		}
+		ns.reportShortage("relay", sessionId, fmt.Sprintf("relay %s unavailable (status: %s, hw: %.1f)", newRelayId, status, hwLoad))
+		return "", false, &CapacityError{Tier: "relay"}
 	}
 
 	// Aggiunge il nuovo relay alla catena su Redis (+2 slot: 1 Deep Reserve + 1 Edge)
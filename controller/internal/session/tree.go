@@ -0,0 +1,202 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// GetSessionTree ricostruisce l'albero di distribuzione reale della sessione:
+// injection -> relay root -> relay (da routing:*) -> egress
+func (sm *SessionManager) GetSessionTree(ctx context.Context, sessionId string) (*SessionTree, error) {
+	sessionData, err := sm.redis.GetSession(ctx, sessionId)
+	if err != nil || len(sessionData) == 0 {
+		return nil, ErrSessionNotFound
+	}
+
+	roomId := parseInt(sessionData["roomId"])
+	chain, _ := sm.redis.GetSessionChain(ctx, sessionId)
+	egresses, _ := sm.redis.GetSessionEgresses(ctx, sessionId)
+
+	tree := &SessionTree{
+		SessionId: sessionId,
+		RoomId:    roomId,
+		Chain:     chain,
+		Edges:     []TreeEdge{},
+		Detached:  []string{},
+	}
+
+	// Egress path che attraversano ogni arco
+	pathsPerEdge := make(map[[2]string]int)
+	for _, egressId := range egresses {
+		path, err := sm.redis.GetSessionPath(ctx, sessionId, egressId)
+		if err != nil {
+			continue
+		}
+		for i := 0; i+1 < len(path); i++ {
+			pathsPerEdge[[2]string{path[i], path[i+1]}]++
+		}
+	}
+
+	injectionId := sessionData["injectionNodeId"]
+	tree.Root = sm.treeNode(ctx, sessionId, injectionId, "injection", chain, roomId)
+
+	visited := map[string]bool{injectionId: true}
+	if len(chain) > 0 {
+		root := sm.treeNode(ctx, sessionId, chain[0], "relay-root", chain, roomId)
+		tree.Root.Children = append(tree.Root.Children, root)
+		tree.addEdge(injectionId, chain[0], pathsPerEdge)
+		visited[chain[0]] = true
+		sm.expandTree(ctx, tree, root, chain, egresses, roomId, pathsPerEdge, visited)
+	}
+
+	// Egress registrati sulla sessione ma non raggiunti dalle rotte
+	for _, egressId := range egresses {
+		if !visited[egressId] {
+			tree.Detached = append(tree.Detached, egressId)
+		}
+	}
+
+	tree.TotalEgresses = len(egresses)
+	tree.walk(func(n *TreeNode) {
+		tree.TotalViewers += n.Viewers
+	})
+	return tree, nil
+}
+
+// expandTree aggiunge ricorsivamente i figli di un relay seguendo routing:{session}:{relay}
+func (sm *SessionManager) expandTree(
+	ctx context.Context,
+	tree *SessionTree,
+	parent *TreeNode,
+	chain, egresses []string,
+	roomId int,
+	pathsPerEdge map[[2]string]int,
+	visited map[string]bool,
+) {
+	targets, _ := sm.redis.GetRoutes(ctx, tree.SessionId, parent.NodeId)
+	slices.Sort(targets)
+
+	for _, targetId := range targets {
+		if visited[targetId] {
+			continue
+		}
+		visited[targetId] = true
+
+		position := "relay"
+		if slices.Contains(egresses, targetId) {
+			position = "egress"
+		}
+
+		child := sm.treeNode(ctx, tree.SessionId, targetId, position, chain, roomId)
+		parent.Children = append(parent.Children, child)
+		tree.addEdge(parent.NodeId, targetId, pathsPerEdge)
+
+		if position == "relay" {
+			sm.expandTree(ctx, tree, child, chain, egresses, roomId, pathsPerEdge, visited)
+		}
+	}
+}
+
+func (sm *SessionManager) treeNode(ctx context.Context, sessionId, nodeId, position string, chain []string, roomId int) *TreeNode {
+	status, _ := sm.redis.GetNodeStatus(ctx, nodeId)
+	node := &TreeNode{
+		NodeId:     nodeId,
+		Position:   position,
+		Status:     status,
+		ChainIndex: slices.Index(chain, nodeId),
+		Children:   []*TreeNode{},
+	}
+
+	switch position {
+	case "relay-root", "relay":
+		node.EdgeCount, _ = sm.redis.GetEdgeCount(ctx, sessionId, nodeId)
+		node.SlotsUsed = node.EdgeCount
+		// I relay della catena tengono anche la riserva deep
+		if node.ChainIndex > 0 {
+			node.SlotsUsed++
+		}
+	case "egress":
+		node.Viewers, _ = sm.redis.GetMountpointViewers(ctx, nodeId, roomId)
+	}
+	return node
+}
+
+func (t *SessionTree) addEdge(from, to string, pathsPerEdge map[[2]string]int) {
+	t.Edges = append(t.Edges, TreeEdge{From: from, To: to, Paths: pathsPerEdge[[2]string{from, to}]})
+}
+
+// walk visita l'albero in profondità
+func (t *SessionTree) walk(visit func(*TreeNode)) {
+	var rec func(*TreeNode)
+	rec = func(n *TreeNode) {
+		visit(n)
+		for _, child := range n.Children {
+			rec(child)
+		}
+	}
+	if t.Root != nil {
+		rec(t.Root)
+	}
+}
+
+// label testo del nodo nei grafi
+func (n *TreeNode) label() string {
+	label := fmt.Sprintf("%s\\n%s [%s]", n.NodeId, n.Position, n.Status)
+	switch n.Position {
+	case "relay-root", "relay":
+		label += fmt.Sprintf("\\nslots: %d (edges: %d)", n.SlotsUsed, n.EdgeCount)
+	case "egress":
+		label += fmt.Sprintf("\\nviewers: %d", n.Viewers)
+	}
+	return label
+}
+
+// DOT rende l'albero in formato Graphviz
+func (t *SessionTree) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", "session_"+t.SessionId)
+	b.WriteString("  rankdir=TB;\n  node [shape=box, fontname=\"monospace\"];\n")
+
+	t.walk(func(n *TreeNode) {
+		fmt.Fprintf(&b, "  %q [label=\"%s\"];\n", n.NodeId, n.label())
+	})
+	for _, id := range t.Detached {
+		fmt.Fprintf(&b, "  %q [label=\"%s\\ndetached\", style=dashed];\n", id, id)
+	}
+	for _, e := range t.Edges {
+		fmt.Fprintf(&b, "  %q -> %q [label=\"paths: %d\"];\n", e.From, e.To, e.Paths)
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+var mermaidIdReplacer = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func mermaidId(nodeId string) string {
+	return mermaidIdReplacer.ReplaceAllString(nodeId, "_")
+}
+
+// Mermaid rende l'albero come flowchart Mermaid
+func (t *SessionTree) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+
+	t.walk(func(n *TreeNode) {
+		label := strings.ReplaceAll(n.label(), "\\n", "<br/>")
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", mermaidId(n.NodeId), label)
+	})
+	for _, id := range t.Detached {
+		fmt.Fprintf(&b, "  %s[\"%s<br/>detached\"]\n", mermaidId(id), id)
+	}
+	for _, e := range t.Edges {
+		fmt.Fprintf(&b, "  %s -->|paths: %d| %s\n", mermaidId(e.From), e.Paths, mermaidId(e.To))
+	}
+	return b.String()
+}
@@ -35,6 +35,19 @@ type ViewSessionResponse struct {
 	Reused       bool     `json:"reused"`
 }
 
+// ViewerTicket stato di un viewer in sala d'attesa (mesh piena)
+type ViewerTicket struct {
+	TicketId         string               `json:"ticketId,omitempty"`
+	SessionId        string               `json:"sessionId"`
+	Status           string               `json:"status"`   // waiting, admitted, expired
+	Position         int                  `json:"position"` // 0 = prossimo ad essere ammesso
+	QueueLength      int                  `json:"queueLength"`
+	EstimatedWaitSec int                  `json:"estimatedWaitSec"`
+	Deadline         time.Time            `json:"deadline,omitempty"`
+	PollURL          string               `json:"pollUrl,omitempty"`
+	Viewer           *ViewSessionResponse `json:"viewer,omitempty"`
+}
+
 // SessionSummary per lista sessioni
 type SessionSummary struct {
 	SessionId       string    `json:"sessionId"`
@@ -77,3 +90,64 @@ type PathInfo struct {
 	Hops         []string `json:"hops"`
 	WhepEndpoint string   `json:"whepEndpoint"`
 }
+
+// NodeImpact elenca cosa dipende da un nodo (preview prima di delete/drain)
+type NodeImpact struct {
+	NodeId         string          `json:"nodeId"`
+	NodeType       string          `json:"nodeType"`
+	Role           string          `json:"role"`
+	Status         string          `json:"status"`
+	Sessions       []SessionImpact `json:"sessions"`
+	DependentNodes []string        `json:"dependentNodes,omitempty"` // Nodi distrutti insieme (es. relay root)
+	TotalSessions  int             `json:"totalSessions"`
+	TotalEgresses  int             `json:"totalEgresses"`
+	TotalViewers   int             `json:"totalViewers"`
+	LiveImpact     bool            `json:"liveImpact"`
+}
+
+// SessionImpact posizione del nodo in una sessione e cosa sta a valle
+type SessionImpact struct {
+	SessionId   string         `json:"sessionId"`
+	Position    string         `json:"position"`   // injection, relay-root, chain, egress
+	ChainIndex  int            `json:"chainIndex"` // -1 se il nodo non è in catena
+	ChainLength int            `json:"chainLength"`
+	Egresses    []EgressImpact `json:"egresses"`
+	Viewers     int            `json:"viewers"`
+}
+
+// EgressImpact egress a valle del nodo con i suoi viewer
+type EgressImpact struct {
+	EgressId      string `json:"egressId"`
+	ParentRelayId string `json:"parentRelayId"`
+	Viewers       int    `json:"viewers"`
+}
+
+// SessionTree albero di distribuzione di una sessione
+type SessionTree struct {
+	SessionId     string     `json:"sessionId"`
+	RoomId        int        `json:"roomId"`
+	Chain         []string   `json:"chain"`
+	Root          *TreeNode  `json:"root"` // Injection
+	Edges         []TreeEdge `json:"edges"`
+	Detached      []string   `json:"detached"` // Egress della sessione non raggiunti dalle rotte
+	TotalEgresses int        `json:"totalEgresses"`
+	TotalViewers  int        `json:"totalViewers"`
+}
+
+type TreeNode struct {
+	NodeId     string      `json:"nodeId"`
+	Position   string      `json:"position"` // injection, relay-root, relay, egress
+	Status     string      `json:"status"`
+	ChainIndex int         `json:"chainIndex"` // -1 se fuori dalla catena
+	EdgeCount  int         `json:"edgeCount,omitempty"`
+	SlotsUsed  int         `json:"slotsUsed,omitempty"` // edge + riserva deep
+	Viewers    int         `json:"viewers,omitempty"`
+	Children   []*TreeNode `json:"children"`
+}
+
+// TreeEdge arco di inoltro (routing:{session}:{from} contiene to)
+type TreeEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Paths int    `json:"paths"` // Egress path che lo attraversano
+}
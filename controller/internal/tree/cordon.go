@@ -0,0 +1,72 @@
+package tree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"controller/internal/redis"
+)
+
+const MaxCordonTTL = 7 * 24 * time.Hour
+
+var (
+	ErrNodeNotFound      = errors.New("node not found")
+	ErrNodeNotCordonable = errors.New("node cannot be cordoned in its current state")
+	ErrInvalidCordonTTL  = errors.New("invalid cordon ttl")
+	ErrNodeNotCordoned   = errors.New("node is not cordoned")
+)
+
+// CordonNode mette il nodo in manutenzione: le sessioni esistenti restano,
+// nessuna nuova sessione, l'autoscaler non lo distrugge né lo riattiva
+// ttl 0 = fino a uncordon esplicito
+func (tm *TreeManager) CordonNode(ctx context.Context, nodeId, reason string, ttl time.Duration) (*redis.NodeCordon, error) {
+	if ttl < 0 || ttl > MaxCordonTTL {
+		return nil, fmt.Errorf("%w: must be between 0 and %v", ErrInvalidCordonTTL, MaxCordonTTL)
+	}
+
+	if _, err := tm.redis.GetNodeProvisioning(ctx, nodeId); err != nil {
+		return nil, ErrNodeNotFound
+	}
+
+	status, _ := tm.redis.GetNodeStatus(ctx, nodeId)
+	if status == "destroying" || status == "standby" || tm.redis.IsDrainRunning(ctx, nodeId) {
+		return nil, fmt.Errorf("%w (status: %s)", ErrNodeNotCordonable, status)
+	}
+
+	now := time.Now()
+	cordon := &redis.NodeCordon{
+		NodeId:    nodeId,
+		Reason:    reason,
+		CreatedAt: now.UnixMilli(),
+	}
+	if ttl > 0 {
+		cordon.ExpiresAt = now.Add(ttl).UnixMilli()
+	}
+
+	if err := tm.redis.CordonNode(ctx, cordon, ttl, "api"); err != nil {
+		if errors.Is(err, redis.ErrInvalidTransition) {
+			return nil, fmt.Errorf("%w (status: %s)", ErrNodeNotCordonable, status)
+		}
+		return nil, err
+	}
+
+	log.Printf("[PoolManager] Node %s cordoned (reason: %q, ttl: %v)", nodeId, reason, ttl)
+	return cordon, nil
+}
+
+// UncordonNode rimette il nodo nel pool selezionabile
+func (tm *TreeManager) UncordonNode(ctx context.Context, nodeId string) error {
+	prev, err := tm.redis.UncordonNode(ctx, nodeId, "api", "uncordon requested")
+	if err != nil {
+		return err
+	}
+	if prev != "cordoned" {
+		return ErrNodeNotCordoned
+	}
+
+	log.Printf("[PoolManager] Node %s uncordoned", nodeId)
+	return nil
+}
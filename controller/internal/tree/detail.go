@@ -0,0 +1,164 @@
+package tree
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"controller/internal/domain"
+	"controller/internal/provisioner"
+)
+
+// Oltre questa età le metriche di un componente sono considerate ferme
+const MetricsStaleAfter = 30 * time.Second
+
+// Timeout della chiamata a /status del nodo
+const liveStatusTimeout = 3 * time.Second
+
+// GetNodeDetail aggrega tutto quello che Redis e il nodo sanno di un nodo
+// Un nodo già rimosso resta consultabile finché ne esiste lo storico
+func (tm *TreeManager) GetNodeDetail(ctx context.Context, nodeId string) (*NodeDetail, error) {
+	history, err := tm.redis.GetNodeHistory(ctx, nodeId)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeInfo, err := tm.redis.GetNodeProvisioning(ctx, nodeId)
+	if err != nil || nodeInfo == nil {
+		if len(history) == 0 {
+			return nil, ErrNodeNotFound
+		}
+		return &NodeDetail{
+			NodeId:   nodeId,
+			Status:   history[0].To,
+			Sessions: []NodeSessionDetail{},
+			History:  history,
+		}, nil
+	}
+
+	nodeType := string(nodeInfo.NodeType)
+	status, _ := tm.redis.GetNodeStatus(ctx, nodeId)
+	detail := &NodeDetail{
+		NodeId:   nodeId,
+		NodeType: nodeType,
+		Status:   status,
+		Node:     nodeInfo,
+		Sessions: []NodeSessionDetail{},
+		History:  history,
+	}
+
+	// Hash scritto dal nodo alla registrazione (assente se non si è ancora registrato)
+	if registration, err := tm.redis.GetNode(ctx, nodeId); err == nil {
+		detail.Registration = registration
+	}
+	if cordon, err := tm.redis.GetNodeCordon(ctx, nodeId); err == nil {
+		detail.Cordon = cordon
+	}
+	if drain, err := tm.redis.GetDrainProgress(ctx, nodeId); err == nil {
+		detail.Drain = drain
+	}
+
+	detail.Topology.Parents, _ = tm.redis.GetNodeParents(ctx, nodeId)
+	detail.Topology.Children, _ = tm.redis.GetNodeChildren(ctx, nodeId)
+
+	var sessionIds []string
+	if nodeInfo.IsEgress() {
+		sessionIds, _ = tm.redis.GetEgressSessions(ctx, nodeId)
+	} else {
+		sessionIds, _ = tm.redis.GetNodeSessions(ctx, nodeId)
+	}
+	for _, sessionId := range sessionIds {
+		session := NodeSessionDetail{SessionId: sessionId}
+		if nodeInfo.NodeType == domain.NodeTypeRelay {
+			session.EdgeCount, _ = tm.redis.GetEdgeCount(ctx, sessionId, nodeId)
+		}
+		detail.Sessions = append(detail.Sessions, session)
+	}
+
+	// Score nel pool di carico (solo relay e injection)
+	if nodeType != string(domain.NodeTypeEgress) {
+		if score, err := tm.redis.ZScore(ctx, fmt.Sprintf("pool:%s:load", nodeType), nodeId); err == nil {
+			detail.LoadScore = &score
+			detail.MaxSlots = nodeInfo.MaxSlots
+		}
+	}
+
+	detail.Metrics = tm.nodeMetricsSnapshot(ctx, nodeId)
+	detail.LiveStatus, detail.LiveStatusError = tm.fetchLiveStatus(ctx, nodeInfo)
+
+	return detail, nil
+}
+
+// nodeMetricsSnapshot legge le metriche del nodo per componente con la loro età
+func (tm *TreeManager) nodeMetricsSnapshot(ctx context.Context, nodeId string) map[string]MetricsSnapshot {
+	snapshot := make(map[string]MetricsSnapshot)
+
+	metrics, err := tm.redis.GetNodeMetrics(ctx, nodeId)
+	if err != nil {
+		return snapshot
+	}
+
+	now := time.Now()
+	for component, values := range metrics {
+		entry := MetricsSnapshot{Values: values, Stale: true}
+		if updatedAt, ok := parseMetricsTimestamp(values["timestamp"]); ok {
+			entry.UpdatedAt = &updatedAt
+			entry.AgeSeconds = now.Sub(updatedAt).Seconds()
+			entry.Stale = now.Sub(updatedAt) > MetricsStaleAfter
+		}
+		snapshot[component] = entry
+	}
+	return snapshot
+}
+
+// parseMetricsTimestamp: i nodi scrivono ISO 8601, alcuni componenti epoch in ms
+func parseMetricsTimestamp(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), true
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// fetchLiveStatus inoltra la risposta di GET /status dell'API interna del nodo
+func (tm *TreeManager) fetchLiveStatus(ctx context.Context, nodeInfo *domain.NodeInfo) (json.RawMessage, string) {
+	ctx, cancel := context.WithTimeout(ctx, liveStatusTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", nodeInfo.GetInternalAPIURL()+"/status", nil)
+	if err != nil {
+		return nil, err.Error()
+	}
+	resp, err := tm.httpClient.Do(req)
+	if err != nil {
+		return nil, err.Error()
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err.Error()
+	}
+	if resp.StatusCode != http.StatusOK || !json.Valid(body) {
+		return nil, fmt.Sprintf("node status returned %d", resp.StatusCode)
+	}
+	return body, ""
+}
+
+// NodeLogs apre lo stream dei log del nodo tramite il provisioner attivo
+func (tm *TreeManager) NodeLogs(ctx context.Context, nodeId string, opts provisioner.LogOptions) (io.ReadCloser, error) {
+	nodeInfo, err := tm.redis.GetNodeProvisioning(ctx, nodeId)
+	if err != nil || nodeInfo == nil {
+		return nil, ErrNodeNotFound
+	}
+	return tm.provisioner.NodeLogs(ctx, nodeInfo, opts)
+}
@@ -0,0 +1,148 @@
+package tree
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"controller/internal/domain"
+	"controller/internal/redis"
+)
+
+const (
+	ExternalProbeInterval = 10 * time.Second
+	ExternalProbeTimeout  = 5 * time.Second
+	ExternalProbeFailures = 3 // Probe consecutivi falliti prima di segnare il nodo failed
+)
+
+// StartExternalHealthProbe controlla periodicamente /status dei nodi esterni (backend static)
+// Nessun orchestratore ne segnala la morte: senza probe resterebbero selezionabili
+// fino alla scadenza di node:{id}. Un nodo failed che torna sano rientra in active
+func (tm *TreeManager) StartExternalHealthProbe(ctx context.Context) {
+	log.Printf("[TreeManager] External health probe started (interval=%v, failures=%d)",
+		ExternalProbeInterval, ExternalProbeFailures)
+
+	go func() {
+		ticker := time.NewTicker(ExternalProbeInterval)
+		defer ticker.Stop()
+
+		failures := make(map[string]int)
+		for {
+			select {
+			case <-ticker.C:
+				tm.probeExternalNodes(ctx, failures)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// probeExternalNodes interroga in parallelo i nodi esterni e aggiorna i fallimenti consecutivi
+func (tm *TreeManager) probeExternalNodes(ctx context.Context, failures map[string]int) {
+	nodes, err := tm.redis.GetAllProvisionedNodes(ctx)
+	if err != nil {
+		log.Printf("[WARN] External probe: %v", err)
+		return
+	}
+
+	var external []*domain.NodeInfo
+	for _, node := range nodes {
+		if node.IsExternal() {
+			external = append(external, node)
+		}
+	}
+
+	results := make([]error, len(external))
+	var wg sync.WaitGroup
+	for i, node := range external {
+		wg.Add(1)
+		go func(i int, node *domain.NodeInfo) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, ExternalProbeTimeout)
+			defer cancel()
+			results[i] = tm.checkNodeHealth(probeCtx, node)
+		}(i, node)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool, len(external))
+	for i, node := range external {
+		seen[node.NodeId] = true
+		status, _ := tm.redis.GetNodeStatus(ctx, node.NodeId)
+
+		if results[i] == nil {
+			delete(failures, node.NodeId)
+			if status == redis.NodeStatusFailed {
+				tm.recoverExternalNode(ctx, node)
+			}
+			continue
+		}
+
+		switch status {
+		case redis.NodeStatusReady, redis.NodeStatusActive, redis.NodeStatusStandby,
+			redis.NodeStatusCordoned, redis.NodeStatusDraining:
+		default:
+			continue // Registrazione in corso, già failed o in uscita
+		}
+
+		failures[node.NodeId]++
+		if failures[node.NodeId] < ExternalProbeFailures {
+			continue
+		}
+		delete(failures, node.NodeId)
+		tm.failExternalNode(ctx, node, results[i])
+	}
+
+	// Nodi deregistrati nel frattempo
+	for nodeId := range failures {
+		if !seen[nodeId] {
+			delete(failures, nodeId)
+		}
+	}
+}
+
+// failExternalNode segna il nodo failed e lo pubblica su nodes:failures:
+// la riparazione sposta le sessioni, la macchina resta registrata
+func (tm *TreeManager) failExternalNode(ctx context.Context, node *domain.NodeInfo, cause error) {
+	reason := fmt.Sprintf("%d consecutive health checks failed: %v", ExternalProbeFailures, cause)
+	prev, err := tm.redis.TransitionNodeStatus(ctx, node.NodeId, redis.NodeStatusFailed, "probe", reason)
+	if err != nil {
+		log.Printf("[WARN] Failed to mark %s as failed: %v", node.NodeId, err)
+		return
+	}
+	if prev == redis.NodeStatusFailed {
+		return
+	}
+
+	log.Printf("[TreeManager] External node %s failed: %s", node.NodeId, reason)
+	if err := tm.redis.PublishNodeFailure(ctx, redis.NodeFailureEvent{
+		Type:     redis.NodeEventFailed,
+		NodeId:   node.NodeId,
+		NodeType: string(node.NodeType),
+		Cause:    "unreachable",
+		Reason:   reason,
+		Previous: prev,
+	}); err != nil {
+		log.Printf("[WARN] Failed to publish failure of %s: %v", node.NodeId, err)
+	}
+}
+
+// recoverExternalNode riporta in active un nodo esterno tornato sano
+func (tm *TreeManager) recoverExternalNode(ctx context.Context, node *domain.NodeInfo) {
+	if err := tm.redis.RecoverNodeLifecycle(ctx, node.NodeId, "probe", "health checks passing again"); err != nil {
+		log.Printf("[WARN] Failed to recover %s: %v", node.NodeId, err)
+		return
+	}
+	if _, err := tm.redis.TransitionNodeStatus(ctx, node.NodeId, redis.NodeStatusReady, "probe", "health checks passing again"); err != nil {
+		log.Printf("[WARN] Failed to recover %s: %v", node.NodeId, err)
+		return
+	}
+	if err := tm.admitNode(ctx, node.NodeType, node.NodeId, false); err != nil {
+		log.Printf("[WARN] Failed to recover %s: %v", node.NodeId, err)
+		return
+	}
+	log.Printf("[TreeManager] External node %s is healthy again", node.NodeId)
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"sync"
+	"time"
 
 	"controller/internal/domain"
 	"controller/internal/provisioner"
@@ -14,12 +16,29 @@ import (
 type TreeManager struct {
 	redis       *redis.Client
 	provisioner provisioner.Provisioner
+
+	// Readiness gating
+	httpClient   *http.Client
+	readyTimeout time.Duration
+
+	// Warm standby
+	standbyMu      sync.Mutex
+	standbyTargets map[domain.NodeType]int
+	refilling      map[domain.NodeType]bool
+
+	// Profilo per tier dei nodi creati senza profilo esplicito
+	profiles map[domain.NodeType]string
 }
 
 func NewTreeManager(redis *redis.Client, prov provisioner.Provisioner) *TreeManager {
 	return &TreeManager{
-		redis:       redis,
-		provisioner: prov,
+		redis:          redis,
+		provisioner:    prov,
+		httpClient:     &http.Client{Timeout: 5 * time.Second},
+		readyTimeout:   DefaultReadyTimeout,
+		standbyTargets: make(map[domain.NodeType]int),
+		refilling:      make(map[domain.NodeType]bool),
+		profiles:       make(map[domain.NodeType]string),
 	}
 }
 
@@ -28,17 +47,17 @@ func (tm *TreeManager) Bootstrap(ctx context.Context) error {
 	log.Println("[TreeManager] Starting bootstrap of minimum mesh...")
 
 	// 1. Creiamo il modulo d'ingresso (Injection [ingress] + RelayRoot [root])
-	if _, err := tm.CreateNode(ctx, domain.NodeTypeInjection, "ingress"); err != nil {
+	if _, err := tm.CreateNode(ctx, domain.NodeTypeInjection, "ingress", ""); err != nil {
 		return fmt.Errorf("failed to bootstrap ingress module: %w", err)
 	}
 
 	// 2. Creiamo un Relay Standalone iniziale per il pool
-	if _, err := tm.CreateNode(ctx, domain.NodeTypeRelay, "standalone"); err != nil {
+	if _, err := tm.CreateNode(ctx, domain.NodeTypeRelay, "standalone", ""); err != nil {
 		return fmt.Errorf("failed to bootstrap standalone relay: %w", err)
 	}
 
 	// 3. Creiamo un EgressNode iniziale (Ruolo: edge)
-	if _, err := tm.CreateNode(ctx, domain.NodeTypeEgress, "edge"); err != nil {
+	if _, err := tm.CreateNode(ctx, domain.NodeTypeEgress, "edge", ""); err != nil {
 		return fmt.Errorf("failed to bootstrap egress node: %w", err)
 	}
 
@@ -46,16 +65,18 @@ func (tm *TreeManager) Bootstrap(ctx context.Context) error {
 	return nil
 }
 
-func (tm *TreeManager) CreateNode(ctx context.Context, nodeType domain.NodeType, role string) ([]*domain.NodeInfo, error) {
-	log.Printf("[PoolManager] Request to create node of type: %s", nodeType)
+// CreateNode provisiona un nodo con il profilo indicato ("" = profilo del tier)
+func (tm *TreeManager) CreateNode(ctx context.Context, nodeType domain.NodeType, role, profile string) ([]*domain.NodeInfo, error) {
+	return tm.createNode(ctx, nodeType, role, profile, false)
+}
 
-	maxSlots := 0
-	switch nodeType {
-	case domain.NodeTypeRelay:
-		maxSlots = 20
-	case domain.NodeTypeInjection:
-		maxSlots = 10
+// createNode provisiona il nodo. Con standby il nodo resta fuori dal pool selezionabile
+func (tm *TreeManager) createNode(ctx context.Context, nodeType domain.NodeType, role, profileName string, standby bool) ([]*domain.NodeInfo, error) {
+	profile, err := tm.nodeProfile(nodeType, profileName)
+	if err != nil {
+		return nil, err
 	}
+	log.Printf("[PoolManager] Request to create node of type: %s (profile %s)", nodeType, profile.Name)
 
 	if nodeType == domain.NodeTypeInjection {
 		// Logica speciale: l'injection richiede sempre un RelayRoot statico
@@ -64,23 +85,33 @@ func (tm *TreeManager) CreateNode(ctx context.Context, nodeType domain.NodeType,
 
 		log.Printf("[TreeManager] Logic Pair: %s <-> %s", injId, rootId)
 
+		for _, id := range []string{injId, rootId} {
+			if err := tm.redis.BeginNodeProvisioning(ctx, id, lifecycleTarget(standby), "controller"); err != nil {
+				log.Printf("[WARN] Failed to init lifecycle for %s: %v", id, err)
+			}
+		}
+
 		// Chiamiamo il Provisioner passando entrambi gli Id
 		node, err := tm.provisioner.CreateNode(ctx, domain.NodeSpec{
 			NodeId:      injId,
 			NodeType:    nodeType,
-			MaxSlots:    maxSlots,
+			Profile:     profile.Name,
+			MaxSlots:    profile.MaxSlots,
 			RelayRootId: rootId,
 		}, role)
 
 		if err != nil {
+			tm.markNodeFailed(ctx, injId, err)
+			tm.markNodeFailed(ctx, rootId, err)
 			return nil, fmt.Errorf("provisioner failed for injection: %w", err)
 		}
 
-		// Registrazione nei Pool
-		tm.redis.AddNodeToPool(ctx, "injection", injId)
-
-		// Registrazione del Relay Root
-		tm.redis.AddNodeToPool(ctx, "relay", rootId)
+		// Il pool vede la coppia solo quando entrambi i processi sono pronti
+		if err := tm.waitNodesReady(ctx, injId, rootId); err != nil {
+			tm.markNodeFailed(ctx, rootId, err)
+			tm.rollbackNode(ctx, nodeType, injId, err)
+			return nil, fmt.Errorf("injection %s not ready: %w", injId, err)
+		}
 
 		// Creazione Topologia
 		if err := tm.redis.AddNodeChild(ctx, injId, rootId); err != nil {
@@ -90,6 +121,18 @@ func (tm *TreeManager) CreateNode(ctx context.Context, nodeType domain.NodeType,
 			log.Printf("[WARN] Failed to link parent: %v", err)
 		}
 
+		// Selezionabile (o promuovibile) solo a topologia completa
+		// Il Relay Root resta in standby insieme al suo injection
+		if err := tm.admitNode(ctx, domain.NodeTypeRelay, rootId, standby); err != nil {
+			return nil, err
+		}
+		if err := tm.admitNode(ctx, nodeType, injId, standby); err != nil {
+			return nil, err
+		}
+		if standby {
+			tm.redis.AddStandbyNode(ctx, "injection", injId)
+		}
+
 		rootInfo, _ := tm.redis.GetNodeProvisioning(ctx, rootId)
 
 		return []*domain.NodeInfo{node, rootInfo}, nil
@@ -102,23 +145,72 @@ func (tm *TreeManager) CreateNode(ctx context.Context, nodeType domain.NodeType,
 		return nil, err
 	}
 
+	if err := tm.redis.BeginNodeProvisioning(ctx, nodeId, lifecycleTarget(standby), "controller"); err != nil {
+		log.Printf("[WARN] Failed to init lifecycle for %s: %v", nodeId, err)
+	}
+
 	node, err := tm.provisioner.CreateNode(ctx, domain.NodeSpec{
-		NodeId:   nodeId,
-		NodeType: nodeType,
-		MaxSlots: maxSlots,
+		NodeId:     nodeId,
+		NodeType:   nodeType,
+		Profile:    profile.Name,
+		MaxSlots:   profile.MaxSlots,
+		MaxViewers: profile.MaxViewers,
 	}, role)
 	if err != nil {
+		tm.markNodeFailed(ctx, nodeId, err)
 		return nil, fmt.Errorf("provisioner failed for %s: %w", nodeId, err)
 	}
 
-	node.MaxSlots = maxSlots
+	node.MaxSlots = profile.MaxSlots
+
+	if err := tm.waitNodesReady(ctx, nodeId); err != nil {
+		tm.rollbackNode(ctx, nodeType, nodeId, err)
+		return nil, fmt.Errorf("node %s not ready: %w", nodeId, err)
+	}
+
+	if err := tm.admitNode(ctx, nodeType, nodeId, standby); err != nil {
+		return nil, err
+	}
+	if standby {
+		tm.redis.AddStandbyNode(ctx, string(nodeType), nodeId)
+	}
+
+	return []*domain.NodeInfo{node}, nil
+}
+
+// admitNode porta un nodo pronto nel pool selezionabile o in standby
+func (tm *TreeManager) admitNode(ctx context.Context, nodeType domain.NodeType, nodeId string, standby bool) error {
+	target := lifecycleTarget(standby)
+	if _, err := tm.redis.TransitionNodeStatus(ctx, nodeId, target, "controller", "readiness checks passed"); err != nil {
+		return fmt.Errorf("failed to admit %s: %w", nodeId, err)
+	}
+
+	if standby {
+		if err := tm.redis.MarkNodeStandby(ctx, string(nodeType), nodeId); err != nil {
+			log.Printf("[WARN] Failed to mark node %s as standby: %v", nodeId, err)
+		}
+		return nil
+	}
 
 	// Registrazione nel pool globale su Redis
 	if err := tm.redis.AddNodeToPool(ctx, string(nodeType), nodeId); err != nil {
 		log.Printf("[WARN] Failed to add node %s to pool: %v", nodeId, err)
 	}
+	return nil
+}
 
-	return []*domain.NodeInfo{node}, nil
+// lifecycleTarget stato in cui il controller porta il nodo una volta pronto
+func lifecycleTarget(standby bool) string {
+	if standby {
+		return redis.NodeStatusStandby
+	}
+	return redis.NodeStatusActive
+}
+
+func (tm *TreeManager) markNodeFailed(ctx context.Context, nodeId string, cause error) {
+	if _, err := tm.redis.TransitionNodeStatus(ctx, nodeId, redis.NodeStatusFailed, "controller", cause.Error()); err != nil {
+		log.Printf("[WARN] Failed to mark %s as failed: %v", nodeId, err)
+	}
 }
 
 // DestroyAllNodes pulisce tutto il sistema in parallelo
@@ -130,6 +222,10 @@ func (tm *TreeManager) DestroyAllNodes(ctx context.Context) error {
 
 	var wg sync.WaitGroup
 	for _, node := range nodes {
+		// I nodi esterni sopravvivono al controller: restano registrati
+		if node.IsExternal() {
+			continue
+		}
 		wg.Add(1)
 		go func(n *domain.NodeInfo) {
 			defer wg.Done()
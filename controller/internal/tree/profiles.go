@@ -0,0 +1,30 @@
+package tree
+
+import (
+	"fmt"
+
+	"controller/internal/domain"
+)
+
+// SetTierProfiles configura il profilo dei nodi creati senza profilo esplicito
+// (bootstrap, scale up dell'autoscaler, refill standby)
+func (tm *TreeManager) SetTierProfiles(profiles map[domain.NodeType]string) error {
+	for nodeType, name := range profiles {
+		if name == "" {
+			continue
+		}
+		if _, err := domain.LookupProfile(name, nodeType); err != nil {
+			return fmt.Errorf("%s: %w", nodeType, err)
+		}
+		tm.profiles[nodeType] = name
+	}
+	return nil
+}
+
+// nodeProfile profilo richiesto o, se vuoto, quello configurato per il tier
+func (tm *TreeManager) nodeProfile(nodeType domain.NodeType, name string) (domain.NodeProfile, error) {
+	if name == "" {
+		name = tm.profiles[nodeType]
+	}
+	return domain.LookupProfile(name, nodeType)
+}
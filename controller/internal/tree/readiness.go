@@ -0,0 +1,127 @@
+package tree
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"controller/internal/domain"
+	"controller/internal/redis"
+)
+
+const (
+	DefaultReadyTimeout = 90 * time.Second
+	readyPollInterval   = time.Second
+)
+
+var ErrNodeNotReady = errors.New("node did not become ready")
+
+// nodeHealth sottoinsieme di GET /status esposto dai nodi
+type nodeHealth struct {
+	Healthy bool `json:"healthy"`
+	Janus   *struct {
+		Connected bool `json:"connected"`
+	} `json:"janus"`
+	Forwarder *struct {
+		Running bool `json:"running"`
+	} `json:"forwarder"`
+}
+
+// SetReadyTimeout configura quanto attendere la readiness di un nodo prima del rollback
+func (tm *TreeManager) SetReadyTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultReadyTimeout
+	}
+	tm.readyTimeout = timeout
+}
+
+// waitNodesReady attende che tutti i nodi siano pronti entro il timeout
+func (tm *TreeManager) waitNodesReady(ctx context.Context, nodeIds ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, tm.readyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+
+	pending := nodeIds
+	for {
+		var lastErr error
+		var notReady []string
+		for _, nodeId := range pending {
+			if err := tm.checkNodeReady(ctx, nodeId); err != nil {
+				lastErr = err
+				notReady = append(notReady, nodeId)
+			}
+		}
+		if len(notReady) == 0 {
+			return nil
+		}
+		pending = notReady
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w within %v: %v", ErrNodeNotReady, tm.readyTimeout, lastErr)
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkNodeReady: registrato in Redis, API interna sana, Janus e forwarder pronti se presenti
+func (tm *TreeManager) checkNodeReady(ctx context.Context, nodeId string) error {
+	status, _ := tm.redis.GetNodeStatus(ctx, nodeId)
+	if status != redis.NodeStatusReady {
+		return fmt.Errorf("%s not registered (status: %s)", nodeId, status)
+	}
+
+	nodeInfo, err := tm.redis.GetNodeProvisioning(ctx, nodeId)
+	if err != nil {
+		return err
+	}
+	return tm.checkNodeHealth(ctx, nodeInfo)
+}
+
+// checkNodeHealth interroga GET /status del nodo
+func (tm *TreeManager) checkNodeHealth(ctx context.Context, nodeInfo *domain.NodeInfo) error {
+	nodeId := nodeInfo.NodeId
+	req, err := http.NewRequestWithContext(ctx, "GET", nodeInfo.GetInternalAPIURL()+"/status", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := tm.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s health check failed: %w", nodeId, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s health check returned status %d", nodeId, resp.StatusCode)
+	}
+
+	var health nodeHealth
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return fmt.Errorf("%s health check: invalid response: %w", nodeId, err)
+	}
+	if !health.Healthy {
+		return fmt.Errorf("%s reports unhealthy", nodeId)
+	}
+	if nodeInfo.NeedsJanus() && (health.Janus == nil || !health.Janus.Connected) {
+		return fmt.Errorf("%s not connected to Janus", nodeId)
+	}
+	if health.Forwarder != nil && !health.Forwarder.Running {
+		return fmt.Errorf("%s forwarder not running", nodeId)
+	}
+	return nil
+}
+
+// rollbackNode segna il nodo failed e lo distrugge
+func (tm *TreeManager) rollbackNode(ctx context.Context, nodeType domain.NodeType, nodeId string, cause error) {
+	log.Printf("[PoolManager] Rolling back %s: %v", nodeId, cause)
+	tm.markNodeFailed(ctx, nodeId, cause)
+	if err := tm.DestroyNode(ctx, nodeId, string(nodeType)); err != nil {
+		log.Printf("[WARN] Rollback of %s failed: %v", nodeId, err)
+	}
+}
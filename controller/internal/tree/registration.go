@@ -0,0 +1,200 @@
+package tree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"controller/internal/domain"
+	"controller/internal/provisioner"
+	"controller/internal/redis"
+)
+
+var (
+	ErrInvalidRegistration   = errors.New("invalid node registration")
+	ErrNodeAlreadyRegistered = errors.New("node already registered")
+	ErrNodeNotExternal       = errors.New("node is not externally managed")
+)
+
+// RegisterNode aggiunge alla mesh un nodo gestito esternamente (backend static)
+// Il processo del nodo deve già girare con lo stesso NODE_ID e puntare al Redis del controller:
+// dopo la registrazione passa gli stessi controlli di readiness dei nodi provisionati
+func (tm *TreeManager) RegisterNode(ctx context.Context, reg domain.NodeRegistration) ([]*domain.NodeInfo, error) {
+	registrar, ok := tm.provisioner.(provisioner.NodeRegistrar)
+	if !ok {
+		return nil, fmt.Errorf("%w: provisioner does not accept external nodes", ErrInvalidRegistration)
+	}
+
+	node := reg.NodeInfo
+	if err := normalizeRegistration(&node, ""); err != nil {
+		return nil, err
+	}
+	nodes := []*domain.NodeInfo{&node}
+
+	// L'injection porta con sé il suo Relay Root
+	var root *domain.NodeInfo
+	if node.IsInjection() {
+		if reg.RelayRoot == nil {
+			return nil, fmt.Errorf("%w: injection requires relayRoot", ErrInvalidRegistration)
+		}
+		rootInfo := *reg.RelayRoot
+		rootInfo.NodeType = domain.NodeTypeRelay
+		if rootInfo.InternalHost == "" {
+			rootInfo.InternalHost = node.InternalHost
+		}
+		if rootInfo.Profile == "" {
+			rootInfo.Profile = node.Profile
+		}
+		if err := normalizeRegistration(&rootInfo, "root"); err != nil {
+			return nil, fmt.Errorf("relayRoot: %w", err)
+		}
+		root = &rootInfo
+		nodes = append(nodes, root)
+	}
+
+	// Controllo di esistenza e prenotazione in un solo passo: due registrazioni
+	// concorrenti dello stesso NodeId non possono riuscire entrambe
+	nodeIds := make([]string, len(nodes))
+	for i, n := range nodes {
+		nodeIds[i] = n.NodeId
+	}
+	conflict, err := tm.redis.ReserveNodeIds(ctx, nodeIds, redis.NodeRegistrationTTL)
+	if err != nil {
+		return nil, err
+	}
+	if conflict != "" {
+		return nil, fmt.Errorf("%w: %s", ErrNodeAlreadyRegistered, conflict)
+	}
+	defer tm.redis.ReleaseNodeIds(context.Background(), nodeIds)
+
+	// Un nodo già avviato può essersi registrato da solo in active: lo si tiene com'è
+	var pending []string
+	for _, n := range nodes {
+		status, _ := tm.redis.GetNodeStatus(ctx, n.NodeId)
+		switch status {
+		case "", redis.NodeStatusProvisioning:
+			if err := tm.redis.BeginNodeProvisioning(ctx, n.NodeId, redis.NodeStatusActive, "api"); err != nil {
+				return nil, fmt.Errorf("failed to init lifecycle for %s: %w", n.NodeId, err)
+			}
+			pending = append(pending, n.NodeId)
+		case redis.NodeStatusReady:
+			pending = append(pending, n.NodeId)
+		case redis.NodeStatusActive:
+			if err := tm.checkNodeHealth(ctx, n); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s is %s", ErrNodeAlreadyRegistered, n.NodeId, status)
+		}
+	}
+
+	for _, n := range nodes {
+		if err := registrar.RegisterNode(ctx, n); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tm.waitNodesReady(ctx, pending...); err != nil {
+		for _, n := range nodes {
+			tm.rollbackNode(ctx, n.NodeType, n.NodeId, err)
+		}
+		return nil, fmt.Errorf("registered node not ready: %w", err)
+	}
+
+	if root != nil {
+		if err := tm.redis.AddNodeChild(ctx, node.NodeId, root.NodeId); err != nil {
+			log.Printf("[WARN] Failed to link child: %v", err)
+		}
+		if err := tm.redis.AddNodeParent(ctx, root.NodeId, node.NodeId); err != nil {
+			log.Printf("[WARN] Failed to link parent: %v", err)
+		}
+	}
+
+	// Root prima dell'injection, come per le coppie provisionate
+	for i := len(nodes) - 1; i >= 0; i-- {
+		n := nodes[i]
+		if status, _ := tm.redis.GetNodeStatus(ctx, n.NodeId); status == redis.NodeStatusActive {
+			tm.redis.AddNodeToPool(ctx, string(n.NodeType), n.NodeId)
+			continue
+		}
+		if err := tm.admitNode(ctx, n.NodeType, n.NodeId, false); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("[TreeManager] Registered external %s node %s at %s:%d", node.NodeType, node.NodeId, node.InternalHost, node.InternalAPIPort)
+	return nodes, nil
+}
+
+// normalizeRegistration valida i campi dichiarati e applica i default del tier
+func normalizeRegistration(node *domain.NodeInfo, role string) error {
+	if node.NodeId == "" {
+		return fmt.Errorf("%w: nodeId is required", ErrInvalidRegistration)
+	}
+	if node.InternalHost == "" || node.InternalAPIPort <= 0 {
+		return fmt.Errorf("%w: %s requires internalHost and internalApiPort", ErrInvalidRegistration, node.NodeId)
+	}
+
+	if role == "" {
+		defaultRole, err := scalingRole(node.NodeType)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRegistration, err)
+		}
+		role = defaultRole
+		if node.Role != "" {
+			role = node.Role
+		}
+	}
+	node.Role = role
+
+	// Capacità non dichiarata: quella del profilo (la macchina la sceglie chi registra)
+	profile, err := domain.LookupProfile(node.Profile, node.NodeType)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRegistration, err)
+	}
+	node.Profile = profile.Name
+	if node.MaxSlots <= 0 {
+		node.MaxSlots = profile.MaxSlots
+	}
+	if node.MaxViewers <= 0 {
+		node.MaxViewers = profile.MaxViewers
+	}
+	if node.ExternalHost == "" {
+		node.ExternalHost = node.InternalHost
+	}
+	if node.ExternalAPIPort == 0 && node.Role != "root" {
+		node.ExternalAPIPort = node.InternalAPIPort
+	}
+	if node.NeedsJanus() && node.JanusHost == "" {
+		node.JanusHost = node.InternalHost
+	}
+
+	node.Backend = domain.BackendStatic
+	node.ContainerId = ""
+	node.JanusContainerId = ""
+	node.CreatedAt = 0
+	return nil
+}
+
+// DeregisterNode rimuove un nodo esterno dalla mesh senza toccarne la macchina
+// Il drain con le sessioni vive lo gestisce il chiamante (SessionManager.StartDrain con Destroy)
+func (tm *TreeManager) DeregisterNode(ctx context.Context, nodeId string) error {
+	nodeInfo, err := tm.ExternalNode(ctx, nodeId)
+	if err != nil {
+		return err
+	}
+	return tm.DestroyNode(ctx, nodeId, string(nodeInfo.NodeType))
+}
+
+// ExternalNode dati di provisioning di un nodo registrato via API
+func (tm *TreeManager) ExternalNode(ctx context.Context, nodeId string) (*domain.NodeInfo, error) {
+	nodeInfo, err := tm.redis.GetNodeProvisioning(ctx, nodeId)
+	if err != nil {
+		return nil, ErrNodeNotFound
+	}
+	if !nodeInfo.IsExternal() {
+		return nil, fmt.Errorf("%w: %s, use DELETE /api/nodes/%s", ErrNodeNotExternal, nodeId, nodeId)
+	}
+	return nodeInfo, nil
+}
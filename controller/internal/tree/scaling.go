@@ -3,34 +3,58 @@ package tree
 import (
 	"context"
 	"controller/internal/domain"
+	"controller/internal/redis"
 	"fmt"
 	"log"
 )
 
-func (tm *TreeManager) ScaleUp(ctx context.Context, nodeType domain.NodeType) error {
-	log.Printf("[PoolManager] Scaling up: Provisioning new %s node", nodeType)
+// ScaleUp aggiunge un nodo al tier con il profilo scelto dall'autoscaler ("" = profilo del tier)
+func (tm *TreeManager) ScaleUp(ctx context.Context, nodeType domain.NodeType, profile string) error {
+	role, err := scalingRole(nodeType)
+	if err != nil {
+		return err
+	}
+
+	// Un nodo in standby è già pronto: promozione immediata e refill in background
+	if nodeId, ok := tm.promoteStandby(ctx, nodeType, profile); ok {
+		log.Printf("[PoolManager] Scaling up: Promoted standby %s node %s", nodeType, nodeId)
+		go tm.refillStandby(context.Background(), nodeType)
+		return nil
+	}
+
+	log.Printf("[PoolManager] Scaling up: Provisioning new %s node (profile: %q)", nodeType, profile)
+
+	// CreateNode gestisce già internamente la differenza tra Injection (coppia) e gli altri
+	if _, err := tm.CreateNode(ctx, nodeType, role, profile); err != nil {
+		return fmt.Errorf("scale up failed for %s: %w", nodeType, err)
+	}
 
-	var role string
+	return nil
+}
 
-	// Decidiamo il ruolo in base al tipo di pool che stiamo scalando
+// scalingRole decide il ruolo in base al tipo di pool che stiamo scalando
+func scalingRole(nodeType domain.NodeType) (string, error) {
 	switch nodeType {
 	case domain.NodeTypeInjection:
-		role = "ingress" // Nota: CreateNode gestirà anche la creazione del RelayRoot associato
+		return "ingress", nil // Nota: CreateNode gestirà anche la creazione del RelayRoot associato
 	case domain.NodeTypeRelay:
-		role = "standalone" // Scaliamo solo i relay standalone. I "root" scalano con l'ingresso.
+		return "standalone", nil // Scaliamo solo i relay standalone. I "root" scalano con l'ingresso.
 	case domain.NodeTypeEgress:
-		role = "edge"
+		return "edge", nil
 	default:
-		return fmt.Errorf("unknown node type for scaling: %s", nodeType)
+		return "", fmt.Errorf("unknown node type for scaling: %s", nodeType)
 	}
+}
 
-	// CreateNode gestisce già internamente la differenza tra Injection (coppia) e gli altri
-	_, err := tm.CreateNode(ctx, nodeType, role)
-	if err != nil {
-		return fmt.Errorf("scale up failed for %s: %w", nodeType, err)
+// NodeTypeOf ricava il tipo del nodo dai dati di provisioning (fallback: registrazione del nodo)
+func (tm *TreeManager) NodeTypeOf(ctx context.Context, nodeId string) (string, error) {
+	if nodeInfo, err := tm.redis.GetNodeProvisioning(ctx, nodeId); err == nil && nodeInfo.NodeType != "" {
+		return string(nodeInfo.NodeType), nil
 	}
-
-	return nil
+	if node, err := tm.redis.GetNode(ctx, nodeId); err == nil && node.NodeType != "" {
+		return node.NodeType, nil
+	}
+	return "", ErrNodeNotFound
 }
 
 // DestroyNode gestisce la rimozione controllata di un nodo.
@@ -38,7 +62,7 @@ func (tm *TreeManager) DestroyNode(ctx context.Context, nodeId, nodeType string)
 	log.Printf("[PoolManager] Scaling down: Destroying node %s (%s)", nodeId, nodeType)
 
 	// Imposta lo stato a "destroying" su Redis
-	if err := tm.redis.SetNodeStatus(ctx, nodeId, "destroying"); err != nil {
+	if _, err := tm.redis.TransitionNodeStatus(ctx, nodeId, redis.NodeStatusDestroying, "controller", "destroy requested"); err != nil {
 		log.Printf("[WARN] Failed to set status destroying for %s: %v", nodeId, err)
 	}
 
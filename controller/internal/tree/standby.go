@@ -0,0 +1,147 @@
+package tree
+
+import (
+	"context"
+	"log"
+
+	"controller/internal/domain"
+	"controller/internal/redis"
+)
+
+// SetStandbyTargets configura quanti nodi warm standby tenere per tier
+func (tm *TreeManager) SetStandbyTargets(targets map[domain.NodeType]int) {
+	tm.standbyMu.Lock()
+	defer tm.standbyMu.Unlock()
+
+	for nodeType, count := range targets {
+		if count < 0 {
+			count = 0
+		}
+		tm.standbyTargets[nodeType] = count
+	}
+}
+
+// RefillStandbyPools porta tutti i tier al numero di standby configurato
+func (tm *TreeManager) RefillStandbyPools(ctx context.Context) {
+	for _, nodeType := range []domain.NodeType{domain.NodeTypeInjection, domain.NodeTypeRelay, domain.NodeTypeEgress} {
+		tm.refillStandby(ctx, nodeType)
+	}
+}
+
+// refillStandby provisiona nodi standby fino al target del tier
+// Un solo refill per tier alla volta
+func (tm *TreeManager) refillStandby(ctx context.Context, nodeType domain.NodeType) {
+	tm.standbyMu.Lock()
+	target := tm.standbyTargets[nodeType]
+	if target == 0 || tm.refilling[nodeType] {
+		tm.standbyMu.Unlock()
+		return
+	}
+	tm.refilling[nodeType] = true
+	tm.standbyMu.Unlock()
+
+	defer func() {
+		tm.standbyMu.Lock()
+		delete(tm.refilling, nodeType)
+		tm.standbyMu.Unlock()
+	}()
+
+	role, err := scalingRole(nodeType)
+	if err != nil {
+		return
+	}
+
+	for {
+		current, err := tm.redis.GetStandbyNodes(ctx, string(nodeType))
+		if err != nil {
+			log.Printf("[WARN] Failed to read standby pool %s: %v", nodeType, err)
+			return
+		}
+
+		// Riallinea i nodi che si sono registrati nel pool dopo essere stati messi in standby
+		for _, nodeId := range current {
+			tm.redis.MarkNodeStandby(ctx, string(nodeType), nodeId)
+		}
+
+		if len(current) >= target {
+			return
+		}
+
+		log.Printf("[PoolManager] Refilling standby %s pool (%d/%d)", nodeType, len(current), target)
+		if _, err := tm.createNode(ctx, nodeType, role, "", true); err != nil {
+			log.Printf("[WARN] Standby refill failed for %s: %v", nodeType, err)
+			return
+		}
+	}
+}
+
+// promoteStandby sposta un nodo standby nel pool selezionabile
+// I nodi spariti vengono distrutti, quelli non ancora registrati o di un altro profilo restano in standby
+func (tm *TreeManager) promoteStandby(ctx context.Context, nodeType domain.NodeType, profile string) (string, bool) {
+	var notReady []string
+	defer func() {
+		for _, nodeId := range notReady {
+			tm.redis.AddStandbyNode(ctx, string(nodeType), nodeId)
+		}
+	}()
+
+	for {
+		nodeId, err := tm.redis.PopStandbyNode(ctx, string(nodeType))
+		if err != nil || nodeId == "" {
+			return "", false
+		}
+
+		// Hash sparito: il nodo è morto mentre era in standby
+		if _, err := tm.redis.GetNodeStatus(ctx, nodeId); err != nil {
+			log.Printf("[WARN] Standby node %s is gone, destroying", nodeId)
+			go tm.DestroyNode(context.Background(), nodeId, string(nodeType))
+			continue
+		}
+
+		// Il nodo non si è ancora registrato (pod in avvio)
+		if _, err := tm.redis.GetNode(ctx, nodeId); err != nil {
+			notReady = append(notReady, nodeId)
+			continue
+		}
+
+		// I standby hanno il profilo del tier: con un profilo diverso si provisiona un nodo nuovo
+		if profile != "" && domain.ProfileFor(profile, nodeType).Name != tm.standbyProfile(ctx, nodeType, nodeId) {
+			notReady = append(notReady, nodeId)
+			continue
+		}
+
+		if err := tm.activateNode(ctx, nodeType, nodeId); err != nil {
+			log.Printf("[WARN] Failed to promote standby %s: %v", nodeId, err)
+			notReady = append(notReady, nodeId)
+			continue
+		}
+
+		// L'injection porta con sé il suo Relay Root
+		if nodeType == domain.NodeTypeInjection {
+			children, _ := tm.redis.GetNodeChildren(ctx, nodeId)
+			for _, childId := range children {
+				if err := tm.activateNode(ctx, domain.NodeTypeRelay, childId); err != nil {
+					log.Printf("[WARN] Failed to promote relay root %s: %v", childId, err)
+				}
+			}
+		}
+
+		return nodeId, true
+	}
+}
+
+// standbyProfile profilo con cui è stato creato il nodo standby
+func (tm *TreeManager) standbyProfile(ctx context.Context, nodeType domain.NodeType, nodeId string) string {
+	name := tm.profiles[nodeType]
+	if info, err := tm.redis.GetNodeProvisioning(ctx, nodeId); err == nil && info.Profile != "" {
+		name = info.Profile
+	}
+	return domain.ProfileFor(name, nodeType).Name
+}
+
+func (tm *TreeManager) activateNode(ctx context.Context, nodeType domain.NodeType, nodeId string) error {
+	if _, err := tm.redis.TransitionNodeStatus(ctx, nodeId, redis.NodeStatusActive, "controller", "standby promoted on scale up"); err != nil {
+		return err
+	}
+	return tm.redis.AddNodeToPool(ctx, string(nodeType), nodeId)
+}
@@ -1,5 +1,17 @@
 package tree
 
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"controller/internal/domain"
+	"controller/internal/redis"
+)
+
 // // ValidateMesh verifica che la struttura di base sia corretta
 // func (tm *TreeManager) ValidateMesh(ctx context.Context) (bool, []string, error) {
 // 	issues := make([]string, 0)
@@ -26,3 +38,209 @@ package tree
 
 // 	return len(issues) == 0, issues, nil
 // }
+
+// TopologyFilter limita il grafo a tier e stati (vuoto = tutti)
+type TopologyFilter struct {
+	Tiers    []string
+	Statuses []string
+}
+
+func (f TopologyFilter) match(node *redis.SnapshotNode) bool {
+	if len(f.Tiers) > 0 && !slices.Contains(f.Tiers, string(node.Info.NodeType)) {
+		return false
+	}
+	if len(f.Statuses) > 0 && !slices.Contains(f.Statuses, node.Status) {
+		return false
+	}
+	return true
+}
+
+// GetTopology costruisce il grafo dell'intera mesh da un'unica snapshot Redis
+// Archi: coppie injection -> relay root (pair) e inoltri delle sessioni (route),
+// pesati con il numero di sessioni che li attraversano
+func (tm *TreeManager) GetTopology(ctx context.Context, filter TopologyFilter) (*TopologyGraph, error) {
+	snapshot, err := tm.redis.GetTopologySnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &TopologyGraph{
+		TakenAt: snapshot.TakenAt,
+		Nodes:   []GraphNode{},
+		Edges:   []GraphEdge{},
+	}
+
+	edges := make(map[[2]string]*GraphEdge)
+	addEdge := func(from, to, kind, sessionId string) {
+		key := [2]string{from, to}
+		edge, ok := edges[key]
+		if !ok {
+			edge = &GraphEdge{Source: from, Target: to, Kind: kind, Sessions: []string{}}
+			edges[key] = edge
+		}
+		if sessionId != "" && !slices.Contains(edge.Sessions, sessionId) {
+			edge.Sessions = append(edge.Sessions, sessionId)
+		}
+	}
+
+	for nodeId, node := range snapshot.Nodes {
+		if node.Info.NodeType == domain.NodeTypeInjection {
+			for _, childId := range node.Children {
+				addEdge(nodeId, childId, "pair", "")
+			}
+		}
+	}
+
+	nodeSessions := make(map[string]map[string]bool)
+	touch := func(nodeId, sessionId string) {
+		if nodeSessions[nodeId] == nil {
+			nodeSessions[nodeId] = make(map[string]bool)
+		}
+		nodeSessions[nodeId][sessionId] = true
+	}
+
+	for sessionId, session := range snapshot.Sessions {
+		if session.InjectionId != "" && len(session.Chain) > 0 {
+			addEdge(session.InjectionId, session.Chain[0], "pair", sessionId)
+			touch(session.InjectionId, sessionId)
+		}
+		for relayId, targets := range session.Routes {
+			touch(relayId, sessionId)
+			for _, targetId := range targets {
+				addEdge(relayId, targetId, "route", sessionId)
+				touch(targetId, sessionId)
+			}
+		}
+	}
+
+	included := make(map[string]bool)
+	for nodeId, node := range snapshot.Nodes {
+		if !filter.match(node) {
+			continue
+		}
+		included[nodeId] = true
+
+		graphNode := GraphNode{
+			Id:       nodeId,
+			Type:     string(node.Info.NodeType),
+			Role:     node.Info.Role,
+			Status:   node.Status,
+			InPool:   node.InPool,
+			Standby:  node.Standby,
+			MaxSlots: node.Info.MaxSlots,
+			Sessions: len(nodeSessions[nodeId]),
+		}
+		if node.HasLoad {
+			load := node.Load
+			graphNode.Load = &load
+		}
+		graph.Nodes = append(graph.Nodes, graphNode)
+	}
+
+	for _, edge := range edges {
+		if !included[edge.Source] || !included[edge.Target] {
+			continue
+		}
+		slices.Sort(edge.Sessions)
+		edge.Weight = len(edge.Sessions)
+		graph.Edges = append(graph.Edges, *edge)
+	}
+
+	slices.SortFunc(graph.Nodes, func(a, b GraphNode) int { return strings.Compare(a.Id, b.Id) })
+	slices.SortFunc(graph.Edges, func(a, b GraphEdge) int {
+		if c := strings.Compare(a.Source, b.Source); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Target, b.Target)
+	})
+	return graph, nil
+}
+
+// DOT rende il grafo in formato Graphviz
+func (g *TopologyGraph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph mesh {\n  rankdir=LR;\n  node [shape=box, fontname=\"monospace\"];\n")
+
+	for _, n := range g.Nodes {
+		label := fmt.Sprintf("%s\\n%s/%s [%s]", n.Id, n.Type, n.Role, n.Status)
+		if n.Load != nil {
+			label += fmt.Sprintf("\\nload: %.0f/%d", *n.Load, n.MaxSlots)
+		}
+		label += fmt.Sprintf("\\nsessions: %d", n.Sessions)
+
+		style := ""
+		if !n.InPool {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "  %q [label=\"%s\"%s];\n", n.Id, label, style)
+	}
+	for _, e := range g.Edges {
+		style := ""
+		if e.Kind == "pair" {
+			style = ", style=bold"
+		}
+		fmt.Fprintf(&b, "  %q -> %q [label=\"%d\", weight=%d%s];\n", e.Source, e.Target, e.Weight, e.Weight+1, style)
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// GraphML rende il grafo in formato GraphML
+func (g *TopologyGraph) GraphML() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+
+	keys := [][4]string{
+		{"type", "node", "type", "string"},
+		{"role", "node", "role", "string"},
+		{"status", "node", "status", "string"},
+		{"inPool", "node", "inPool", "boolean"},
+		{"standby", "node", "standby", "boolean"},
+		{"load", "node", "load", "double"},
+		{"maxSlots", "node", "maxSlots", "int"},
+		{"nodeSessions", "node", "sessions", "int"},
+		{"kind", "edge", "kind", "string"},
+		{"weight", "edge", "weight", "int"},
+		{"edgeSessions", "edge", "sessions", "string"},
+	}
+	for _, k := range keys {
+		fmt.Fprintf(&b, "  <key id=%q for=%q attr.name=%q attr.type=%q/>\n", k[0], k[1], k[2], k[3])
+	}
+
+	b.WriteString(`  <graph id="mesh" edgedefault="directed">` + "\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "    <node id=\"%s\">\n", xmlEscape(n.Id))
+		writeGraphMLData(&b, "type", n.Type)
+		writeGraphMLData(&b, "role", n.Role)
+		writeGraphMLData(&b, "status", n.Status)
+		writeGraphMLData(&b, "inPool", strconv.FormatBool(n.InPool))
+		writeGraphMLData(&b, "standby", strconv.FormatBool(n.Standby))
+		if n.Load != nil {
+			writeGraphMLData(&b, "load", strconv.FormatFloat(*n.Load, 'f', -1, 64))
+		}
+		writeGraphMLData(&b, "maxSlots", strconv.Itoa(n.MaxSlots))
+		writeGraphMLData(&b, "nodeSessions", strconv.Itoa(n.Sessions))
+		b.WriteString("    </node>\n")
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(&b, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\">\n", i, xmlEscape(e.Source), xmlEscape(e.Target))
+		writeGraphMLData(&b, "kind", e.Kind)
+		writeGraphMLData(&b, "weight", strconv.Itoa(e.Weight))
+		writeGraphMLData(&b, "edgeSessions", strings.Join(e.Sessions, ","))
+		b.WriteString("    </edge>\n")
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+	return b.String()
+}
+
+func writeGraphMLData(b *strings.Builder, key, value string) {
+	fmt.Fprintf(b, "      <data key=%q>%s</data>\n", key, xmlEscape(value))
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -1,9 +1,11 @@
 package tree
 
 import (
+	"encoding/json"
 	"time"
 
 	"controller/internal/domain"
+	"controller/internal/redis"
 )
 
 type PoolStatus struct {
@@ -19,8 +21,75 @@ type PoolStatus struct {
 type NodeSummary struct {
 	NodeId    string          `json:"nodeId"`
 	NodeType  domain.NodeType `json:"nodeType"`
-	Status    string          `json:"status"` // active, draining, destroying
+	Status    string          `json:"status"` // vedi redis.NodeStatus*
 	SlotsUsed int             `json:"slotsUsed"`
 	SlotsMax  int             `json:"slotsMax"`
 	CreatedAt time.Time       `json:"createdAt"`
 }
+
+// NodeDetail vista aggregata di un nodo (GET /api/nodes/:nodeId)
+type NodeDetail struct {
+	NodeId       string                     `json:"nodeId"`
+	NodeType     string                     `json:"nodeType,omitempty"`
+	Status       string                     `json:"status"`
+	Node         *domain.NodeInfo           `json:"node,omitempty"`         // Provisioning
+	Registration *redis.NodeData            `json:"registration,omitempty"` // Hash scritto dal nodo
+	Cordon       *redis.NodeCordon          `json:"cordon,omitempty"`
+	Drain        *redis.DrainProgress       `json:"drain,omitempty"`
+	Topology     NodeTopology               `json:"topology"`
+	Sessions     []NodeSessionDetail        `json:"sessions"`
+	LoadScore    *float64                   `json:"loadScore,omitempty"` // pool:{type}:load
+	MaxSlots     int                        `json:"maxSlots,omitempty"`
+	Metrics      map[string]MetricsSnapshot `json:"metrics,omitempty"`
+
+	// Risposta di GET /status del nodo, o l'errore se non raggiungibile
+	LiveStatus      json.RawMessage `json:"liveStatus,omitempty"`
+	LiveStatusError string          `json:"liveStatusError,omitempty"`
+
+	History []redis.NodeTransition `json:"history"`
+}
+
+type NodeTopology struct {
+	Parents  []string `json:"parents"`
+	Children []string `json:"children"`
+}
+
+type NodeSessionDetail struct {
+	SessionId string `json:"sessionId"`
+	EdgeCount int    `json:"edgeCount,omitempty"` // Solo relay
+}
+
+// MetricsSnapshot metriche di un componente con la loro freschezza
+type MetricsSnapshot struct {
+	Values     map[string]string `json:"values"`
+	UpdatedAt  *time.Time        `json:"updatedAt,omitempty"`
+	AgeSeconds float64           `json:"ageSeconds,omitempty"`
+	Stale      bool              `json:"stale"`
+}
+
+// TopologyGraph grafo dell'intera mesh (GET /api/topology)
+type TopologyGraph struct {
+	TakenAt time.Time   `json:"takenAt"`
+	Nodes   []GraphNode `json:"nodes"`
+	Edges   []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	Id       string   `json:"id"`
+	Type     string   `json:"type"`
+	Role     string   `json:"role"`
+	Status   string   `json:"status"`
+	InPool   bool     `json:"inPool"`
+	Standby  bool     `json:"standby"`
+	Load     *float64 `json:"load,omitempty"` // Score in pool:{type}:load
+	MaxSlots int      `json:"maxSlots"`
+	Sessions int      `json:"sessions"` // Sessioni che passano dal nodo
+}
+
+type GraphEdge struct {
+	Source   string   `json:"source"`
+	Target   string   `json:"target"`
+	Kind     string   `json:"kind"`   // pair (injection -> relay root), route
+	Weight   int      `json:"weight"` // Numero di sessioni sull'arco
+	Sessions []string `json:"sessions"`
+}
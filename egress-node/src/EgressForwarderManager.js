@@ -14,7 +14,8 @@ export class EgressForwarderManager {
         this.socketPath = `/tmp/egress-forwarder-${this.nodeId}.sock`;
 
         // process.cwd() = directory corrente (in Docker /app)
-        this.forwarderPath = path.join(process.cwd(), 'forwarder', 'egress-forwarder');
+        // FORWARDER_PATH: binario compilato altrove (provisioner local-process)
+        this.forwarderPath = process.env.FORWARDER_PATH || path.join(process.cwd(), 'forwarder', 'egress-forwarder');
 
         // Riferimenti processo C e socket
         this.forwarderProcess = null;
@@ -219,6 +219,22 @@ export class EgressNode extends BaseNode {
         }
     }
 
+    // Drain: chiudiamo l'endpoint WHEP così i viewer si ricollegano passando dal controller
+    // Il mountpoint resta attivo finché il controller non distrugge il path
+    async onSessionMigrating(event) {
+        const { sessionId, targetId } = event;
+        console.log(`[${this.nodeId}] Session ${sessionId} migrating to ${targetId || 'another egress'}`);
+
+        if (!this.whepServer || !this.mountpoints.has(sessionId)) return;
+
+        try {
+            this.whepServer.destroyEndpoint({ id: sessionId });
+            console.log(`[${this.nodeId}] WHEP endpoint ${sessionId} closed for migration`);
+        } catch (error) {
+            console.error(`[${this.nodeId}] Error closing WHEP endpoint:`, error.message);
+        }
+    }
+
     async createMountpoint(sessionId) {
         // check duplicati
         if (this.mountpoints.has(sessionId)) {
@@ -4,14 +4,21 @@ set -e
 # Default values
 export JANUS_RTP_PORT_RANGE="${JANUS_RTP_PORT_RANGE:-20000-20099}"
 export JANUS_LOG_LEVEL="${JANUS_LOG_LEVEL:-4}"
+
+# Porte dei transport (più istanze sullo stesso host con hostNetwork)
+export JANUS_HTTP_PORT="${JANUS_HTTP_PORT:-8088}"
+export JANUS_WS_PORT="${JANUS_WS_PORT:-8188}"
 export JANUS_NAT_1_1_MAPPING="${JANUS_NAT_1_1_MAPPING:-127.0.0.1}"
 
 echo "[Janus Streaming] RTP Port Range: $JANUS_RTP_PORT_RANGE"
 echo "[Janus Streaming] Log Level: $JANUS_LOG_LEVEL"
 echo "[Janus] NAT Mapping: $JANUS_NAT_1_1_MAPPING"
+echo "[Janus] HTTP Port: $JANUS_HTTP_PORT, WS Port: $JANUS_WS_PORT"
 
 # Generate config from template
 envsubst < /opt/janus/etc/janus/janus.jcfg.template > /opt/janus/etc/janus/janus.jcfg
+envsubst < /opt/janus/etc/janus/janus.transport.http.jcfg.template > /opt/janus/etc/janus/janus.transport.http.jcfg
+envsubst < /opt/janus/etc/janus/janus.transport.websockets.jcfg.template > /opt/janus/etc/janus/janus.transport.websockets.jcfg
 
 echo "[Janus Streaming] Config generated successfully"
 
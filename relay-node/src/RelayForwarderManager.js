@@ -13,7 +13,8 @@ export class RelayForwarderManager {
         this.socketPath = `/tmp/relay-forwarder-${this.nodeId}.sock`;
 
         // process.cwd() = directory corrente (in Docker /app)
-        this.forwarderPath = path.join(process.cwd(), 'forwarder', 'relay-forwarder');
+        // FORWARDER_PATH: binario compilato altrove (provisioner local-process)
+        this.forwarderPath = process.env.FORWARDER_PATH || path.join(process.cwd(), 'forwarder', 'relay-forwarder');
 
         // Riferimenti processo C e socket
         this.forwarderProcess = null;
@@ -46,6 +46,12 @@ kubectl patch deployment metrics-server -n kube-system \
 echo "Waiting for nodes to be ready..."
 kubectl wait --for=condition=Ready nodes --all --timeout=120s
 
+# Agenti idonei per injection/egress (porte e range in k8s/agents.yaml)
+echo "Labeling media agents..."
+for i in 0 1 2; do
+  kubectl label node "k3d-media-tree-agent-$i" media-mesh/agent=true --overwrite
+done
+
 echo "Next: ./build-images.sh && kubectl apply -f k8s/"
 
 # Build e Push delle immagini
@@ -59,3 +65,5 @@ echo ""
 echo "kubectl port-forward svc/media-controller 8080:8080"
 echo ""
 echo "kubectl port-forward svc/redis 6379:6379"
+echo ""
+echo "Stato dei nodi: kubectl get medianodes"
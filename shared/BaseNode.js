@@ -1,6 +1,36 @@
 import Redis from 'ioredis';
 import express from 'express';
 
+// Transizioni di registrazione, stesse regole del controller (internal/redis/lifecycle.go)
+// Un nodo provisionato dal controller (campo target) si ferma in ready: è il controller
+// a portarlo in active/standby dopo i controlli di readiness. Senza target va in active
+// KEYS[1] -> node:{id}, KEYS[2] -> node:{id}:history
+// ARGV[1] -> actor, ARGV[2] -> timestamp ms
+const REGISTER_NODE_LUA = `
+local status = redis.call('HGET', KEYS[1], 'status') or ''
+if status ~= '' and status ~= 'provisioning' and status ~= 'registering' then
+  return status
+end
+
+local target = 'active'
+if redis.call('HEXISTS', KEYS[1], 'target') == 1 then
+  target = 'ready'
+end
+
+local from = status
+for _, to in ipairs({'registering', 'ready', target}) do
+  if from ~= to then
+    redis.call('LPUSH', KEYS[2], cjson.encode({
+      from = from, to = to, actor = ARGV[1], reason = 'node registration', at = tonumber(ARGV[2])
+    }))
+    from = to
+  end
+end
+redis.call('LTRIM', KEYS[2], 0, 99)
+redis.call('HSET', KEYS[1], 'status', target)
+return target
+`;
+
 export class BaseNode {
   constructor(nodeId, nodeType, config) {
 
@@ -203,6 +233,17 @@ export class BaseNode {
   }
 
   async registerNode() {
+    // Ciclo di vita: provisioning -> registering -> ready (-> active se non gestito dal controller)
+    // Uno stato già avanzato (standby, cordoned, draining...) non viene sovrascritto
+    const status = await this.redis.eval(
+      REGISTER_NODE_LUA,
+      2,
+      `node:${this.nodeId}`,
+      `node:${this.nodeId}:history`,
+      `node:${this.nodeId}`,
+      Date.now()
+    );
+
     await this.redis.hset(`node:${this.nodeId}`, {                               //  hset setta come hash redis e non come json 
       nodeId: this.nodeId,                                                      //  dovrebbe essere un'azione atomica quindi piu performante (boh)
       type: this.nodeType,
@@ -211,11 +252,14 @@ export class BaseNode {
       port: this.port,
       audioPort: this.rtp.audioPort,
       videoPort: this.rtp.videoPort,
-      status: 'active',
       created: Date.now()
     });
 
     await this.redis.expire(`node:${this.nodeId}`, 600);
+    if (status !== 'active') {
+      console.log(`[${this.nodeId}] Registered with status ${status} (not in pool)`);
+      return;
+    }
     // Registra nodo nel tree
     const setKey = `pool:${this.nodeType}`; // pool:injection, pool:relay, pool:egress
     await this.redis.sadd(setKey, this.nodeId);
@@ -367,6 +411,10 @@ export class BaseNode {
         await this.onRouteRemoved(event);
         break;
 
+      case 'session-migrating':
+        await this.onSessionMigrating(event);
+        break;
+
       default:
         console.warn(`[${this.nodeId}] Unhandled event type: "${eventType}" (raw: ${event.type})`);
     }
@@ -680,6 +728,10 @@ export class BaseNode {
     // Override in relay
   }
 
+  async onSessionMigrating(event) {
+    // Override in egress (drain del nodo)
+  }
+
   async onReportMetrics(metrics) {
     // Override in Injection/Relay/Egress
     // Ogni nodo scrive la sua parte applicativa base